@@ -6,13 +6,25 @@ import (
     "os"
 
     . "logsviewer/pkg/backend"
+    "logsviewer/pkg/backend/config"
     "logsviewer/pkg/backend/log"
 )
 func main() {
     fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
     fs.SetOutput(os.Stdout)
     log.Log.Println("Starting logsviewer")
-    publicDir := fs.String("public-dir", "./frontend/build/", "directory containing static web assets.")
-    mux := SetupRoutes(*publicDir)
-    http.ListenAndServe(":8080", mux)
+    cfg, err := config.Load(fs, os.Args[1:])
+    if err != nil {
+        log.Log.Println(err)
+        os.Exit(1)
+    }
+    mux, err := SetupRoutes(cfg)
+    if err != nil {
+        log.Log.Println(err)
+        os.Exit(1)
+    }
+    if err := http.ListenAndServe(cfg.ListenAddress, mux); err != nil {
+        log.Log.Println("server stopped: ", err)
+        os.Exit(1)
+    }
 }
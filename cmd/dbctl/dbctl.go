@@ -0,0 +1,78 @@
+// dbctl manages the schema of the objtracker database:
+//
+//	dbctl [flags] version        prints the current and the latest schema version
+//	dbctl [flags] migrate [N]    migrates to version N, the latest by default
+//	dbctl [flags] reset          drops everything and re-creates the latest schema
+//
+// It takes the database flags, environment variables and configuration file of
+// the backend.
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "os"
+    "strconv"
+
+    "logsviewer/pkg/backend/config"
+    "logsviewer/pkg/backend/db"
+)
+
+func main() {
+    fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+    fs.SetOutput(os.Stdout)
+    cfg, err := config.Load(fs, os.Args[1:])
+    if err != nil {
+        fail(err)
+    }
+    if fs.NArg() == 0 {
+        fail(fmt.Errorf("usage: %s [flags] version|migrate [version]|reset", os.Args[0]))
+    }
+
+    store, err := db.Open(context.Background(), cfg.Database)
+    if err != nil {
+        fail(err)
+    }
+    defer store.Shutdown()
+
+    switch fs.Arg(0) {
+    case "version":
+        err = printVersion(store)
+    case "migrate":
+        version := db.LatestSchemaVersion()
+        if fs.NArg() > 1 {
+            if version, err = strconv.Atoi(fs.Arg(1)); err != nil {
+                fail(fmt.Errorf("invalid version %q", fs.Arg(1)))
+            }
+        }
+        if err = store.MigrateTo(version); err == nil {
+            err = printVersion(store)
+        }
+    case "reset":
+        if err = store.DropTables(); err == nil {
+            if err = store.InitTables(); err == nil {
+                err = printVersion(store)
+            }
+        }
+    default:
+        err = fmt.Errorf("unknown command %q", fs.Arg(0))
+    }
+    if err != nil {
+        fail(err)
+    }
+}
+
+func printVersion(store db.Store) error {
+    version, err := store.SchemaVersion()
+    if err != nil {
+        return err
+    }
+    fmt.Printf("schema version %d, latest %d\n", version, db.LatestSchemaVersion())
+    return nil
+}
+
+func fail(err error) {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+}
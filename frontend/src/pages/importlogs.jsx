@@ -11,6 +11,7 @@ const ImportLogsPage = () => {
   const [isLoading, setIsLoading] = useState(false);
   const [errorMessage, setErrorMessage] = useState("");
   const [show, setShow] = useState(true);
+  const [job, setJob] = useState();
 
   const handleClose = () => setShow(false);
   const handleShow = () => setShow(true);
@@ -18,6 +19,17 @@ const ImportLogsPage = () => {
   function handleChange(event) {
     setFile(event.target.files[0])
   }
+  function watchJob(jobId) {
+    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    const socket = new WebSocket(`${protocol}//${window.location.host}/ws?job=${jobId}`);
+    socket.onmessage = (message) => {
+      const event = JSON.parse(message.data);
+      setJob(event.job);
+      if (event.job.state === 'succeeded' || event.job.state === 'failed') {
+        socket.close();
+      }
+    };
+  }
   function handleSubmit(event) {
     event.preventDefault()
     //const url = 'http://localhost:8080/uploadLogs';
@@ -34,6 +46,9 @@ const ImportLogsPage = () => {
     axios.post(url, formData, config).then((response) => {
       console.log(response.data);
       setIsLoading(false);
+      if (response.data.jobId) {
+        watchJob(response.data.jobId);
+      }
     }).catch(error => {
         setErrorMessage(`Unable to load logs: ${error.response}`);
         setIsLoading(false);
@@ -72,6 +87,15 @@ const ImportLogsPage = () => {
             <Modal.Body>
                 {isLoading ? <LoadingSpinner />: uploadForm}
                 {errorMessage && <div className="error">{errorMessage}</div>}
+                {job && (
+                  <ul>
+                    {job.phases.map((phase) => (
+                      <li key={phase.name}>
+                        {phase.name}: {phase.state}{phase.count ? ` (${phase.count})` : ''}{phase.error && ` - ${phase.error}`}
+                      </li>
+                    ))}
+                  </ul>
+                )}
             </Modal.Body>
       </Modal>
     </DashboardLayout>
@@ -46,14 +46,12 @@ export const VmisTable = () => {
     //we need a reference to the scrolling element for logic down below
     const tableContainerRef = React.useRef<HTMLDivElement>(null);
     const fetchDSLQuery = async (
-		vmiUUID: string,
-		nodeName: string
+		vmiUUID: string
 	) => {
         const retq = await axios.get("/getVMIQueryParams",
             {
                 params: {
-                    vmiUUID: vmiUUID,
-                    nodeName: nodeName
+                    vmiUUID: vmiUUID
                 }
             }).then(function (resp) {
                 console.log("await2: ", resp.data.dslQuery)
@@ -76,7 +74,7 @@ export const VmisTable = () => {
             return retq
     }
     const openInNewTab = ({ row }: { row: Row<Vmi> }) => {
-        fetchDSLQuery(row.original.uuid, row.original.nodeName);
+        fetchDSLQuery(row.original.uuid);
     }
     const columns = React.useMemo<ColumnDef<Vmi>[]>(
         () => [
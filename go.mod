@@ -5,11 +5,15 @@ go 1.16
 require (
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gorilla/websocket v1.5.0
+	github.com/klauspost/compress v1.15.9
+	github.com/ulikunitz/xz v0.5.10
 	gopkg.in/yaml.v3 v3.0.0
 	k8s.io/api v0.23.5
 	k8s.io/apimachinery v0.23.5
 	k8s.io/client-go v0.23.5
 	kubevirt.io/api v0.58.0
+	kubevirt.io/containerized-data-importer-api v1.50.0
+	modernc.org/sqlite v1.17.3
 	sigs.k8s.io/yaml v1.3.0
 )
 
@@ -0,0 +1,460 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"logsviewer/pkg/backend/log"
+)
+
+// ErrLimitExceeded is returned when an archive is larger than the configured limits.
+var ErrLimitExceeded = errors.New("archive limit exceeded")
+
+// ErrUnsafePath is returned for entries that would be written outside the
+// extraction root.
+var ErrUnsafePath = errors.New("unsafe path in archive")
+
+// Limits bound how much an archive may expand to, guarding against
+// decompression bombs. A zero value disables the corresponding check.
+type Limits struct {
+	MaxTotalSize int64
+	MaxFileSize  int64
+	MaxEntries   int
+}
+
+// DefaultLimits fit a must-gather on the default 20G logsviewer volume.
+var DefaultLimits = Limits{
+	MaxTotalSize: 16 << 30,
+	MaxFileSize:  4 << 30,
+	MaxEntries:   1000000,
+}
+
+// RewriteFunc maps an archive entry name to the relative path it should be
+// extracted to. Returning false skips the entry.
+type RewriteFunc func(name string) (string, bool)
+
+// Extractor writes archive entries below a root directory. Entries are
+// confined to the root: absolute paths, ".." components and links that
+// resolve outside of it are rejected.
+type Extractor struct {
+	root     string
+	limits   Limits
+	rewrite  RewriteFunc
+	written  int64
+	entries  int
+	realRoot string
+}
+
+func NewExtractor(root string, limits Limits, rewrite RewriteFunc) (*Extractor, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	if rewrite == nil {
+		rewrite = func(name string) (string, bool) { return name, true }
+	}
+	return &Extractor{
+		root:     root,
+		limits:   limits,
+		rewrite:  rewrite,
+		realRoot: realRoot,
+	}, nil
+}
+
+// maxNestingDepth bounds how deep archives inside archives are unpacked.
+const maxNestingDepth = 4
+
+// ExtractFile extracts an archive file of any supported format, or copies an
+// already extracted directory.
+func (e *Extractor) ExtractFile(path string) error {
+	reader, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return e.Extract(reader)
+}
+
+// Extract writes every entry of reader below the root. Entries that are
+// archives themselves are unpacked in place of the archive file.
+func (e *Extractor) Extract(reader ArchiveReader) error {
+	if err := e.extract(reader, "", 0); err != nil {
+		return err
+	}
+	return e.removeEscapingLinks()
+}
+
+func (e *Extractor) extract(reader ArchiveReader, prefix string, depth int) error {
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive entry: %v", err)
+		}
+		if err := e.extractEntry(entry, prefix, depth); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *Extractor) extractEntry(entry *Entry, prefix string, depth int) error {
+	e.entries++
+	if e.limits.MaxEntries > 0 && e.entries > e.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, e.limits.MaxEntries)
+	}
+
+	rawName, err := nestedName(prefix, entry.Name)
+	if err != nil {
+		return err
+	}
+
+	var body *bufio.Reader
+	if entry.Type == TypeFile {
+		body = bufio.NewReaderSize(entry.Body, sniffLength)
+		if depth < maxNestingDepth {
+			head, _ := body.Peek(sniffLength)
+			if format := DetectFormat(head); format != FormatUnknown {
+				return e.extractNested(body, format, rawName, depth)
+			}
+		}
+	}
+
+	name, ok := e.rewrite(rawName)
+	if !ok {
+		return nil
+	}
+	target, err := e.targetPath(name)
+	if err != nil {
+		return err
+	}
+
+	switch entry.Type {
+	case TypeDir:
+		_, err := e.mkdirAll(target)
+		return err
+	case TypeFile:
+		return e.writeFile(target, body, entry.Size)
+	case TypeSymlink:
+		return e.symlink(target, entry.Linkname)
+	case TypeHardlink:
+		rawLinkName, err := nestedName(prefix, entry.Linkname)
+		if err != nil {
+			return err
+		}
+		linkName, ok := e.rewrite(rawLinkName)
+		if !ok {
+			log.Log.Println("skipping hard link to an entry that is not extracted: ", rawName)
+			return nil
+		}
+		source, err := e.targetPath(linkName)
+		if err != nil {
+			return err
+		}
+		return e.hardlink(target, source)
+	default:
+		log.Log.Println("skipping unsupported archive entry: ", rawName)
+		return nil
+	}
+}
+
+// nestedName places an entry of a nested archive next to the archive file
+// it came from.
+func nestedName(prefix string, name string) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	if prefix == "" {
+		return name, nil
+	}
+	return prefix + "/" + name, nil
+}
+
+func (e *Extractor) extractNested(body io.Reader, format Format, rawName string, depth int) error {
+	log.Log.Println("unpacking nested ", format, " archive: ", rawName)
+	prefix := path.Dir(rawName)
+	if prefix == "." {
+		prefix = ""
+	}
+
+	if format == FormatZip {
+		return e.extractNestedZip(body, rawName, prefix, depth)
+	}
+	reader, err := NewStreamReader(body, path.Base(rawName))
+	if err != nil {
+		return fmt.Errorf("failed to open nested archive %s: %v", rawName, err)
+	}
+	defer reader.Close()
+	return e.extract(reader, prefix, depth+1)
+}
+
+// extractNestedZip spools a zip archive found inside a stream to a temporary
+// file, since zip archives can only be read with random access.
+func (e *Extractor) extractNestedZip(body io.Reader, rawName string, prefix string, depth int) error {
+	tmp, err := ioutil.TempFile("", "logsviewer-nested-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	limit := e.remaining()
+	var copied int64
+	if limit < 0 {
+		copied, err = io.Copy(tmp, body)
+	} else {
+		copied, err = io.Copy(tmp, io.LimitReader(body, limit+1))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read nested archive %s: %v", rawName, err)
+	}
+	if limit >= 0 && copied > limit {
+		return fmt.Errorf("%w: nested archive %s", ErrLimitExceeded, rawName)
+	}
+
+	reader, err := Open(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("failed to open nested archive %s: %v", rawName, err)
+	}
+	defer reader.Close()
+	return e.extract(reader, prefix, depth+1)
+}
+
+// targetPath joins an entry name onto the root, refusing names that escape it.
+func (e *Extractor) targetPath(name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	cleaned := filepath.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return filepath.Join(e.root, cleaned), nil
+}
+
+// within reports whether an absolute, symlink-free path lies inside the root.
+func (e *Extractor) within(path string) bool {
+	rel, err := filepath.Rel(e.realRoot, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// prepareParent creates the parent directory of target and returns it with
+// the symlinks created by earlier entries resolved.
+func (e *Extractor) prepareParent(target string) (string, error) {
+	return e.mkdirAll(filepath.Dir(target))
+}
+
+// mkdirAll creates dir, a path below the root, one component at a time. Each
+// existing component is resolved and verified to be inside the root before
+// anything is created in it. It returns dir with its symlinks resolved.
+func (e *Extractor) mkdirAll(dir string) (string, error) {
+	rel, err := filepath.Rel(e.root, dir)
+	if err != nil {
+		return "", err
+	}
+	current := e.realRoot
+	for _, component := range strings.Split(rel, string(filepath.Separator)) {
+		if component == "." || component == "" {
+			continue
+		}
+		next := filepath.Join(current, component)
+		info, err := os.Lstat(next)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(next, 0755); err != nil {
+				return "", err
+			}
+		case err != nil:
+			return "", err
+		case info.Mode()&os.ModeSymlink != 0:
+			if next, err = filepath.EvalSymlinks(next); err != nil {
+				return "", err
+			}
+			if !e.within(next) {
+				return "", fmt.Errorf("%w: %s resolves outside of %s", ErrUnsafePath, dir, e.root)
+			}
+		case !info.IsDir():
+			return "", fmt.Errorf("%s is not a directory", next)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// removeExisting makes sure a later entry never writes through a link left
+// by an earlier one.
+func removeExisting(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot replace directory %s", path)
+	}
+	return os.Remove(path)
+}
+
+func (e *Extractor) writeFile(target string, content io.Reader, size int64) error {
+	// size is -1 when unknown, e.g. for decompressed single files
+	if e.limits.MaxFileSize > 0 && size > e.limits.MaxFileSize {
+		return fmt.Errorf("%w: %s is %d bytes", ErrLimitExceeded, target, size)
+	}
+	realParent, err := e.prepareParent(target)
+	if err != nil {
+		return err
+	}
+	target = filepath.Join(realParent, filepath.Base(target))
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+
+	outFile, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// the header size cannot be trusted, so the copy itself is bounded too
+	limit := e.remaining()
+	if e.limits.MaxFileSize > 0 && (limit < 0 || e.limits.MaxFileSize < limit) {
+		limit = e.limits.MaxFileSize
+	}
+	var written int64
+	if limit < 0 {
+		written, err = io.Copy(outFile, content)
+	} else {
+		written, err = io.Copy(outFile, io.LimitReader(content, limit+1))
+	}
+	e.written += written
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %v", target, err)
+	}
+	if limit >= 0 && written > limit {
+		return fmt.Errorf("%w: extracting %s", ErrLimitExceeded, target)
+	}
+	return nil
+}
+
+// remaining returns how many bytes may still be written, or -1 for no limit.
+func (e *Extractor) remaining() int64 {
+	if e.limits.MaxTotalSize <= 0 {
+		return -1
+	}
+	if left := e.limits.MaxTotalSize - e.written; left > 0 {
+		return left
+	}
+	return 0
+}
+
+func (e *Extractor) symlink(target string, linkName string) error {
+	if filepath.IsAbs(linkName) {
+		log.Log.Println("skipping symlink with an absolute target: ", target, " -> ", linkName)
+		return nil
+	}
+	realParent, err := e.prepareParent(target)
+	if err != nil {
+		return err
+	}
+	if !e.linkWithin(realParent, linkName) {
+		log.Log.Println("skipping symlink pointing outside of the extraction root: ", target, " -> ", linkName)
+		return nil
+	}
+	target = filepath.Join(realParent, filepath.Base(target))
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	if err := os.Symlink(linkName, target); err != nil {
+		return err
+	}
+	// the target itself may be a link
+	if resolved, err := filepath.EvalSymlinks(target); err == nil && !e.within(resolved) {
+		log.Log.Println("skipping symlink resolving outside of the extraction root: ", target, " -> ", linkName)
+		return os.Remove(target)
+	}
+	return nil
+}
+
+// linkWithin reports whether a relative link target, followed from dir, stays
+// inside the root. It is followed one component at a time, the way it will be
+// resolved, and must not pass through a symlink: ".." after a symlink leaves
+// the directory the link points to, not the one it is in.
+func (e *Extractor) linkWithin(dir string, linkName string) bool {
+	current := dir
+	components := strings.Split(filepath.FromSlash(linkName), string(filepath.Separator))
+	for i, component := range components {
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, component)
+		}
+		if !e.within(current) {
+			return false
+		}
+		if i == len(components)-1 {
+			break
+		}
+		if info, err := os.Lstat(current); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// removeEscapingLinks removes the symlinks that, once every entry is
+// extracted, don't resolve inside the root. A link checked when it was
+// created can still be redirected by links created after it.
+func (e *Extractor) removeEscapingLinks() error {
+	return filepath.Walk(e.realRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil && e.within(resolved) {
+			return nil
+		}
+		log.Log.Println("removing symlink that does not resolve inside the extraction root: ", path)
+		return os.Remove(path)
+	})
+}
+
+func (e *Extractor) hardlink(target string, source string) error {
+	realSource, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return fmt.Errorf("hard link %s to a missing entry: %v", target, err)
+	}
+	if !e.within(realSource) {
+		return fmt.Errorf("%w: hard link %s resolves outside of %s", ErrUnsafePath, target, e.root)
+	}
+	realParent, err := e.prepareParent(target)
+	if err != nil {
+		return err
+	}
+	target = filepath.Join(realParent, filepath.Base(target))
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	return os.Link(realSource, target)
+}
@@ -0,0 +1,283 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarEntry is an entry of a tar archive built by newTar.
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func newTar(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.linkname, Mode: 0644}
+		switch entry.typeflag {
+		case tar.TypeDir:
+			header.Mode = 0755
+		case tar.TypeReg:
+			header.Size = int64(len(entry.body))
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.typeflag == tar.TypeReg {
+			if _, err := w.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extractTar extracts content into the root directory of a new temporary
+// directory, and returns that directory.
+func extractTar(t *testing.T, limits Limits, content []byte) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	extractor, err := NewExtractor(filepath.Join(dir, "root"), limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewStreamReader(bytes.NewReader(content), "must-gather.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	return dir, extractor.Extract(reader)
+}
+
+// assertOnlyRoot fails when anything but the root was created in dir.
+func assertOnlyRoot(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "root" {
+			t.Errorf("%s was created outside of the extraction root", entry.Name())
+		}
+	}
+}
+
+func TestExtractDoesNotCreateDirectoriesThroughLinks(t *testing.T) {
+	// l -> a/.. is the parent of the root once a -> . is followed
+	dir, err := extractTar(t, Limits{}, newTar(t,
+		tarEntry{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+		tarEntry{name: "l", typeflag: tar.TypeSymlink, linkname: "a/.."},
+		tarEntry{name: "l/x/y", typeflag: tar.TypeDir},
+	))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	assertOnlyRoot(t, dir)
+	if info, err := os.Lstat(filepath.Join(dir, "root", "l")); err != nil || !info.IsDir() {
+		t.Errorf("l/x/y was not created as a plain directory inside the root")
+	}
+}
+
+func TestExtractRejectsDirectoriesBelowEscapingLinks(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	extractor, err := NewExtractor(root, Limits{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a link left in the root, e.g. by an earlier import
+	if err := os.Symlink(dir, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewStreamReader(bytes.NewReader(newTar(t,
+		tarEntry{name: "escape/x/y", typeflag: tar.TypeDir},
+	)), "must-gather.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := extractor.Extract(reader); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Extract() error = %v, want ErrUnsafePath", err)
+	}
+	assertOnlyRoot(t, dir)
+}
+
+func TestExtractRemovesChainedEscapingLinks(t *testing.T) {
+	for name, entries := range map[string][]tarEntry{
+		"through an existing link": {
+			{name: "p", typeflag: tar.TypeDir},
+			{name: "p/d", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "p/x", typeflag: tar.TypeSymlink, linkname: "d/.."},
+		},
+		"through a later link": {
+			{name: "p", typeflag: tar.TypeDir},
+			{name: "p/x", typeflag: tar.TypeSymlink, linkname: "e/../.."},
+			{name: "p/e", typeflag: tar.TypeSymlink, linkname: ".."},
+		},
+		"to an escaping link": {
+			{name: "up", typeflag: tar.TypeSymlink, linkname: "p/../.."},
+			{name: "x", typeflag: tar.TypeSymlink, linkname: "up"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := extractTar(t, Limits{}, newTar(t, entries...))
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			err = filepath.Walk(filepath.Join(dir, "root"), func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.Mode()&os.ModeSymlink == 0 {
+					return err
+				}
+				resolved, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					t.Errorf("%s was kept but does not resolve: %v", path, err)
+				} else if rel, _ := filepath.Rel(filepath.Join(dir, "root"), resolved); strings.HasPrefix(rel, "..") {
+					t.Errorf("%s resolves outside of the root, to %s", path, resolved)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "root", "p", "x")); err == nil {
+				t.Errorf("p/x was kept")
+			}
+		})
+	}
+}
+
+func TestExtractUnsafeEntries(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		limits  Limits
+		entries []tarEntry
+		wantErr error
+		// kept are the paths below the root that must exist afterwards
+		kept []string
+	}{
+		{
+			name:    "parent directory",
+			entries: []tarEntry{{name: "../evil", typeflag: tar.TypeReg, body: "x"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "parent directory after a component",
+			entries: []tarEntry{{name: "logs/../../evil", typeflag: tar.TypeReg, body: "x"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "absolute path",
+			entries: []tarEntry{{name: "/tmp/evil", typeflag: tar.TypeReg, body: "x"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "parent directory of a directory",
+			entries: []tarEntry{{name: "../evil/", typeflag: tar.TypeDir}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name: "symlink to the parent directory",
+			entries: []tarEntry{
+				{name: "up", typeflag: tar.TypeSymlink, linkname: "../"},
+				{name: "up/evil", typeflag: tar.TypeReg, body: "x"},
+			},
+			kept: []string{"up/evil"},
+		},
+		{
+			name: "absolute symlink",
+			entries: []tarEntry{
+				{name: "etc", typeflag: tar.TypeSymlink, linkname: "/etc"},
+				{name: "etc/evil", typeflag: tar.TypeReg, body: "x"},
+			},
+			kept: []string{"etc/evil"},
+		},
+		{
+			name: "symlink inside the root",
+			entries: []tarEntry{
+				{name: "logs/0.log", typeflag: tar.TypeReg, body: "x"},
+				{name: "logs/current.log", typeflag: tar.TypeSymlink, linkname: "0.log"},
+			},
+			kept: []string{"logs/0.log", "logs/current.log"},
+		},
+		{
+			name: "hard link inside the root",
+			entries: []tarEntry{
+				{name: "logs/0.log", typeflag: tar.TypeReg, body: "x"},
+				{name: "logs/1.log", typeflag: tar.TypeLink, linkname: "logs/0.log"},
+			},
+			kept: []string{"logs/0.log", "logs/1.log"},
+		},
+		{
+			name:    "hard link to the parent directory",
+			entries: []tarEntry{{name: "evil", typeflag: tar.TypeLink, linkname: "../outside"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name: "hard link to a symlink",
+			entries: []tarEntry{
+				{name: "logs/0.log", typeflag: tar.TypeReg, body: "x"},
+				{name: "logs/current.log", typeflag: tar.TypeSymlink, linkname: "0.log"},
+				{name: "logs/copy.log", typeflag: tar.TypeLink, linkname: "logs/current.log"},
+			},
+			kept: []string{"logs/copy.log"},
+		},
+		{
+			name:    "file larger than the limit",
+			limits:  Limits{MaxFileSize: 4},
+			entries: []tarEntry{{name: "big", typeflag: tar.TypeReg, body: "12345"}},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:   "archive larger than the limit",
+			limits: Limits{MaxTotalSize: 8},
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeReg, body: "12345"},
+				{name: "b", typeflag: tar.TypeReg, body: "12345"},
+			},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:   "more entries than the limit",
+			limits: Limits{MaxEntries: 2},
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeDir},
+				{name: "b", typeflag: tar.TypeDir},
+				{name: "c", typeflag: tar.TypeDir},
+			},
+			wantErr: ErrLimitExceeded,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := extractTar(t, tc.limits, newTar(t, tc.entries...))
+			if tc.wantErr == nil && err != nil {
+				t.Errorf("Extract() error = %v", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("Extract() error = %v, want %v", err, tc.wantErr)
+			}
+			assertOnlyRoot(t, dir)
+			for _, kept := range tc.kept {
+				resolved, err := filepath.EvalSymlinks(filepath.Join(dir, "root", kept))
+				if err != nil {
+					t.Errorf("%s was not extracted: %v", kept, err)
+				} else if rel, _ := filepath.Rel(filepath.Join(dir, "root"), resolved); strings.HasPrefix(rel, "..") {
+					t.Errorf("%s resolves outside of the root, to %s", kept, resolved)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package archive
+
+import (
+	"bytes"
+)
+
+// Format identifies an archive or compression format by its magic bytes.
+type Format string
+
+const (
+	FormatUnknown Format = ""
+	FormatTar     Format = "tar"
+	FormatZip     Format = "zip"
+	FormatGzip    Format = "gzip"
+	FormatXz      Format = "xz"
+	FormatZstd    Format = "zstd"
+	FormatBzip2   Format = "bzip2"
+)
+
+// sniffLength is how many leading bytes DetectFormat needs to recognize
+// every supported format; the tar magic sits at offset 257.
+const sniffLength = 512
+
+var magics = []struct {
+	format Format
+	offset int
+	magic  []byte
+}{
+	{FormatGzip, 0, []byte{0x1f, 0x8b}},
+	{FormatXz, 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{FormatZstd, 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatBzip2, 0, []byte("BZh")},
+	{FormatZip, 0, []byte("PK\x03\x04")},
+	{FormatZip, 0, []byte("PK\x05\x06")},
+	{FormatTar, 257, []byte("ustar")},
+}
+
+// DetectFormat inspects the first bytes of a file. It returns FormatUnknown
+// for anything that is neither an archive nor a compressed stream.
+func DetectFormat(head []byte) Format {
+	for _, m := range magics {
+		end := m.offset + len(m.magic)
+		if len(head) >= end && bytes.Equal(head[m.offset:end], m.magic) {
+			return m.format
+		}
+	}
+	return FormatUnknown
+}
+
+// IsCompression reports whether the format is a compressed stream rather
+// than a container of entries.
+func (f Format) IsCompression() bool {
+	switch f {
+	case FormatGzip, FormatXz, FormatZstd, FormatBzip2:
+		return true
+	}
+	return false
+}
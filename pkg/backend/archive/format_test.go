@@ -0,0 +1,243 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressors wrap content in each supported compression that has a writer.
+var compressors = map[Format]func(w io.Writer) (io.WriteCloser, error){
+	FormatGzip: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	FormatXz:   func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) },
+	FormatZstd: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+}
+
+func compress(t *testing.T, format Format, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := compressors[format](&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipEntry is an entry of a zip archive built by newZip. A linkname makes it
+// a symlink.
+type zipEntry struct {
+	name     string
+	linkname string
+	body     []byte
+}
+
+func newZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		body := entry.body
+		if entry.linkname != "" {
+			header.SetMode(os.ModeSymlink | 0777)
+			body = []byte(entry.linkname)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extractFile writes content to a file and extracts it with ExtractFile into
+// the root directory of a new temporary directory, which it returns.
+func extractFile(t *testing.T, name string, content []byte) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	src := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	extractor, err := NewExtractor(filepath.Join(dir, "root"), DefaultLimits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, extractor.ExtractFile(src)
+}
+
+func assertFile(t *testing.T, path string, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("%s was not extracted: %v", path, err)
+	} else if string(got) != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tarball := newTar(t, tarEntry{name: "a", typeflag: tar.TypeReg, body: "x"})
+	for _, tc := range []struct {
+		name string
+		head []byte
+		want Format
+	}{
+		{"tar", tarball, FormatTar},
+		{"zip", newZip(t, zipEntry{name: "a", body: []byte("x")}), FormatZip},
+		{"empty zip", newZip(t), FormatZip},
+		{"gzip", compress(t, FormatGzip, tarball), FormatGzip},
+		{"xz", compress(t, FormatXz, tarball), FormatXz},
+		{"zstd", compress(t, FormatZstd, tarball), FormatZstd},
+		{"bzip2", []byte("BZh91AY&SY"), FormatBzip2},
+		{"text", []byte("{\"level\":\"info\"}\n"), FormatUnknown},
+		{"empty", nil, FormatUnknown},
+		{"truncated tar", tarball[:200], FormatUnknown},
+		{"truncated gzip", []byte{0x1f}, FormatUnknown},
+	} {
+		if got := DetectFormat(tc.head); got != tc.want {
+			t.Errorf("DetectFormat(%s) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestExtractFormats(t *testing.T) {
+	tarball := newTar(t,
+		tarEntry{name: "must-gather/", typeflag: tar.TypeDir},
+		tarEntry{name: "must-gather/version", typeflag: tar.TypeReg, body: "4.12"},
+	)
+	for _, tc := range []struct {
+		name    string
+		content []byte
+	}{
+		{"must-gather.tar", tarball},
+		{"must-gather.tar.gz", compress(t, FormatGzip, tarball)},
+		{"must-gather.tar.xz", compress(t, FormatXz, tarball)},
+		{"must-gather.tar.zst", compress(t, FormatZstd, tarball)},
+		{"must-gather.zip", newZip(t, zipEntry{name: "must-gather/version", body: []byte("4.12")})},
+		// the name does not matter, the content does
+		{"must-gather.bin", compress(t, FormatGzip, tarball)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := extractFile(t, tc.name, tc.content)
+			if err != nil {
+				t.Fatalf("ExtractFile() error = %v", err)
+			}
+			assertFile(t, filepath.Join(dir, "root", "must-gather", "version"), "4.12")
+		})
+	}
+}
+
+func TestExtractCompressedFile(t *testing.T) {
+	dir, err := extractFile(t, "kubelet.log.gz", compress(t, FormatGzip, []byte("log line\n")))
+	if err != nil {
+		t.Fatalf("ExtractFile() error = %v", err)
+	}
+	assertFile(t, filepath.Join(dir, "root", "kubelet.log"), "log line\n")
+}
+
+func TestExtractNestedArchives(t *testing.T) {
+	inner := newTar(t, tarEntry{name: "namespaces/version", typeflag: tar.TypeReg, body: "inner"})
+	innerZip := newZip(t, zipEntry{name: "nodes/version", body: []byte("zip")})
+	outer := newTar(t,
+		tarEntry{name: "must-gather/", typeflag: tar.TypeDir},
+		tarEntry{name: "must-gather/inner.tar.gz", typeflag: tar.TypeReg, body: string(compress(t, FormatGzip, inner))},
+		tarEntry{name: "must-gather/inner.zip", typeflag: tar.TypeReg, body: string(innerZip)},
+	)
+	for _, tc := range []struct {
+		name    string
+		content []byte
+	}{
+		{"must-gather.tar.zst", compress(t, FormatZstd, outer)},
+		{"must-gather.zip", newZip(t,
+			zipEntry{name: "must-gather/inner.tar.gz", body: compress(t, FormatGzip, inner)},
+			zipEntry{name: "must-gather/inner.zip", body: innerZip},
+		)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := extractFile(t, tc.name, tc.content)
+			if err != nil {
+				t.Fatalf("ExtractFile() error = %v", err)
+			}
+			// the entries of nested archives replace the archive file
+			assertFile(t, filepath.Join(dir, "root", "must-gather", "namespaces", "version"), "inner")
+			assertFile(t, filepath.Join(dir, "root", "must-gather", "nodes", "version"), "zip")
+			for _, archive := range []string{"inner.tar.gz", "inner.zip"} {
+				if _, err := os.Lstat(filepath.Join(dir, "root", "must-gather", archive)); err == nil {
+					t.Errorf("the nested archive %s was kept", archive)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractUnsafeNestedEntries(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{"zip parent directory", newZip(t, zipEntry{name: "../evil", body: []byte("x")}), ErrUnsafePath},
+		{"zip absolute path", newZip(t, zipEntry{name: "/tmp/evil", body: []byte("x")}), ErrUnsafePath},
+		{"nested parent directory", newTar(t,
+			tarEntry{name: "inner.tar", typeflag: tar.TypeReg, body: string(newTar(t, tarEntry{name: "../../evil", typeflag: tar.TypeReg, body: "x"}))},
+		), ErrUnsafePath},
+		{"nested archive larger than the limit", newTar(t,
+			tarEntry{name: "inner.tar.gz", typeflag: tar.TypeReg, body: string(compress(t, FormatGzip, newTar(t,
+				tarEntry{name: "big", typeflag: tar.TypeReg, body: string(make([]byte, 64))},
+			)))},
+		), ErrLimitExceeded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(t.TempDir(), "must-gather")
+			if err := os.WriteFile(src, tc.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			extractor, err := NewExtractor(filepath.Join(dir, "root"), Limits{MaxFileSize: 32}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := extractor.ExtractFile(src); !errors.Is(err, tc.wantErr) {
+				t.Errorf("ExtractFile() error = %v, want %v", err, tc.wantErr)
+			}
+			assertOnlyRoot(t, dir)
+		})
+	}
+}
+
+func TestExtractZipSymlinks(t *testing.T) {
+	dir, err := extractFile(t, "must-gather.zip", newZip(t,
+		zipEntry{name: "logs/0.log", body: []byte("x")},
+		zipEntry{name: "logs/current.log", linkname: "0.log"},
+		zipEntry{name: "logs/up", linkname: "../.."},
+	))
+	if err != nil {
+		t.Fatalf("ExtractFile() error = %v", err)
+	}
+	assertFile(t, filepath.Join(dir, "root", "logs", "current.log"), "x")
+	if _, err := os.Lstat(filepath.Join(dir, "root", "logs", "up")); err == nil {
+		t.Errorf("the escaping symlink was extracted")
+	}
+}
@@ -0,0 +1,373 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// ErrUnsupportedFormat is returned for files that are not a recognized archive.
+var ErrUnsupportedFormat = errors.New("unsupported archive format")
+
+// errNeedsRandomAccess is returned when a zip archive is found in a stream;
+// zip archives can only be read from a file.
+var errNeedsRandomAccess = errors.New("zip archives require random access")
+
+type EntryType int
+
+const (
+	TypeFile EntryType = iota
+	TypeDir
+	TypeSymlink
+	TypeHardlink
+	TypeOther
+)
+
+// Entry is a single member of an archive. Body is only valid until the next
+// call to ArchiveReader.Next.
+type Entry struct {
+	Name     string
+	Type     EntryType
+	Linkname string
+	Size     int64
+	Body     io.Reader
+}
+
+// ArchiveReader iterates over the entries of an archive regardless of its
+// on-disk format. Next returns io.EOF after the last entry.
+type ArchiveReader interface {
+	Next() (*Entry, error)
+	Close() error
+}
+
+// Open detects the format of path and returns a reader over its entries.
+// Directories are read as if they were an archive of their contents.
+func Open(path string) (ArchiveReader, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return newDirReader(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, sniffLength)
+	n, _ := io.ReadFull(file, head)
+	if DetectFormat(head[:n]) == FormatZip {
+		reader, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &zipReader{reader: reader, closer: file}, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader, err := NewStreamReader(file, filepath.Base(path))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &closingReader{ArchiveReader: reader, closer: file}, nil
+}
+
+// NewStreamReader reads a tar archive, optionally wrapped in any supported
+// compression. A compressed stream that does not contain a tar archive is
+// returned as a single entry named after name without its extension.
+func NewStreamReader(r io.Reader, name string) (ArchiveReader, error) {
+	return newStreamReader(r, name, false)
+}
+
+func newStreamReader(r io.Reader, name string, decompressed bool) (ArchiveReader, error) {
+	buffered := bufio.NewReaderSize(r, sniffLength)
+	head, _ := buffered.Peek(sniffLength)
+
+	format := DetectFormat(head)
+	switch format {
+	case FormatTar:
+		return &tarReader{reader: tar.NewReader(buffered)}, nil
+	case FormatZip:
+		return nil, errNeedsRandomAccess
+	case FormatUnknown:
+		if decompressed {
+			return &singleFileReader{name: name, body: buffered}, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+	}
+
+	stream, closer, err := decompress(format, buffered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s stream: %v", format, err)
+	}
+	inner, err := newStreamReader(stream, trimCompressionSuffix(name), true)
+	if err != nil {
+		if closer != nil {
+			closer()
+		}
+		return nil, err
+	}
+	if closer == nil {
+		return inner, nil
+	}
+	return &closingReader{ArchiveReader: inner, closer: closerFunc(closer)}, nil
+}
+
+func decompress(format Format, r io.Reader) (io.Reader, func() error, error) {
+	switch format {
+	case FormatGzip:
+		reader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, reader.Close, nil
+	case FormatXz:
+		reader, err := xz.NewReader(r)
+		return reader, nil, err
+	case FormatZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decoder, func() error { decoder.Close(); return nil }, nil
+	case FormatBzip2:
+		return bzip2.NewReader(r), nil, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+var compressionSuffixes = []string{".tgz", ".gz", ".xz", ".zst", ".zstd", ".bz2"}
+
+func trimCompressionSuffix(name string) string {
+	for _, suffix := range compressionSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			trimmed := strings.TrimSuffix(name, suffix)
+			if suffix == ".tgz" {
+				trimmed += ".tar"
+			}
+			return trimmed
+		}
+	}
+	return name
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// closingReader releases an underlying resource, e.g. the archive file or a
+// decompressor, together with the reader.
+type closingReader struct {
+	ArchiveReader
+	closer io.Closer
+}
+
+func (c *closingReader) Close() error {
+	err := c.ArchiveReader.Close()
+	if closeErr := c.closer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type tarReader struct {
+	reader *tar.Reader
+}
+
+func (t *tarReader) Next() (*Entry, error) {
+	header, err := t.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{
+		Name:     header.Name,
+		Linkname: header.Linkname,
+		Size:     header.Size,
+		Body:     t.reader,
+	}
+	switch header.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		entry.Type = TypeFile
+	case tar.TypeDir:
+		entry.Type = TypeDir
+	case tar.TypeSymlink:
+		entry.Type = TypeSymlink
+	case tar.TypeLink:
+		entry.Type = TypeHardlink
+	default:
+		entry.Type = TypeOther
+	}
+	return entry, nil
+}
+
+func (t *tarReader) Close() error { return nil }
+
+type zipReader struct {
+	reader  *zip.Reader
+	closer  io.Closer
+	index   int
+	current io.ReadCloser
+}
+
+func (z *zipReader) Next() (*Entry, error) {
+	z.closeCurrent()
+	if z.index >= len(z.reader.File) {
+		return nil, io.EOF
+	}
+	file := z.reader.File[z.index]
+	z.index++
+
+	entry := &Entry{Name: file.Name, Size: int64(file.UncompressedSize64)}
+	mode := file.Mode()
+	switch {
+	case mode.IsDir():
+		entry.Type = TypeDir
+		return entry, nil
+	case mode&fs.ModeSymlink != 0:
+		entry.Type = TypeSymlink
+	case mode.IsRegular():
+		entry.Type = TypeFile
+	default:
+		entry.Type = TypeOther
+		return entry, nil
+	}
+
+	body, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	z.current = body
+	if entry.Type == TypeSymlink {
+		target, err := io.ReadAll(io.LimitReader(body, 4096))
+		if err != nil {
+			return nil, err
+		}
+		entry.Linkname = string(target)
+		return entry, nil
+	}
+	entry.Body = body
+	return entry, nil
+}
+
+func (z *zipReader) closeCurrent() {
+	if z.current != nil {
+		z.current.Close()
+		z.current = nil
+	}
+}
+
+func (z *zipReader) Close() error {
+	z.closeCurrent()
+	return z.closer.Close()
+}
+
+// dirReader presents an already extracted must-gather as archive entries.
+type dirReader struct {
+	root    string
+	paths   []string
+	index   int
+	current *os.File
+}
+
+func newDirReader(root string) (*dirReader, error) {
+	reader := &dirReader{root: root}
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root {
+			reader.paths = append(reader.paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (d *dirReader) Next() (*Entry, error) {
+	d.closeCurrent()
+	if d.index >= len(d.paths) {
+		return nil, io.EOF
+	}
+	p := d.paths[d.index]
+	d.index++
+
+	rel, err := filepath.Rel(d.root, p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{Name: filepath.ToSlash(rel), Size: info.Size()}
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		entry.Type = TypeDir
+	case mode&fs.ModeSymlink != 0:
+		entry.Type = TypeSymlink
+		if entry.Linkname, err = os.Readlink(p); err != nil {
+			return nil, err
+		}
+	case mode.IsRegular():
+		entry.Type = TypeFile
+		if d.current, err = os.Open(p); err != nil {
+			return nil, err
+		}
+		entry.Body = d.current
+	default:
+		entry.Type = TypeOther
+	}
+	return entry, nil
+}
+
+func (d *dirReader) closeCurrent() {
+	if d.current != nil {
+		d.current.Close()
+		d.current = nil
+	}
+}
+
+func (d *dirReader) Close() error {
+	d.closeCurrent()
+	return nil
+}
+
+// singleFileReader exposes a compressed file that is not an archive, such as
+// a rotated "current.log.gz", as one entry.
+type singleFileReader struct {
+	name string
+	body io.Reader
+	done bool
+}
+
+func (s *singleFileReader) Next() (*Entry, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	s.done = true
+	return &Entry{Name: path.Clean(s.name), Type: TypeFile, Size: -1, Body: s.body}, nil
+}
+
+func (s *singleFileReader) Close() error { return nil }
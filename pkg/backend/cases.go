@@ -0,0 +1,185 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/ingest"
+	"logsviewer/pkg/backend/log"
+)
+
+// newCase registers a case for a new import and prepares its directory and
+// Kibana data view. name defaults to the imported source.
+func (s *server) newCase(name string, source string) (*db.Case, error) {
+	if name == "" {
+		name = filepath.Base(source)
+	}
+	importCase := &db.Case{
+		ID:           string(uuid.NewUUID()),
+		Name:         name,
+		Source:       source,
+		CreationTime: time.Now().UTC(),
+	}
+
+	if err := os.MkdirAll(s.config.CaseDir(importCase.ID), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateCase(importCase); err != nil {
+		return nil, err
+	}
+
+	// the logs are still available through /api/logs without Kibana
+	if err := s.createKibanaDataView(s.config.CaseDataViewID(importCase.ID), s.config.CaseIndexPattern(importCase.ID)); err != nil {
+		log.Log.Println("failed to create kibana data view for case ", importCase.ID, " - ", err)
+	}
+	return importCase, nil
+}
+
+// resolveCase returns the case named by the "case" parameter. Without it the
+// most recent case is used, and the default case when nothing was imported.
+func resolveCase(dbInst db.Store, values url.Values) (string, error) {
+	if caseID := values.Get("case"); caseID != "" {
+		if _, err := dbInst.GetCase(caseID); err != nil {
+			return "", err
+		}
+		return caseID, nil
+	}
+	cases, err := dbInst.GetCases()
+	if err != nil {
+		return "", err
+	}
+	if len(cases) == 0 {
+		return db.DefaultCaseID, nil
+	}
+	return cases[len(cases)-1].ID, nil
+}
+
+// openCaseStore returns the store scoped to the case of the request, see
+// resolveCase. Its statements are canceled along with the request.
+func (s *server) openCaseStore(r *http.Request) (db.Store, string, error) {
+	dbInst := s.store.WithContext(r.Context())
+	caseID, err := resolveCase(dbInst, r.URL.Query())
+	if err != nil {
+		return nil, "", err
+	}
+	return dbInst.ForCase(caseID), caseID, nil
+}
+
+// deleteCase removes the objects, files, log indices and data view of a case.
+// It waits for a running import to finish.
+func (s *server) deleteCase(caseID string) error {
+	s.importLock.Lock()
+	defer s.importLock.Unlock()
+	return s.removeCase(caseID)
+}
+
+// removeCase is deleteCase for a case no import is running for, e.g. one
+// whose upload failed.
+func (s *server) removeCase(caseID string) error {
+	if err := s.store.DeleteCase(caseID); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(s.config.CaseDir(caseID)); err != nil {
+		return err
+	}
+	if err := ingest.DeleteIndices(s.config.Elasticsearch.URL, s.config.CaseIndexPattern(caseID)); err != nil {
+		log.Log.Println("failed to delete the log indices of case ", caseID, " - ", err)
+	}
+	if err := s.deleteKibanaDataView(s.config.CaseDataViewID(caseID)); err != nil {
+		log.Log.Println("failed to delete the kibana data view of case ", caseID, " - ", err)
+	}
+	return nil
+}
+
+// getCases lists the imported cases, oldest first.
+func (s *server) getCases(w http.ResponseWriter, r *http.Request) {
+	cases, err := s.store.WithContext(r.Context()).GetCases()
+	if err != nil {
+		log.Log.Println("failed to get cases", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"data": cases,
+	})
+}
+
+// caseHandler serves GET and DELETE on /api/cases/<id>, and GET on
+// /api/cases/<id>/dead-letters.
+func (s *server) caseHandler(w http.ResponseWriter, r *http.Request) {
+	caseID := strings.TrimPrefix(r.URL.Path, "/api/cases/")
+	if parts := strings.Split(caseID, "/"); len(parts) == 2 && parts[1] == "dead-letters" {
+		s.getDeadLetters(w, r, parts[0])
+		return
+	}
+	if strings.Contains(caseID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		importCase, err := s.store.WithContext(r.Context()).GetCase(caseID)
+		if errors.Is(err, db.ErrCaseNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, importCase)
+	case http.MethodDelete:
+		err := s.deleteCase(caseID)
+		if errors.Is(err, db.ErrCaseNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Log.Println("failed to delete case ", caseID, " - ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// getDeadLetters lists the objects the imports of a case failed to store.
+func (s *server) getDeadLetters(w http.ResponseWriter, r *http.Request, caseID string) {
+	log.Log.Println("Get Dead Letters Endpoint Hit: ", caseID)
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	dbInst := s.store.WithContext(r.Context())
+	if _, err := dbInst.GetCase(caseID); err != nil {
+		if errors.Is(err, db.ErrCaseNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	deadLetters, err := dbInst.ForCase(caseID).GetDeadLetters()
+	if err != nil {
+		log.Log.Println("failed to get the dead letters of case ", caseID, " - ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"data": deadLetters,
+	})
+}
@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/log"
+)
+
+// getClusterInfo returns how KubeVirt is deployed in the case: its version,
+// the KubeVirt and HyperConverged CRs and the component images.
+func (s *server) getClusterInfo(w http.ResponseWriter, r *http.Request) {
+	log.Log.Println("Get Cluster Info Endpoint Hit: ", r.URL.Query())
+	dbInst, _, err := s.openCaseStore(r)
+	if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	info, err := dbInst.GetClusterInfo()
+	if err != nil {
+		log.Log.Println("failed to get cluster info", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, info)
+}
@@ -0,0 +1,346 @@
+// Package config holds the settings of the logsviewer service. They are read
+// from an optional YAML file, then from LOGSVIEWER_* environment variables and
+// last from command line flags, each overriding the previous one.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/resources"
+)
+
+const (
+	LogStoreElasticsearch = "elasticsearch"
+	LogStoreLocal         = "local"
+)
+
+// ErrImportPathDenied rejects directories that can't be imported by path.
+var ErrImportPathDenied = errors.New("import path denied")
+
+type Elasticsearch struct {
+	URL string `json:"url"`
+	// IndexPrefix starts the name of every log index, see Config.CaseIndexPrefix.
+	IndexPrefix string `json:"indexPrefix"`
+}
+
+type Kibana struct {
+	URL string `json:"url"`
+	// DefaultDataView spans the logs of all cases.
+	DefaultDataView string `json:"defaultDataView"`
+}
+
+// Config is the configuration of the service, e.g.
+//
+//	listenAddress: ":8080"
+//	spaceDir: /space
+//	elasticsearch:
+//	  url: http://localhost:9200
+//	database:
+//	  driver: sqlite
+type Config struct {
+	ListenAddress string `json:"listenAddress"`
+	// PublicDir holds the built frontend.
+	PublicDir string `json:"publicDir"`
+	// SpaceDir keeps the cases, see CaseDir.
+	SpaceDir string `json:"spaceDir"`
+	// EnrichmentDataFile is kept in the directory of each case.
+	EnrichmentDataFile string `json:"enrichmentDataFile"`
+	// NoiseRulesFile defaults to noise-rules.yaml in SpaceDir.
+	NoiseRulesFile string `json:"noiseRulesFile"`
+	// ImportDir holds extracted must-gathers that can be imported by path,
+	// see ImportPath. Empty disables imports by path.
+	ImportDir string `json:"importDir,omitempty"`
+	// LogStore is where /api/logs reads from: LogStoreElasticsearch, or
+	// LogStoreLocal for the extracted log files.
+	LogStore      string        `json:"logStore"`
+	Elasticsearch Elasticsearch `json:"elasticsearch"`
+	Kibana        Kibana        `json:"kibana"`
+	// Database.Path, for SQLite, defaults to objtracker.db in SpaceDir.
+	Database db.Config `json:"database"`
+	// Resources are kinds to read from must-gathers generically, in addition
+	// to, or replacing, the built-in ones of package resources.
+	Resources []resources.Kind `json:"resources,omitempty"`
+}
+
+func Default() Config {
+	dbConfig := db.DefaultConfig()
+	dbConfig.Path = ""
+	return Config{
+		ListenAddress:      ":8080",
+		PublicDir:          "./frontend/build/",
+		SpaceDir:           "/space",
+		EnrichmentDataFile: "result.json",
+		LogStore:           LogStoreElasticsearch,
+		Elasticsearch: Elasticsearch{
+			URL:         "http://localhost:9200",
+			IndexPrefix: "cnvlogs-",
+		},
+		Kibana: Kibana{
+			URL:             "http://localhost:5601",
+			DefaultDataView: "cnvlogs-default",
+		},
+		Database: dbConfig,
+	}
+}
+
+// option is a setting that can be given as a flag and an environment variable.
+type option struct {
+	flag  string
+	env   string
+	usage string
+	value func(c *Config) flag.Value
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) Set(value string) error {
+	*v.p = value
+	return nil
+}
+
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) Set(value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*v.p = i
+	return nil
+}
+
+func (v intValue) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.p)
+}
+
+type durationValue struct{ p *metav1.Duration }
+
+func (v durationValue) Set(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	v.p.Duration = d
+	return nil
+}
+
+func (v durationValue) String() string {
+	if v.p == nil {
+		return "0s"
+	}
+	return v.p.Duration.String()
+}
+
+var options = []option{
+	{"listen-address", "LOGSVIEWER_LISTEN_ADDRESS", "address the HTTP server listens on", func(c *Config) flag.Value { return stringValue{&c.ListenAddress} }},
+	{"public-dir", "LOGSVIEWER_PUBLIC_DIR", "directory containing static web assets.", func(c *Config) flag.Value { return stringValue{&c.PublicDir} }},
+	{"space-dir", "LOGSVIEWER_SPACE_DIR", "directory the cases are kept in", func(c *Config) flag.Value { return stringValue{&c.SpaceDir} }},
+	{"enrichment-data-file", "LOGSVIEWER_ENRICHMENT_DATA_FILE", "name of the pod enrichment data file of each case", func(c *Config) flag.Value { return stringValue{&c.EnrichmentDataFile} }},
+	{"noise-rules", "LOGSVIEWER_NOISE_RULES", "noise rule file (default noise-rules.yaml in the space directory)", func(c *Config) flag.Value { return stringValue{&c.NoiseRulesFile} }},
+	{"import-dir", "LOGSVIEWER_IMPORT_DIR", "directory extracted must-gathers can be imported by path from (default none)", func(c *Config) flag.Value { return stringValue{&c.ImportDir} }},
+	{"log-store", "LOGSVIEWER_LOG_STORE", "where logs are searched: elasticsearch or local", func(c *Config) flag.Value { return stringValue{&c.LogStore} }},
+	{"elasticsearch-url", "LOGSVIEWER_ELASTICSEARCH_URL", "Elasticsearch URL", func(c *Config) flag.Value { return stringValue{&c.Elasticsearch.URL} }},
+	{"index-prefix", "LOGSVIEWER_INDEX_PREFIX", "prefix of the log indices", func(c *Config) flag.Value { return stringValue{&c.Elasticsearch.IndexPrefix} }},
+	{"kibana-url", "LOGSVIEWER_KIBANA_URL", "Kibana URL", func(c *Config) flag.Value { return stringValue{&c.Kibana.URL} }},
+	{"kibana-data-view", "LOGSVIEWER_KIBANA_DATA_VIEW", "Kibana data view spanning all cases", func(c *Config) flag.Value { return stringValue{&c.Kibana.DefaultDataView} }},
+	{"db-driver", "LOGSVIEWER_DB_DRIVER", "database driver: mysql or sqlite", func(c *Config) flag.Value { return stringValue{&c.Database.Driver} }},
+	{"db-path", "LOGSVIEWER_DB_PATH", "SQLite database file (default objtracker.db in the space directory)", func(c *Config) flag.Value { return stringValue{&c.Database.Path} }},
+	{"db-host", "LOGSVIEWER_DB_HOST", "MySQL host", func(c *Config) flag.Value { return stringValue{&c.Database.Host} }},
+	{"db-port", "LOGSVIEWER_DB_PORT", "MySQL port", func(c *Config) flag.Value { return stringValue{&c.Database.Port} }},
+	{"db-user", "LOGSVIEWER_DB_USER", "MySQL user", func(c *Config) flag.Value { return stringValue{&c.Database.Username} }},
+	{"db-password", "LOGSVIEWER_DB_PASSWORD", "MySQL password", func(c *Config) flag.Value { return stringValue{&c.Database.Password} }},
+	{"db-name", "LOGSVIEWER_DB_NAME", "MySQL database", func(c *Config) flag.Value { return stringValue{&c.Database.Name} }},
+	{"db-max-open-conns", "LOGSVIEWER_DB_MAX_OPEN_CONNS", "MySQL connections open at most", func(c *Config) flag.Value { return intValue{&c.Database.MaxOpenConns} }},
+	{"db-max-idle-conns", "LOGSVIEWER_DB_MAX_IDLE_CONNS", "idle MySQL connections kept open", func(c *Config) flag.Value { return intValue{&c.Database.MaxIdleConns} }},
+	{"db-conn-max-lifetime", "LOGSVIEWER_DB_CONN_MAX_LIFETIME", "time after which a MySQL connection is reopened", func(c *Config) flag.Value { return durationValue{&c.Database.ConnMaxLifetime} }},
+	{"db-query-timeout", "LOGSVIEWER_DB_QUERY_TIMEOUT", "timeout of every database statement", func(c *Config) flag.Value { return durationValue{&c.Database.QueryTimeout} }},
+	{"db-connect-timeout", "LOGSVIEWER_DB_CONNECT_TIMEOUT", "how long to wait for the database on startup", func(c *Config) flag.Value { return durationValue{&c.Database.ConnectTimeout} }},
+}
+
+// Load registers the settings on fs, parses args and returns the validated
+// configuration. The YAML file is given with --config or LOGSVIEWER_CONFIG.
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	defaults := Default()
+	configFile := fs.String("config", os.Getenv("LOGSVIEWER_CONFIG"), "YAML configuration file (env LOGSVIEWER_CONFIG)")
+	byFlag := map[string]option{}
+	for _, opt := range options {
+		fs.Var(opt.value(&defaults), opt.flag, fmt.Sprintf("%s (env %s)", opt.usage, opt.env))
+		byFlag[opt.flag] = opt
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *configFile != "" {
+		raw, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
+			return Config{}, fmt.Errorf("failed to parse %s: %v", *configFile, err)
+		}
+	}
+	for _, opt := range options {
+		if value, ok := os.LookupEnv(opt.env); ok && value != "" {
+			if err := opt.value(&cfg).Set(value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %v", opt.env, err)
+			}
+		}
+	}
+	// only the flags given on the command line, the others keep the lower
+	// layers; their values were already checked by Parse
+	fs.Visit(func(f *flag.Flag) {
+		if opt, ok := byFlag[f.Name]; ok {
+			_ = opt.value(&cfg).Set(f.Value.String())
+		}
+	})
+
+	if cfg.NoiseRulesFile == "" {
+		cfg.NoiseRulesFile = filepath.Join(cfg.SpaceDir, "noise-rules.yaml")
+	}
+	if cfg.Database.Path == "" {
+		cfg.Database.Path = filepath.Join(cfg.SpaceDir, "objtracker.db")
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var problems []string
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		problems = append(problems, fmt.Sprintf("listenAddress: %v", err))
+	}
+	if c.SpaceDir == "" {
+		problems = append(problems, "spaceDir is required")
+	}
+	if c.EnrichmentDataFile == "" || filepath.Base(c.EnrichmentDataFile) != c.EnrichmentDataFile {
+		problems = append(problems, fmt.Sprintf("enrichmentDataFile %q must be a file name", c.EnrichmentDataFile))
+	}
+	if c.LogStore != LogStoreElasticsearch && c.LogStore != LogStoreLocal {
+		problems = append(problems, fmt.Sprintf("logStore %q must be %s or %s", c.LogStore, LogStoreElasticsearch, LogStoreLocal))
+	}
+	for _, endpoint := range []struct{ name, url string }{
+		{"elasticsearch.url", c.Elasticsearch.URL},
+		{"kibana.url", c.Kibana.URL},
+	} {
+		if parsed, err := url.Parse(endpoint.url); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s %q must be an http(s) URL", endpoint.name, endpoint.url))
+		}
+	}
+	// Elasticsearch index names are lower case
+	if c.Elasticsearch.IndexPrefix == "" || strings.ToLower(c.Elasticsearch.IndexPrefix) != c.Elasticsearch.IndexPrefix {
+		problems = append(problems, fmt.Sprintf("elasticsearch.indexPrefix %q must be lower case and not empty", c.Elasticsearch.IndexPrefix))
+	}
+	if c.Kibana.DefaultDataView == "" {
+		problems = append(problems, "kibana.defaultDataView is required")
+	}
+	switch c.Database.Driver {
+	case db.DriverSQLite:
+		if c.Database.Path == "" {
+			problems = append(problems, "database.path is required for sqlite")
+		}
+	case db.DriverMySQL:
+		if c.Database.Host == "" || c.Database.Port == "" || c.Database.Name == "" || c.Database.Username == "" {
+			problems = append(problems, "database host, port, name and username are required for mysql")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("database.driver %q must be %s or %s", c.Database.Driver, db.DriverMySQL, db.DriverSQLite))
+	}
+	if _, err := resources.NewRegistry(c.Resources); err != nil {
+		problems = append(problems, fmt.Sprintf("resources: %v", err))
+	}
+	if c.Database.MaxOpenConns < 1 || c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database.maxOpenConns must be at least 1 and database.maxIdleConns at most maxOpenConns")
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"database.connMaxLifetime", c.Database.ConnMaxLifetime.Duration},
+		{"database.queryTimeout", c.Database.QueryTimeout.Duration},
+		{"database.connectTimeout", c.Database.ConnectTimeout.Duration},
+	} {
+		if timeout.value <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive", timeout.name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CaseDir is the directory the must-gather of a case is extracted to.
+func (c Config) CaseDir(caseID string) string {
+	return filepath.Join(c.SpaceDir, "cases", caseID)
+}
+
+// ImportPath resolves a directory to import by path, relative to ImportDir
+// unless absolute. Symlinks are resolved before the directory is checked to
+// be within ImportDir.
+func (c Config) ImportPath(path string) (string, error) {
+	if c.ImportDir == "" {
+		return "", fmt.Errorf("%w: importing by path is disabled, see importDir", ErrImportPathDenied)
+	}
+	root, err := filepath.EvalSymlinks(c.ImportDir)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrImportPathDenied, err)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is not within %s", ErrImportPathDenied, path, c.ImportDir)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%w: %s is not a directory", ErrImportPathDenied, path)
+	}
+	return resolved, nil
+}
+
+// CaseIndexPrefix is the prefix of the daily log indices of a case.
+func (c Config) CaseIndexPrefix(caseID string) string {
+	return c.Elasticsearch.IndexPrefix + caseID + "-"
+}
+
+func (c Config) CaseIndexPattern(caseID string) string {
+	return c.CaseIndexPrefix(caseID) + "*"
+}
+
+func (c Config) CaseDataViewID(caseID string) string {
+	return c.Elasticsearch.IndexPrefix + caseID
+}
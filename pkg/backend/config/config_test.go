@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{"must-gather", "nested/must-gather"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"inside":  filepath.Join(root, "nested"),
+		"escape":  outside,
+		"up":      "..",
+		"chained": "escape",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := Config{ImportDir: root}
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"must-gather", filepath.Join(root, "must-gather")},
+		{filepath.Join(root, "nested/must-gather"), filepath.Join(root, "nested/must-gather")},
+		{"inside/must-gather", filepath.Join(root, "nested/must-gather")},
+		{".", root},
+	} {
+		got, err := c.ImportPath(tc.path)
+		want, _ := filepath.EvalSymlinks(tc.want)
+		if err != nil || got != want {
+			t.Errorf("ImportPath(%q) = %q, %v, want %q", tc.path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{
+		"..",
+		"../" + filepath.Base(outside),
+		outside,
+		"/etc",
+		"escape",
+		"up",
+		"chained",
+		"must-gather/../../",
+		"file",
+		"missing",
+	} {
+		if got, err := c.ImportPath(path); !errors.Is(err, ErrImportPathDenied) {
+			t.Errorf("ImportPath(%q) = %q, %v, want ErrImportPathDenied", path, got, err)
+		}
+	}
+
+	if _, err := (Config{}).ImportPath(root); !errors.Is(err, ErrImportPathDenied) {
+		t.Errorf("ImportPath() without an import dir error = %v, want ErrImportPathDenied", err)
+	}
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// batchRows is the number of rows written by a single multi-row insert. It
+// keeps the widest table well below the placeholder limits of both drivers.
+const batchRows = 200
+
+// Batch collects the objects of an import, to be written together by
+// StoreBatch.
+type Batch struct {
+	Pods           []*Pod
+	Vmis           []*VirtualMachineInstance
+	VmiMigrations  []*VirtualMachineInstanceMigration
+	Vms            []*VirtualMachine
+	Nodes          []*Node
+	Events         []*Event
+	DataVolumes    []*DataVolume
+	PVCs           []*PersistentVolumeClaim
+	PVs            []*PersistentVolume
+	StorageClasses []*StorageClass
+	Components     []*Component
+	Resources      []*Resource
+	// Volumes link the VMIs and VMs of the batch to their claims, and
+	// Relations the objects of the batch to each other; they are derived
+	// from those objects and not counted on their own
+	Volumes   []*Volume
+	Relations []*Relation
+}
+
+// Counts returns the number of objects of each kind, keyed by table.
+func (b *Batch) Counts() map[string]int {
+	return map[string]int{
+		"pods":           len(b.Pods),
+		"vmis":           len(b.Vmis),
+		"vmimigrations":  len(b.VmiMigrations),
+		"vms":            len(b.Vms),
+		"nodes":          len(b.Nodes),
+		"events":         len(b.Events),
+		"datavolumes":    len(b.DataVolumes),
+		"pvcs":           len(b.PVCs),
+		"pvs":            len(b.PVs),
+		"storageclasses": len(b.StorageClasses),
+		"components":     len(b.Components),
+		"resources":      len(b.Resources),
+	}
+}
+
+// Len is the number of objects in the batch.
+func (b *Batch) Len() int {
+	total := 0
+	for _, count := range b.Counts() {
+		total += count
+	}
+	return total
+}
+
+// batchTable is the rows of a batch that go into one table.
+type batchTable struct {
+	query func(rows int) string
+	rows  [][]interface{}
+}
+
+// StoreBatch writes all objects of b in a single transaction, with multi-row
+// inserts: either the whole batch is stored or nothing is.
+func (d *databaseInstance) StoreBatch(b *Batch) error {
+	tables := []batchTable{
+		{query: d.insertNodeQuery},
+		{query: d.insertPodQuery},
+		{query: d.insertVmiMigrationQuery},
+		{query: d.insertVmiQuery},
+		{query: d.insertVmQuery},
+		{query: d.insertEventQuery},
+		{query: d.insertStorageClassQuery},
+		{query: d.insertPVQuery},
+		{query: d.insertPVCQuery},
+		{query: d.insertDataVolumeQuery},
+		{query: d.insertVolumeQuery},
+		{query: d.insertComponentQuery},
+		{query: d.insertResourceQuery},
+		{query: d.insertRelationQuery},
+	}
+	for _, node := range b.Nodes {
+		tables[0].rows = append(tables[0].rows, d.nodeRow(node))
+	}
+	for _, pod := range b.Pods {
+		tables[1].rows = append(tables[1].rows, d.podRow(pod))
+	}
+	for _, vmim := range b.VmiMigrations {
+		tables[2].rows = append(tables[2].rows, d.vmiMigrationRow(vmim))
+	}
+	for _, vmi := range b.Vmis {
+		tables[3].rows = append(tables[3].rows, d.vmiRow(vmi))
+	}
+	for _, vm := range b.Vms {
+		tables[4].rows = append(tables[4].rows, d.vmRow(vm))
+	}
+	for _, event := range b.Events {
+		tables[5].rows = append(tables[5].rows, d.eventRow(event))
+	}
+	for _, sc := range b.StorageClasses {
+		tables[6].rows = append(tables[6].rows, d.storageClassRow(sc))
+	}
+	for _, pv := range b.PVs {
+		tables[7].rows = append(tables[7].rows, d.pvRow(pv))
+	}
+	for _, pvc := range b.PVCs {
+		tables[8].rows = append(tables[8].rows, d.pvcRow(pvc))
+	}
+	for _, dv := range b.DataVolumes {
+		tables[9].rows = append(tables[9].rows, d.dataVolumeRow(dv))
+	}
+	for _, volume := range b.Volumes {
+		tables[10].rows = append(tables[10].rows, d.volumeRow(volume))
+	}
+	for _, component := range b.Components {
+		tables[11].rows = append(tables[11].rows, d.componentRow(component))
+	}
+	for _, resource := range b.Resources {
+		tables[12].rows = append(tables[12].rows, d.resourceRow(resource))
+	}
+	for _, relation := range b.Relations {
+		tables[13].rows = append(tables[13].rows, d.relationRow(relation))
+	}
+
+	// one query timeout for every insert, and one for the commit
+	statements := 1
+	for _, table := range tables {
+		statements += (len(table.rows) + batchRows - 1) / batchRows
+	}
+	ctx, cancel := context.WithTimeout(d.ctx, time.Duration(statements)*d.queryTimeout)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		for start := 0; start < len(table.rows); start += batchRows {
+			end := start + batchRows
+			if end > len(table.rows) {
+				end = len(table.rows)
+			}
+			var args []interface{}
+			for _, row := range table.rows[start:end] {
+				args = append(args, row...)
+			}
+			if _, err := tx.ExecContext(ctx, table.query(end-start), args...); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
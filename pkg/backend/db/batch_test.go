@@ -0,0 +1,126 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// benchmarkObjects is the number of pods and of VMIs every benchmark stores.
+const benchmarkObjects = 1000
+
+func newBenchmarkBatch() *Batch {
+	created := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	batch := &Batch{}
+	for i := 0; i < benchmarkObjects; i++ {
+		name := fmt.Sprintf("vm-%04d", i)
+		batch.Pods = append(batch.Pods, testPod("virt-launcher-"+name, "default", created))
+		batch.Vmis = append(batch.Vmis, &VirtualMachineInstance{
+			Name:         name,
+			Namespace:    "default",
+			UUID:         "vmi-" + name,
+			Phase:        "Running",
+			NodeName:     "node01",
+			CreationTime: metav1.NewTime(created),
+			Content:      []byte("{}"),
+		})
+	}
+	return batch
+}
+
+func TestStoreBatch(t *testing.T) {
+	store := newTestStore(t)
+	batch := newBenchmarkBatch()
+	batch.Vms = []*VirtualMachine{{
+		Name:            "vm-0000",
+		Namespace:       "default",
+		UUID:            "vm-0000",
+		PrintableStatus: "Starting",
+		CreationTime:    metav1.NewTime(time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)),
+		Content:         []byte("{}"),
+	}}
+	if err := store.StoreBatch(batch); err != nil {
+		t.Fatalf("StoreBatch() error = %v", err)
+	}
+	// storing again does not duplicate the rows: pods and VMIs keep the row
+	// stored first, as StorePod and StoreVmi do, other objects are updated
+	batch.Pods[0].Phase = "Succeeded"
+	batch.Vmis[0].Phase = "Failed"
+	batch.Vms[0].PrintableStatus = "Running"
+	if err := store.StoreBatch(batch); err != nil {
+		t.Fatalf("StoreBatch() again error = %v", err)
+	}
+	for _, tc := range []struct {
+		get    func(opts ListOptions) (map[string]interface{}, error)
+		name   string
+		column string
+		want   string
+	}{
+		{store.GetPods, batch.Pods[0].Name, "phase", "Running"},
+		{store.GetVmis, batch.Vmis[0].Name, "phase", "Running"},
+		{store.GetVms, batch.Vms[0].Name, "printableStatus", "Running"},
+	} {
+		opts := DefaultListOptions()
+		opts.Filters = map[string]string{"name": tc.name}
+		results, err := tc.get(opts)
+		if err != nil {
+			t.Fatalf("listing %s error = %v", tc.name, err)
+		}
+		data := results["data"].([]map[string]interface{})
+		if len(data) != 1 || data[0][tc.column] != tc.want {
+			t.Errorf("%s stored again = %v, want %s %s", tc.name, data, tc.column, tc.want)
+		}
+	}
+
+	pods, err := store.GetPods(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	vmis, err := store.GetVmis(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetVmis() error = %v", err)
+	}
+	if got := len(pods["data"].([]map[string]interface{})); got != benchmarkObjects {
+		t.Errorf("stored %d pods, want %d", got, benchmarkObjects)
+	}
+	if got := len(vmis["data"].([]map[string]interface{})); got != benchmarkObjects {
+		t.Errorf("stored %d vmis, want %d", got, benchmarkObjects)
+	}
+}
+
+// BenchmarkStoreBatch stores the pods and VMIs in a single transaction with
+// multi-row inserts.
+func BenchmarkStoreBatch(b *testing.B) {
+	batch := newBenchmarkBatch()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		store := newTestStore(b)
+		b.StartTimer()
+		if err := store.StoreBatch(batch); err != nil {
+			b.Fatalf("StoreBatch() error = %v", err)
+		}
+	}
+}
+
+// BenchmarkStorePerObject stores the same pods and VMIs one row at a time, as
+// the object store did before batches.
+func BenchmarkStorePerObject(b *testing.B) {
+	batch := newBenchmarkBatch()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		store := newTestStore(b)
+		b.StartTimer()
+		for _, pod := range batch.Pods {
+			if err := store.StorePod(pod); err != nil {
+				b.Fatalf("StorePod() error = %v", err)
+			}
+		}
+		for _, vmi := range batch.Vmis {
+			if err := store.StoreVmi(vmi); err != nil {
+				b.Fatalf("StoreVmi() error = %v", err)
+			}
+		}
+	}
+}
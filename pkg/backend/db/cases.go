@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"logsviewer/pkg/backend/log"
+)
+
+// DefaultCaseID scopes stores that were not given a case.
+const DefaultCaseID = "default"
+
+// LegacyCaseID owns the objects imported before cases existed.
+const LegacyCaseID = "legacy"
+
+// ErrCaseNotFound is returned when a case ID is unknown.
+var ErrCaseNotFound = errors.New("case not found")
+
+// Case is a single imported must-gather. Its objects are tagged with its ID.
+type Case struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Source       string    `json:"source"`
+	CreationTime time.Time `json:"creationTime"`
+}
+
+// caseTables lists the tables whose rows belong to a case.
+var caseTables = []string{"pods", "vmis", "vmimigrations", "vms", "nodes", "events", "dead_letters",
+	"datavolumes", "pvcs", "pvs", "storageclasses", "volumes", "components", "resources", "relations"}
+
+// legacyTables are the object tables created before rows were tagged with a
+// case.
+var legacyTables = []string{"pods", "vmis", "vmimigrations"}
+
+// renameLegacyTables moves object tables created before rows were tagged with
+// a case out of the way of the first schema migration, which re-creates them.
+// A later migration moves their rows into the legacy case.
+func (d *databaseInstance) renameLegacyTables() error {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+	for _, table := range legacyTables {
+		if _, err := d.db.ExecContext(ctx, "SELECT 1 FROM "+table+" LIMIT 1"); err != nil {
+			// nothing to keep
+			continue
+		}
+		if _, err := d.db.ExecContext(ctx, "SELECT caseId FROM "+table+" LIMIT 1"); err == nil {
+			continue
+		}
+		log.Log.Println("table ", table, " has no caseId column, keeping its rows as legacy_", table)
+		if err := d.execTable("ALTER TABLE " + table + " RENAME TO legacy_" + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *databaseInstance) CreateCase(c *Case) error {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx, "INSERT INTO cases(id, name, source, creationTime) values (?, ?, ?, ?)",
+		c.ID, c.Name, c.Source, c.CreationTime.UTC().Format(dbTimeLayout))
+	return err
+}
+
+// GetCases returns all cases, oldest first.
+func (d *databaseInstance) GetCases() ([]Case, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, "SELECT id, name, source, creationTime FROM cases ORDER BY creationTime ASC, id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cases := []Case{}
+	for rows.Next() {
+		var c Case
+		if err := rows.Scan(&c.ID, &c.Name, &c.Source, &c.CreationTime); err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	return cases, rows.Err()
+}
+
+func (d *databaseInstance) GetCase(id string) (*Case, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+	var c Case
+	row := d.db.QueryRowContext(ctx, "SELECT id, name, source, creationTime FROM cases WHERE id=?", id)
+	if err := row.Scan(&c.ID, &c.Name, &c.Source, &c.CreationTime); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrCaseNotFound, id)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteCase removes a case together with all of its objects.
+func (d *databaseInstance) DeleteCase(id string) error {
+	// one query timeout for each of the statements
+	ctx, cancel := context.WithTimeout(d.ctx, time.Duration(len(caseTables)+1)*d.queryTimeout)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range caseTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE caseId=?", id); err != nil {
+			return err
+		}
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM cases WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return fmt.Errorf("%w: %s", ErrCaseNotFound, id)
+	}
+	return tx.Commit()
+}
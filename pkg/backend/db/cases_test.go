@@ -0,0 +1,52 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCases(t *testing.T) {
+	store := newTestStore(t)
+	created := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"second", "first"} {
+		c := &Case{ID: id, Name: id + ".tar.gz", Source: "upload", CreationTime: created.Add(-time.Duration(i) * time.Hour)}
+		if err := store.CreateCase(c); err != nil {
+			t.Fatalf("CreateCase(%s) error = %v", id, err)
+		}
+		if err := store.ForCase(id).StorePod(testPod("virt-launcher-"+id, "default", created)); err != nil {
+			t.Fatalf("StorePod(%s) error = %v", id, err)
+		}
+	}
+
+	cases, err := store.GetCases()
+	if err != nil {
+		t.Fatalf("GetCases() error = %v", err)
+	}
+	if len(cases) != 2 || cases[0].ID != "first" || cases[1].ID != "second" {
+		t.Fatalf("GetCases() = %+v, want first and second, oldest first", cases)
+	}
+	if c, err := store.GetCase("second"); err != nil || c.Name != "second.tar.gz" || !c.CreationTime.Equal(created) {
+		t.Errorf("GetCase(second) = %+v, %v", c, err)
+	}
+
+	if err := store.DeleteCase("second"); err != nil {
+		t.Fatalf("DeleteCase(second) error = %v", err)
+	}
+	if _, err := store.GetCase("second"); !errors.Is(err, ErrCaseNotFound) {
+		t.Errorf("GetCase(second) after DeleteCase() error = %v, want ErrCaseNotFound", err)
+	}
+	if err := store.DeleteCase("second"); !errors.Is(err, ErrCaseNotFound) {
+		t.Errorf("DeleteCase(second) again error = %v, want ErrCaseNotFound", err)
+	}
+	// the objects of the deleted case are gone, the others are kept
+	for id, want := range map[string]int{"first": 1, "second": 0} {
+		pods, err := store.ForCase(id).GetPods(DefaultListOptions())
+		if err != nil {
+			t.Fatalf("GetPods(%s) error = %v", id, err)
+		}
+		if got := len(pods["data"].([]map[string]interface{})); got != want {
+			t.Errorf("case %s has %d pods, want %d", id, got, want)
+		}
+	}
+}
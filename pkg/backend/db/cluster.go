@@ -0,0 +1,147 @@
+package db
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// ClusterInfo describes the KubeVirt deployment of a case: the KubeVirt and
+// HyperConverged CRs, when collected, and the deployments and daemonsets of
+// the KubeVirt components.
+type ClusterInfo struct {
+	// KubeVirtVersion is the version the rest of the case is matched
+	// against, see Store.GetKubeVirtVersion.
+	KubeVirtVersion string                   `json:"kubeVirtVersion"`
+	KubeVirt        *KubeVirtInfo            `json:"kubevirt,omitempty"`
+	HyperConverged  *HyperConvergedInfo      `json:"hyperConverged,omitempty"`
+	Components      []map[string]interface{} `json:"components"`
+}
+
+// KubeVirtInfo is the status and configuration of the KubeVirt CR.
+type KubeVirtInfo struct {
+	Name            string   `json:"name"`
+	Namespace       string   `json:"namespace"`
+	Phase           string   `json:"phase"`
+	ObservedVersion string   `json:"observedVersion"`
+	TargetVersion   string   `json:"targetVersion"`
+	OperatorVersion string   `json:"operatorVersion"`
+	Registry        string   `json:"registry"`
+	ImageTag        string   `json:"imageTag,omitempty"`
+	FeatureGates    []string `json:"featureGates"`
+	// Migrations is the live migration configuration, empty when the
+	// defaults are used
+	Migrations *kubevirtv1.MigrationConfiguration `json:"migrations,omitempty"`
+}
+
+// HyperConvergedInfo is the status and configuration of the HyperConverged
+// CR, kept as the operator reports it.
+type HyperConvergedInfo struct {
+	Name                string          `json:"name"`
+	Namespace           string          `json:"namespace"`
+	Version             string          `json:"version"`
+	Versions            json.RawMessage `json:"versions,omitempty"`
+	FeatureGates        json.RawMessage `json:"featureGates,omitempty"`
+	LiveMigrationConfig json.RawMessage `json:"liveMigrationConfig,omitempty"`
+}
+
+const (
+	componentListQuery = "select uuid, kind, name, namespace, version, images, desiredReplicas, readyReplicas, creationTime from components where caseId=? AND kind in ('Deployment', 'DaemonSet') ORDER BY name ASC"
+	// componentVersionQuery prefers the version the KubeVirt CR observed
+	// over the ones its components were deployed with
+	componentVersionQuery = "select version from components where caseId=? AND kind<>'HyperConverged' AND version<>'' ORDER BY kind='KubeVirt' DESC, name ASC LIMIT 1"
+)
+
+// GetClusterInfo returns the KubeVirt deployment of the case.
+func (d *databaseInstance) GetClusterInfo() (*ClusterInfo, error) {
+	version, err := d.GetKubeVirtVersion()
+	if err != nil {
+		return nil, err
+	}
+	info := &ClusterInfo{KubeVirtVersion: version}
+
+	if info.KubeVirt, err = d.getKubeVirtInfo(); err != nil {
+		return nil, err
+	}
+	if info.HyperConverged, err = d.getHyperConvergedInfo(); err != nil {
+		return nil, err
+	}
+
+	if info.Components, err = d.queryRecords(componentListQuery, d.caseID); err != nil {
+		return nil, err
+	}
+	for _, component := range info.Components {
+		decodeRecordJSON(component, "images")
+	}
+	return info, nil
+}
+
+// getCR returns the version and content of the oldest CR of kind, nil when
+// none was collected.
+func (d *databaseInstance) getCR(kind string) (map[string]interface{}, error) {
+	return d.queryRecord("select version, content from components where caseId=? AND kind=? ORDER BY creationTime ASC LIMIT 1", d.caseID, kind)
+}
+
+func (d *databaseInstance) getKubeVirtInfo() (*KubeVirtInfo, error) {
+	record, err := d.getCR("KubeVirt")
+	if err != nil || record == nil {
+		return nil, err
+	}
+	kv := &kubevirtv1.KubeVirt{}
+	if err := json.Unmarshal([]byte(recordString(record, "content")), kv); err != nil {
+		return nil, err
+	}
+
+	info := &KubeVirtInfo{
+		Name:            kv.Name,
+		Namespace:       kv.Namespace,
+		Phase:           string(kv.Status.Phase),
+		ObservedVersion: kv.Status.ObservedKubeVirtVersion,
+		TargetVersion:   kv.Status.TargetKubeVirtVersion,
+		OperatorVersion: kv.Status.OperatorVersion,
+		Registry:        kv.Status.ObservedKubeVirtRegistry,
+		ImageTag:        kv.Spec.ImageTag,
+		FeatureGates:    []string{},
+		Migrations:      kv.Spec.Configuration.MigrationConfiguration,
+	}
+	if developerConfig := kv.Spec.Configuration.DeveloperConfiguration; developerConfig != nil {
+		info.FeatureGates = append(info.FeatureGates, developerConfig.FeatureGates...)
+	}
+	return info, nil
+}
+
+func (d *databaseInstance) getHyperConvergedInfo() (*HyperConvergedInfo, error) {
+	record, err := d.getCR("HyperConverged")
+	if err != nil || record == nil {
+		return nil, err
+	}
+	hco := &unstructured.Unstructured{}
+	if err := hco.UnmarshalJSON([]byte(recordString(record, "content"))); err != nil {
+		return nil, err
+	}
+
+	info := &HyperConvergedInfo{
+		Name:      hco.GetName(),
+		Namespace: hco.GetNamespace(),
+		Version:   recordString(record, "version"),
+	}
+	for _, field := range []struct {
+		value *json.RawMessage
+		path  []string
+	}{
+		{&info.Versions, []string{"status", "versions"}},
+		{&info.FeatureGates, []string{"spec", "featureGates"}},
+		{&info.LiveMigrationConfig, []string{"spec", "liveMigrationConfig"}},
+	} {
+		value, found, _ := unstructured.NestedFieldNoCopy(hco.Object, field.path...)
+		if !found {
+			continue
+		}
+		if *field.value, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
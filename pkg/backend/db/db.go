@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
-    "strconv"
 
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubevirtv1 "kubevirt.io/api/core/v1"
@@ -47,6 +46,54 @@ type (
 		Content json.RawMessage `json:"content"`
 	}
 
+	VirtualMachine struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UUID      string `json:"uuid"`
+        RunStrategy      string `json:"runStrategy"`
+        PrintableStatus  string `json:"printableStatus"`
+        Ready            bool `json:"ready"`
+        CreationTime     metav1.Time `json:"creationTime"`
+        Conditions       json.RawMessage `json:"conditions"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	Node struct {
+		Name      string `json:"name"`
+		UUID      string `json:"uuid"`
+        KubeletVersion   string `json:"kubeletVersion"`
+        Ready            bool `json:"ready"`
+        Schedulable      bool `json:"schedulable"`
+        // KVMAvailable is set when the node advertises the KubeVirt KVM device
+        KVMAvailable     bool `json:"kvmAvailable"`
+        CreationTime     metav1.Time `json:"creationTime"`
+        Labels           json.RawMessage `json:"labels"`
+        Taints           json.RawMessage `json:"taints"`
+        Allocatable      json.RawMessage `json:"allocatable"`
+        Capacity         json.RawMessage `json:"capacity"`
+        Conditions       json.RawMessage `json:"conditions"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	Event struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UUID      string `json:"uuid"`
+        // the object the event is about
+        InvolvedUID       string `json:"involvedUID"`
+        InvolvedKind      string `json:"involvedKind"`
+        InvolvedName      string `json:"involvedName"`
+        InvolvedNamespace string `json:"involvedNamespace"`
+        Reason         string `json:"reason"`
+        Type           string `json:"type"`
+        Message        string `json:"message"`
+        Source         string `json:"source"`
+        Count          int `json:"count"`
+        FirstTimestamp metav1.Time `json:"firstTimestamp"`
+        LastTimestamp  metav1.Time `json:"lastTimestamp"`
+		Content json.RawMessage `json:"content"`
+	}
+
 	VirtualMachineInstanceMigration struct {
 		Name      string `json:"name"`
 		Namespace string `json:"namespace"`
@@ -67,6 +114,121 @@ type (
 		Content json.RawMessage `json:"content"`
 	}
 
+	DataVolume struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UUID      string `json:"uuid"`
+        Phase            string `json:"phase"`
+        Progress         string `json:"progress"`
+        RestartCount     int `json:"restartCount"`
+        // SourceType is where the data comes from, e.g. http, registry, pvc or upload
+        SourceType       string `json:"sourceType"`
+        // ClaimName is the PVC the DataVolume populates
+        ClaimName        string `json:"claimName"`
+        StorageClass     string `json:"storageClass"`
+        CreationTime     metav1.Time `json:"creationTime"`
+        Conditions       json.RawMessage `json:"conditions"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	PersistentVolumeClaim struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UUID      string `json:"uuid"`
+        Phase            string `json:"phase"`
+        // VolumeName is the PV the claim is bound to
+        VolumeName       string `json:"volumeName"`
+        StorageClass     string `json:"storageClass"`
+        Capacity         string `json:"capacity"`
+        VolumeMode       string `json:"volumeMode"`
+        AccessModes      json.RawMessage `json:"accessModes"`
+        // ImportPod and UploadPod are the CDI pods populating the claim, as
+        // annotated by CDI
+        ImportPod        string `json:"importPod"`
+        UploadPod        string `json:"uploadPod"`
+        CreationTime     metav1.Time `json:"creationTime"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	PersistentVolume struct {
+		Name      string `json:"name"`
+		UUID      string `json:"uuid"`
+        Phase            string `json:"phase"`
+        StorageClass     string `json:"storageClass"`
+        Capacity         string `json:"capacity"`
+        ClaimNamespace   string `json:"claimNamespace"`
+        ClaimName        string `json:"claimName"`
+        // Driver is the CSI driver, or the in-tree volume plugin, backing the PV
+        Driver           string `json:"driver"`
+        VolumeHandle     string `json:"volumeHandle"`
+        CreationTime     metav1.Time `json:"creationTime"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	StorageClass struct {
+		Name      string `json:"name"`
+		UUID      string `json:"uuid"`
+        Provisioner          string `json:"provisioner"`
+        ReclaimPolicy        string `json:"reclaimPolicy"`
+        VolumeBindingMode    string `json:"volumeBindingMode"`
+        AllowVolumeExpansion bool `json:"allowVolumeExpansion"`
+        IsDefault            bool `json:"isDefault"`
+        Parameters           json.RawMessage `json:"parameters"`
+        CreationTime         metav1.Time `json:"creationTime"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	// Component is a KubeVirt or HyperConverged CR, or the deployment or
+	// daemonset of a KubeVirt component. Version is the version it reports,
+	// or was deployed with, and Images the images of its containers.
+	Component struct {
+        Kind      string `json:"kind"`
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UUID      string `json:"uuid"`
+        Version          string `json:"version"`
+        Images           json.RawMessage `json:"images"`
+        DesiredReplicas  int `json:"desiredReplicas"`
+        ReadyReplicas    int `json:"readyReplicas"`
+        CreationTime     metav1.Time `json:"creationTime"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	// Resource is an object of a kind read generically, see package
+	// resources. Kind is the name of the kind in the registry and Fields
+	// the columns extracted from the object.
+	Resource struct {
+        Kind      string `json:"kind"`
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UUID      string `json:"uuid"`
+        CreationTime     metav1.Time `json:"creationTime"`
+        Fields           json.RawMessage `json:"fields"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	// Volume is a volume of a VMI or VM backed by a PVC or a DataVolume,
+	// linking the VM objects to their storage.
+	Volume struct {
+        OwnerUID       string `json:"ownerUID"`
+        OwnerKind      string `json:"ownerKind"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+        ClaimName      string `json:"claimName"`
+        DataVolumeName string `json:"dataVolumeName,omitempty"`
+	}
+
+	// Relation links two objects of a case, e.g. an owner to the objects it
+	// owns or a VMI to its virt-launcher pods. Type is one of the relation*
+	// constants; the source of a relation need not have been collected.
+	Relation struct {
+        SourceUID  string `json:"source"`
+        SourceKind string `json:"sourceKind"`
+        TargetUID  string `json:"target"`
+        TargetKind string `json:"targetKind"`
+        Type       string `json:"type"`
+	}
+
 	QueryResults struct {
         Namespace   string
         SourcePodUUID     string
@@ -79,35 +241,34 @@ type (
         EndTimestamp time.Time
         SourceHandler string
         TargetHandler string
+        // Hops are the virt-launcher pods of a VMI, oldest first
+        Hops []QueryHop
+	}
+
+	// QueryHop is a node a VMI ran on: its virt-launcher pod there, the
+	// virt-handler of the node and the time the VMI spent on it. EndTimestamp
+	// is zero while the VMI still runs there.
+	QueryHop struct {
+        NodeName string
+        Pod string
+        PodUUID string
+        Handler string
+        StartTimestamp time.Time
+        EndTimestamp time.Time
 	}
 )
 
 func (d *databaseInstance) StorePod(pod *Pod) error {
-	// TimeString - given a time, return the MySQL standard string representation
-	madeAt := pod.CreationTime.Format("2006-01-02 15:04:05.999999")
-	ctx, cancel := context.WithTimeout(d.ctx, 1*time.Second)
+	ctx, cancel := d.queryContext()
 	defer cancel()
 
-	stmt, err := d.db.PrepareContext(ctx, insertPodQuery)
+	stmt, err := d.db.PrepareContext(ctx, d.insertPodQuery(1))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(
-        ctx,
-        pod.Key,
-        pod.Kind,
-        pod.Name,
-        pod.Namespace,
-        pod.UUID,
-        pod.Phase,
-        pod.ActiveContainers,
-        pod.TotalContainers,
-        pod.NodeName,
-        madeAt,
-        pod.Content,
-        pod.CreatedBy)
+	_, err = stmt.ExecContext(ctx, d.podRow(pod)...)
 	if err != nil {
 		return err
 	}
@@ -116,27 +277,16 @@ func (d *databaseInstance) StorePod(pod *Pod) error {
 } 
 
 func (d *databaseInstance) StoreVmi(vmi *VirtualMachineInstance) error {
-	// TimeString - given a time, return the MySQL standard string representation
-	madeAt := vmi.CreationTime.Format("2006-01-02 15:04:05.999999")
-	ctx, cancel := context.WithTimeout(d.ctx, 1*time.Second)
+	ctx, cancel := d.queryContext()
 	defer cancel()
 
-	stmt, err := d.db.PrepareContext(ctx, insertVmiQuery)
+	stmt, err := d.db.PrepareContext(ctx, d.insertVmiQuery(1))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(
-        ctx,
-        vmi.Name,
-        vmi.Namespace,
-        vmi.UUID,
-        vmi.Reason,
-        vmi.Phase,
-        vmi.NodeName,
-        madeAt,
-        vmi.Content)
+	_, err = stmt.ExecContext(ctx, d.vmiRow(vmi)...)
 	if err != nil {
 		return err
 	}
@@ -170,34 +320,71 @@ func (d *databaseInstance) StoreVmi(vmi *VirtualMachineInstance) error {
 	return nil
 } 
 
+func (d *databaseInstance) StoreVm(vm *VirtualMachine) error {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	stmt, err := d.db.PrepareContext(ctx, d.insertVmQuery(1))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, d.vmRow(vm)...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+} 
+
+func (d *databaseInstance) StoreNode(node *Node) error {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	stmt, err := d.db.PrepareContext(ctx, d.insertNodeQuery(1))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, d.nodeRow(node)...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+} 
+
+func (d *databaseInstance) StoreEvent(event *Event) error {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	stmt, err := d.db.PrepareContext(ctx, d.insertEventQuery(1))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, d.eventRow(event)...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+} 
+
 func (d *databaseInstance) StoreVmiMigration(vmim *VirtualMachineInstanceMigration) error {
-	// TimeString - given a time, return the MySQL standard string representation
-	madeAt := vmim.CreationTime.Format("2006-01-02 15:04:05.999999")
-	endedAt := vmim.EndTimestamp.Format("2006-01-02 15:04:05.999999")
-	ctx, cancel := context.WithTimeout(d.ctx, 1*time.Second)
+	ctx, cancel := d.queryContext()
 	defer cancel()
 
-	stmt, err := d.db.PrepareContext(ctx, insertVmiMigrationQuery)
+	stmt, err := d.db.PrepareContext(ctx, d.insertVmiMigrationQuery(1))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(
-        ctx,
-        vmim.Name,
-        vmim.Namespace,
-        vmim.UUID,
-        vmim.Phase,
-        vmim.VMIName,
-        vmim.TargetPod,
-        madeAt,
-        endedAt,
-        vmim.SourceNode,
-        vmim.TargetNode,
-        vmim.Completed,
-        vmim.Failed,
-        vmim.Content)
+	_, err = stmt.ExecContext(ctx, d.vmiMigrationRow(vmim)...)
 	if err != nil {
 		return err
 	}
@@ -206,18 +393,316 @@ func (d *databaseInstance) StoreVmiMigration(vmim *VirtualMachineInstanceMigrati
 } 
 
 var (
-	insertPodQuery       = `INSERT INTO pods(keyid, kind, name, namespace, uuid, phase, activeContainers, totalContainers, nodeName, creationTime, content, createdBy) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE keyid=VALUES(keyid);`
-	insertVmiQuery       = `INSERT INTO vmis(name, namespace, uuid, reason, phase, nodeName, creationTime, content) values (?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE uuid=VALUES(uuid);`
-	insertVmiMigrationQuery       = `INSERT INTO vmimigrations(name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed, content) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE uuid=VALUES(uuid), targetPod=VALUES(targetPod), creationTime=VALUES(creationTime), endTimestamp=VALUES(endTimestamp), sourceNode=VALUES(sourceNode), targetNode=VALUES(targetNode), completed=VALUES(completed), failed=VALUES(failed);`
+	podColumns          = []string{"caseId", "keyid", "kind", "name", "namespace", "uuid", "phase", "activeContainers", "totalContainers", "nodeName", "creationTime", "content", "createdBy"}
+	vmiColumns          = []string{"caseId", "name", "namespace", "uuid", "reason", "phase", "nodeName", "creationTime", "content"}
+	vmColumns           = []string{"caseId", "name", "namespace", "uuid", "runStrategy", "printableStatus", "ready", "creationTime", "conditions", "content"}
+	nodeColumns         = []string{"caseId", "name", "uuid", "kubeletVersion", "ready", "schedulable", "kvmAvailable", "creationTime", "labels", "taints", "allocatable", "capacity", "conditions", "content"}
+	eventColumns        = []string{"caseId", "name", "namespace", "uuid", "involvedUID", "involvedKind", "involvedName", "involvedNamespace", "reason", "type", "message", "source", "count", "firstTimestamp", "lastTimestamp", "content"}
+	vmiMigrationColumns = []string{"caseId", "name", "namespace", "uuid", "phase", "vmiName", "targetPod", "creationTime", "endTimestamp", "sourceNode", "targetNode", "completed", "failed", "content"}
+	dataVolumeColumns   = []string{"caseId", "name", "namespace", "uuid", "phase", "progress", "restartCount", "sourceType", "claimName", "storageClass", "creationTime", "conditions", "content"}
+	pvcColumns          = []string{"caseId", "name", "namespace", "uuid", "phase", "volumeName", "storageClass", "capacity", "volumeMode", "accessModes", "importPod", "uploadPod", "creationTime", "content"}
+	pvColumns           = []string{"caseId", "name", "uuid", "phase", "storageClass", "capacity", "claimNamespace", "claimName", "driver", "volumeHandle", "creationTime", "content"}
+	storageClassColumns = []string{"caseId", "name", "uuid", "provisioner", "reclaimPolicy", "volumeBindingMode", "allowVolumeExpansion", "isDefault", "parameters", "creationTime", "content"}
+	volumeColumns       = []string{"caseId", "ownerUID", "ownerKind", "namespace", "name", "claimName", "dataVolumeName"}
+	componentColumns    = []string{"caseId", "uuid", "kind", "name", "namespace", "version", "images", "desiredReplicas", "readyReplicas", "creationTime", "content"}
+	resourceColumns     = []string{"caseId", "kind", "uuid", "name", "namespace", "creationTime", "fields", "content"}
+	relationColumns     = []string{"caseId", "sourceUID", "sourceKind", "targetUID", "targetKind", "type"}
 )
 
-var (
-	defaultUsername = "mysql"
-	defaultPassword = "supersecret"
-	//defaultHost     = "mysql"
-	defaultHost     = "0.0.0.0"
-	defaultPort     = "3306"
-	defaultdbName   = "objtracker"
+func (d *databaseInstance) insertPodQuery(rows int) string {
+	return d.dialect.upsertQuery("pods", podColumns, []string{"caseId", "uuid"}, []string{"keyid"}, rows)
+}
+
+func (d *databaseInstance) insertVmiQuery(rows int) string {
+	return d.dialect.upsertQuery("vmis", vmiColumns, []string{"caseId", "uuid"}, []string{"uuid"}, rows)
+}
+
+func (d *databaseInstance) insertVmQuery(rows int) string {
+	return d.dialect.upsertQuery("vms", vmColumns, []string{"caseId", "uuid"},
+		[]string{"name", "namespace", "runStrategy", "printableStatus", "ready", "creationTime", "conditions", "content"}, rows)
+}
+
+func (d *databaseInstance) insertNodeQuery(rows int) string {
+	return d.dialect.upsertQuery("nodes", nodeColumns, []string{"caseId", "uuid"}, nodeColumns[3:], rows)
+}
+
+func (d *databaseInstance) insertEventQuery(rows int) string {
+	// events are looked up by the involved object, which leads the primary key
+	return d.dialect.upsertQuery("events", eventColumns, []string{"caseId", "involvedUID", "uuid"}, eventColumns[8:], rows)
+}
+
+func (d *databaseInstance) insertVmiMigrationQuery(rows int) string {
+	return d.dialect.upsertQuery("vmimigrations", vmiMigrationColumns, []string{"caseId", "uuid"},
+		[]string{"uuid", "targetPod", "creationTime", "endTimestamp", "sourceNode", "targetNode", "completed", "failed"}, rows)
+}
+
+func (d *databaseInstance) insertDataVolumeQuery(rows int) string {
+	return d.dialect.upsertQuery("datavolumes", dataVolumeColumns, []string{"caseId", "uuid"}, dataVolumeColumns[4:], rows)
+}
+
+func (d *databaseInstance) insertPVCQuery(rows int) string {
+	return d.dialect.upsertQuery("pvcs", pvcColumns, []string{"caseId", "uuid"}, pvcColumns[4:], rows)
+}
+
+func (d *databaseInstance) insertPVQuery(rows int) string {
+	return d.dialect.upsertQuery("pvs", pvColumns, []string{"caseId", "uuid"}, pvColumns[3:], rows)
+}
+
+func (d *databaseInstance) insertStorageClassQuery(rows int) string {
+	return d.dialect.upsertQuery("storageclasses", storageClassColumns, []string{"caseId", "uuid"}, storageClassColumns[3:], rows)
+}
+
+func (d *databaseInstance) insertVolumeQuery(rows int) string {
+	return d.dialect.upsertQuery("volumes", volumeColumns, []string{"caseId", "ownerUID", "name"}, volumeColumns[5:], rows)
+}
+
+func (d *databaseInstance) insertComponentQuery(rows int) string {
+	return d.dialect.upsertQuery("components", componentColumns, []string{"caseId", "uuid"}, componentColumns[2:], rows)
+}
+
+func (d *databaseInstance) insertResourceQuery(rows int) string {
+	return d.dialect.upsertQuery("resources", resourceColumns, []string{"caseId", "kind", "uuid"}, resourceColumns[3:], rows)
+}
+
+func (d *databaseInstance) insertRelationQuery(rows int) string {
+	return d.dialect.upsertQuery("relations", relationColumns, []string{"caseId", "sourceUID", "targetUID", "type"}, []string{"sourceKind", "targetKind"}, rows)
+}
+
+func (d *databaseInstance) podRow(pod *Pod) []interface{} {
+	return []interface{}{
+		d.caseID,
+		pod.Key,
+		pod.Kind,
+		pod.Name,
+		pod.Namespace,
+		pod.UUID,
+		pod.Phase,
+		pod.ActiveContainers,
+		pod.TotalContainers,
+		pod.NodeName,
+		pod.CreationTime.Format(dbTimeLayout),
+		pod.Content,
+		pod.CreatedBy,
+	}
+}
+
+func (d *databaseInstance) vmiRow(vmi *VirtualMachineInstance) []interface{} {
+	return []interface{}{
+		d.caseID,
+		vmi.Name,
+		vmi.Namespace,
+		vmi.UUID,
+		vmi.Reason,
+		vmi.Phase,
+		vmi.NodeName,
+		vmi.CreationTime.Format(dbTimeLayout),
+		vmi.Content,
+	}
+}
+
+func (d *databaseInstance) vmRow(vm *VirtualMachine) []interface{} {
+	return []interface{}{
+		d.caseID,
+		vm.Name,
+		vm.Namespace,
+		vm.UUID,
+		vm.RunStrategy,
+		vm.PrintableStatus,
+		vm.Ready,
+		vm.CreationTime.Format(dbTimeLayout),
+		vm.Conditions,
+		vm.Content,
+	}
+}
+
+func (d *databaseInstance) nodeRow(node *Node) []interface{} {
+	return []interface{}{
+		d.caseID,
+		node.Name,
+		node.UUID,
+		node.KubeletVersion,
+		node.Ready,
+		node.Schedulable,
+		node.KVMAvailable,
+		node.CreationTime.Format(dbTimeLayout),
+		node.Labels,
+		node.Taints,
+		node.Allocatable,
+		node.Capacity,
+		node.Conditions,
+		node.Content,
+	}
+}
+
+func (d *databaseInstance) eventRow(event *Event) []interface{} {
+	return []interface{}{
+		d.caseID,
+		event.Name,
+		event.Namespace,
+		event.UUID,
+		event.InvolvedUID,
+		event.InvolvedKind,
+		event.InvolvedName,
+		event.InvolvedNamespace,
+		event.Reason,
+		event.Type,
+		event.Message,
+		event.Source,
+		event.Count,
+		event.FirstTimestamp.Format(dbTimeLayout),
+		event.LastTimestamp.Format(dbTimeLayout),
+		event.Content,
+	}
+}
+
+func (d *databaseInstance) vmiMigrationRow(vmim *VirtualMachineInstanceMigration) []interface{} {
+	return []interface{}{
+		d.caseID,
+		vmim.Name,
+		vmim.Namespace,
+		vmim.UUID,
+		vmim.Phase,
+		vmim.VMIName,
+		vmim.TargetPod,
+		vmim.CreationTime.Format(dbTimeLayout),
+		vmim.EndTimestamp.Format(dbTimeLayout),
+		vmim.SourceNode,
+		vmim.TargetNode,
+		vmim.Completed,
+		vmim.Failed,
+		vmim.Content,
+	}
+}
+
+func (d *databaseInstance) dataVolumeRow(dv *DataVolume) []interface{} {
+	return []interface{}{
+		d.caseID,
+		dv.Name,
+		dv.Namespace,
+		dv.UUID,
+		dv.Phase,
+		dv.Progress,
+		dv.RestartCount,
+		dv.SourceType,
+		dv.ClaimName,
+		dv.StorageClass,
+		dv.CreationTime.Format(dbTimeLayout),
+		dv.Conditions,
+		dv.Content,
+	}
+}
+
+func (d *databaseInstance) pvcRow(pvc *PersistentVolumeClaim) []interface{} {
+	return []interface{}{
+		d.caseID,
+		pvc.Name,
+		pvc.Namespace,
+		pvc.UUID,
+		pvc.Phase,
+		pvc.VolumeName,
+		pvc.StorageClass,
+		pvc.Capacity,
+		pvc.VolumeMode,
+		pvc.AccessModes,
+		pvc.ImportPod,
+		pvc.UploadPod,
+		pvc.CreationTime.Format(dbTimeLayout),
+		pvc.Content,
+	}
+}
+
+func (d *databaseInstance) pvRow(pv *PersistentVolume) []interface{} {
+	return []interface{}{
+		d.caseID,
+		pv.Name,
+		pv.UUID,
+		pv.Phase,
+		pv.StorageClass,
+		pv.Capacity,
+		pv.ClaimNamespace,
+		pv.ClaimName,
+		pv.Driver,
+		pv.VolumeHandle,
+		pv.CreationTime.Format(dbTimeLayout),
+		pv.Content,
+	}
+}
+
+func (d *databaseInstance) storageClassRow(sc *StorageClass) []interface{} {
+	return []interface{}{
+		d.caseID,
+		sc.Name,
+		sc.UUID,
+		sc.Provisioner,
+		sc.ReclaimPolicy,
+		sc.VolumeBindingMode,
+		sc.AllowVolumeExpansion,
+		sc.IsDefault,
+		sc.Parameters,
+		sc.CreationTime.Format(dbTimeLayout),
+		sc.Content,
+	}
+}
+
+func (d *databaseInstance) volumeRow(volume *Volume) []interface{} {
+	return []interface{}{
+		d.caseID,
+		volume.OwnerUID,
+		volume.OwnerKind,
+		volume.Namespace,
+		volume.Name,
+		volume.ClaimName,
+		volume.DataVolumeName,
+	}
+}
+
+func (d *databaseInstance) componentRow(component *Component) []interface{} {
+	return []interface{}{
+		d.caseID,
+		component.UUID,
+		component.Kind,
+		component.Name,
+		component.Namespace,
+		component.Version,
+		component.Images,
+		component.DesiredReplicas,
+		component.ReadyReplicas,
+		component.CreationTime.Format(dbTimeLayout),
+		component.Content,
+	}
+}
+
+func (d *databaseInstance) resourceRow(resource *Resource) []interface{} {
+	return []interface{}{
+		d.caseID,
+		resource.Kind,
+		resource.UUID,
+		resource.Name,
+		resource.Namespace,
+		resource.CreationTime.Format(dbTimeLayout),
+		resource.Fields,
+		resource.Content,
+	}
+}
+
+func (d *databaseInstance) relationRow(relation *Relation) []interface{} {
+	return []interface{}{
+		d.caseID,
+		relation.SourceUID,
+		relation.SourceKind,
+		relation.TargetUID,
+		relation.TargetKind,
+		relation.Type,
+	}
+}
+
+const (
+	// dbTimeLayout is the MySQL DATETIME representation used for stored timestamps
+	dbTimeLayout = "2006-01-02 15:04:05.999999"
+
+	virtHandlerQuery       = "select name from pods where caseId=? AND nodeName=? AND name like ?"
+	virtHandlerNamePattern = "virt-handler%"
+	kubeVirtVersionLabel   = "app.kubernetes.io/version"
 )
 
 type databaseInstance struct {
@@ -226,27 +711,46 @@ type databaseInstance struct {
 	host     string
 	port     string
 	dbName   string
+	dsn      string
+	dialect  dialect
+	// caseID scopes every read and write to a single imported must-gather
+	caseID   string
 	db       *sql.DB
+	// ctx is the context of the request a view serves, see WithContext
 	ctx      context.Context
 	cancel   context.CancelFunc
+	// queryTimeout bounds every statement, see queryContext
+	queryTimeout time.Duration
+	// view is set on the stores returned by ForCase and WithContext, which
+	// share the pool of the store they were derived from
+	view     bool
 }
 
-func NewDatabaseInstance() (*databaseInstance, error) {
+func NewDatabaseInstance(cfg Config) (*databaseInstance, error) {
+	cfg = cfg.withDefaults()
 	dbInstance := &databaseInstance{
-		username: defaultUsername,
-		password: defaultPassword,
-		host:     defaultHost,
-		port:     defaultPort,
-		dbName:   defaultdbName,
+		username: cfg.Username,
+		password: cfg.Password,
+		host:     cfg.Host,
+		port:     cfg.Port,
+		dbName:   cfg.Name,
+		dialect:  mysqlDialect,
+		caseID:   DefaultCaseID,
+		queryTimeout: cfg.QueryTimeout.Duration,
 	}
+	dbInstance.dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbInstance.username, dbInstance.password, dbInstance.host, dbInstance.port, dbInstance.dbName)
 	ctx, cancel := context.WithCancel(context.Background())
 	dbInstance.ctx = ctx
 	dbInstance.cancel = cancel
 	err := dbInstance.connect()
 	if err != nil {
         log.Log.Println("failed to connect to db: ", err)
+		dbInstance.Shutdown()
 		return nil, err
 	}
+	dbInstance.db.SetMaxOpenConns(cfg.MaxOpenConns)
+	dbInstance.db.SetMaxIdleConns(cfg.MaxIdleConns)
+	dbInstance.db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration)
 
 	return dbInstance, nil
 }
@@ -256,7 +760,38 @@ type VMIMigrationQueryDetails struct {
     Namespace string
 }
 
+// ForCase returns a store that shares the connection pool but only sees the
+// rows of caseID. Only the store the pool was opened with closes it.
+func (d *databaseInstance) ForCase(caseID string) Store {
+	scoped := *d
+	scoped.caseID = caseID
+	scoped.view = true
+	return &scoped
+}
+
+// WithContext returns a store that shares the connection pool and runs its
+// statements under ctx, e.g. to stop them once the request is gone.
+func (d *databaseInstance) WithContext(ctx context.Context) Store {
+	scoped := *d
+	scoped.ctx = ctx
+	scoped.view = true
+	return &scoped
+}
+
+// queryContext bounds a statement by the query timeout of the store.
+func (d *databaseInstance) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(d.ctx, d.queryTimeout)
+}
+
+// newCaseQuery starts a select limited to the rows of the store's case.
+func (d *databaseInstance) newCaseQuery(base string) *selectQuery {
+	return newSelectQuery(base).Where("caseId=?", d.caseID)
+}
+
 func (d *databaseInstance) Shutdown() (err error) {
+	if d.view {
+		return nil
+	}
 	if d.cancel != nil {
 		d.cancel()
 	}
@@ -267,26 +802,19 @@ func (d *databaseInstance) Shutdown() (err error) {
 	return
 }
 
+// InitTables migrates the schema to the latest version.
 func (d *databaseInstance) InitTables() (err error) {
-	err = d.createTables()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return d.MigrateTo(LatestSchemaVersion())
 }
 
 func (d *databaseInstance) connect() (err error) {
-
-	uri := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", d.username, d.password, d.host, d.port, d.dbName)
-
-	db, err := sql.Open("mysql", uri)
+	db, err := sql.Open(d.dialect.driverName, d.dsn)
 	if err != nil {
 		return err
 	}
 
 	d.db = db
-	ctx, cancel := context.WithTimeout(d.ctx, 1*time.Second)
+	ctx, cancel := d.queryContext()
 	defer cancel()
 
 	err = d.db.PingContext(ctx)
@@ -296,101 +824,8 @@ func (d *databaseInstance) connect() (err error) {
 	return nil
 }
 
-func (d *databaseInstance) createTables() error {
-    if err := d.createPodsTable(); err != nil {
-		return err
-	}
-    if err := d.createVmisTable(); err != nil {
-		return err
-	}
-    if err := d.createVmiMigrationsTable(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (d *databaseInstance) createPodsTable() error {
-
-	createPodsTable := `
-	CREATE TABLE IF NOT EXISTS pods (
-	  keyid varchar(100),
-	  kind varchar(100),
-	  name varchar(100),
-	  namespace varchar(100),
-	  uuid varchar(100),
-      phase varchar(100),
-      activeContainers TINYINT,
-      totalContainers TINYINT,
-      nodeName varchar(100),
-      creationTime datetime,
-      content json,
-	  createdBy varchar(100),
-	  PRIMARY KEY (uuid)
-	);
-	`
-	err := d.execTable(createPodsTable)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (d *databaseInstance) createVmisTable() error {
-
-	vmisTableCreate := `
-	CREATE TABLE IF NOT EXISTS vmis (
-	  name varchar(100),
-	  namespace varchar(100),
-	  uuid varchar(100),
-      reason varchar(100),
-      phase varchar(100),
-      nodeName varchar(100),
-      creationTime datetime,
-      content json,
-	  createdBy varchar(100),
-	  PRIMARY KEY (uuid)
-	);
-	`
-	err := d.execTable(vmisTableCreate)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (d *databaseInstance) createVmiMigrationsTable() error {
-
-	vmimsTableCreate := `
-	CREATE TABLE IF NOT EXISTS vmimigrations (
-	  name varchar(100),
-	  namespace varchar(100),
-	  uuid varchar(100),
-      phase varchar(100),
-      vmiName varchar(100),
-      targetPod varchar(100),
-      creationTime datetime,
-      endTimestamp datetime,
-      sourceNode varchar(100),
-      targetNode varchar(100),
-      completed BOOLEAN,
-      failed BOOLEAN,
-      content json,
-	  PRIMARY KEY (uuid)
-	);
-	`
-	err := d.execTable(vmimsTableCreate)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-
 func (d *databaseInstance) execTable(tableSql string) error {
-	ctx, cancel := context.WithTimeout(d.ctx, 1*time.Second)
+	ctx, cancel := d.queryContext()
 	defer cancel()
 
 	stmt, err := d.db.PrepareContext(ctx, tableSql)
@@ -405,23 +840,19 @@ func (d *databaseInstance) execTable(tableSql string) error {
 	}
 	return nil
 }
+// DropTables reverts every schema migration, leaving an empty database.
 func (d *databaseInstance) DropTables() error {
-	dropPodsTable := `
-	DROP TABLE pods;
-	`
-	err := d.execTable(dropPodsTable)
-	if err != nil {
+	if err := d.MigrateTo(0); err != nil {
 		return err
 	}
-
-	return nil
+	return d.execTable("DROP TABLE IF EXISTS schema_version")
 }
 
-func (d *databaseInstance) getMeta(page int, perPage int, queryString string) (map[string]int, error) {  
-	ctx, cancel := context.WithTimeout(d.ctx, 1*time.Second)
+func (d *databaseInstance) getMeta(page int, perPage int, query *selectQuery) (map[string]int, error) {  
+	ctx, cancel := d.queryContext()
 	defer cancel()
 
-    stmt, err := d.db.PrepareContext(ctx, "select count(*) as totalRecords from (" + queryString + ") tmp")
+    stmt, err := d.db.PrepareContext(ctx, "select count(*) as totalRecords from (" + query.filtered() + ") tmp")
     if err != nil {
         return nil, err
     }
@@ -429,7 +860,7 @@ func (d *databaseInstance) getMeta(page int, perPage int, queryString string) (m
 
     totalRecords := 0
 
-    err = stmt.QueryRow().Scan(&totalRecords)
+    err = stmt.QueryRowContext(ctx, query.args...).Scan(&totalRecords)
     if err != nil {
         return nil, err
     }
@@ -462,6 +893,8 @@ func (d *databaseInstance) getMeta(page int, perPage int, queryString string) (m
 }
 
 func (d *databaseInstance) GetMigrationQueryParams(migrationUUID string) (QueryResults, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
     // looking for a source pod - pod runs on sourceNode createdBy vmiUUID before migration creationTime and after/equal vmi creation time
 
     results := QueryResults{}
@@ -479,23 +912,25 @@ func (d *databaseInstance) GetMigrationQueryParams(migrationUUID string) (QueryR
     if err != nil {
         return results, err
     }
-    timeLayout := "2006-01-02 15:04:05.999999"
-	vmiMadeAt := creationTime.Format(timeLayout)
-	migrationMadeAt := migration.CreationTime.Format(timeLayout)
-	migrationEndedAt := migration.EndTimestamp.Format(timeLayout)
+	vmiMadeAt := creationTime.Format(dbTimeLayout)
+	migrationMadeAt := migration.CreationTime.Format(dbTimeLayout)
+	migrationEndedAt := migration.EndTimestamp.Format(dbTimeLayout)
     
-	sourcePodQueryString := fmt.Sprintf("select uuid, name from pods where createdBy='%s' AND nodeName='%s' AND creationTime BETWEEN '%s' and '%s' ORDER BY creationTime ASC LIMIT 1", vmiUUID, migration.SourceNode, vmiMadeAt, migrationMadeAt)
-	virtHandlerQueryString := "select name from pods where nodeName='%s' AND name like 'virt-handler%%'"
-
-    results.StartTimestamp, _ = time.Parse(timeLayout, migrationMadeAt)
-    results.EndTimestamp, _ = time.Parse(timeLayout, migrationEndedAt)
+	sourcePodQuery := d.newCaseQuery("select uuid, name from pods").
+        Where("createdBy=?", vmiUUID).
+        Where("nodeName=?", migration.SourceNode).
+        Where("creationTime BETWEEN ? and ?", vmiMadeAt, migrationMadeAt).
+        Suffix("ORDER BY creationTime ASC LIMIT 1")
+
+    results.StartTimestamp, _ = time.Parse(dbTimeLayout, migrationMadeAt)
+    results.EndTimestamp, _ = time.Parse(dbTimeLayout, migrationEndedAt)
     results.TargetPod = migration.TargetPod
     results.TargetPodUUID = targetPodUUID
     results.MigrationUUID = migrationUUID
     results.VMIUUID = vmiUUID
 
     // get source virt-launcher info
-	rows := d.db.QueryRow(sourcePodQueryString) 
+	rows := d.db.QueryRowContext(ctx, sourcePodQuery.String(), sourcePodQuery.Args()...)
     err = rows.Scan(&results.SourcePodUUID, &results.SourcePod)
     if err != nil {
         if err == sql.ErrNoRows {
@@ -508,7 +943,7 @@ func (d *databaseInstance) GetMigrationQueryParams(migrationUUID string) (QueryR
     } 
     
     // get the source virt-handler
-	rows = d.db.QueryRow(fmt.Sprintf(virtHandlerQueryString, migration.SourceNode))
+	rows = d.db.QueryRowContext(ctx, virtHandlerQuery, d.caseID, migration.SourceNode, virtHandlerNamePattern)
     err = rows.Scan(&results.SourceHandler)
     if err != nil {
         if err == sql.ErrNoRows {
@@ -521,7 +956,7 @@ func (d *databaseInstance) GetMigrationQueryParams(migrationUUID string) (QueryR
     } 
 
     // get the target virt-handler
-	rows = d.db.QueryRow(fmt.Sprintf(virtHandlerQueryString, migration.TargetNode))
+	rows = d.db.QueryRowContext(ctx, virtHandlerQuery, d.caseID, migration.TargetNode, virtHandlerNamePattern)
     err = rows.Scan(&results.TargetHandler)
     if err != nil {
         if err == sql.ErrNoRows {
@@ -536,93 +971,358 @@ func (d *databaseInstance) GetMigrationQueryParams(migrationUUID string) (QueryR
 }
 
 
+// GetVMIQueryParams resolves every virt-launcher pod of a VMI, in creation
+// order, together with the virt-handler of the node it ran on. Each of them is
+// a hop, which lasts until the VMI migrated away from it. nodeName, when set,
+// limits the result to the launchers on that node. The Source fields describe
+// the first hop.
 func (d *databaseInstance) GetVMIQueryParams(vmiUUID string, nodeName string) (QueryResults, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
     results := QueryResults{VMIUUID: vmiUUID}
- 
-	sourcePodQueryString := fmt.Sprintf("select uuid, name, namespace, creationTime from pods where createdBy='%s' AND nodeName='%s'", vmiUUID, nodeName)
-	virtHandlerQueryString := fmt.Sprintf("select name from pods where nodeName='%s' AND name like 'virt-handler%%'", nodeName)
 
+    podQuery := d.newCaseQuery("select uuid, name, namespace, nodeName, creationTime from pods").
+        Where("createdBy=?", vmiUUID)
+    if nodeName != "" {
+        podQuery.Where("nodeName=?", nodeName)
+    }
+    podQuery.Suffix("ORDER BY creationTime ASC")
 
-    // get source virt-launcher info
-	rows := d.db.QueryRow(sourcePodQueryString) 
-    err := rows.Scan(&results.SourcePodUUID, &results.SourcePod, &results.Namespace, &results.StartTimestamp)
+    rows, err := d.db.QueryContext(ctx, podQuery.String(), podQuery.Args()...)
     if err != nil {
-        if err == sql.ErrNoRows {
-            log.Log.Println("getVMIQueryParams can't find anything with this uuid: ", vmiUUID)
-            return results, err
-        } else {
-            log.Log.Println("getVMIQueryParams ERROR: ", err, " for uuid: ", vmiUUID)
+        log.Log.Println("getVMIQueryParams ERROR: ", err, " for uuid: ", vmiUUID)
+        return results, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        hop := QueryHop{}
+        var creationTime interface{}
+        if err := rows.Scan(&hop.PodUUID, &hop.Pod, &results.Namespace, &hop.NodeName, &creationTime); err != nil {
             return results, err
         }
-    } 
-    
-    // get the relevant virt-handler
-	rows = d.db.QueryRow(virtHandlerQueryString) 
-    err = rows.Scan(&results.SourceHandler)
-    if err != nil {
+        hop.StartTimestamp = parseDBTime(creationTime)
+        results.Hops = append(results.Hops, hop)
+    }
+    if err := rows.Err(); err != nil {
+        return results, err
+    }
+    if len(results.Hops) == 0 {
+        log.Log.Println("getVMIQueryParams can't find anything with this uuid: ", vmiUUID)
+        return results, sql.ErrNoRows
+    }
+
+    if err := d.setVMIHopEnds(vmiUUID, results.Hops); err != nil {
+        return results, err
+    }
+
+    // get the relevant virt-handlers, a node without one still has its launcher logs
+    for i := range results.Hops {
+        hop := &results.Hops[i]
+        err = d.db.QueryRowContext(ctx, virtHandlerQuery, d.caseID, hop.NodeName, virtHandlerNamePattern).Scan(&hop.Handler)
         if err == sql.ErrNoRows {
-            log.Log.Println("getVMIQueryParams can't find virt-handler on node: ", nodeName)
-            return results, err
-        } else {
-            log.Log.Println("getVMIQueryParams ERROR: ", err, " for nodeName: ", nodeName)
+            log.Log.Println("getVMIQueryParams can't find virt-handler on node: ", hop.NodeName)
+        } else if err != nil {
+            log.Log.Println("getVMIQueryParams ERROR: ", err, " for nodeName: ", hop.NodeName)
             return results, err
         }
-    } 
+    }
 
-    return results, nil 
+    first := results.Hops[0]
+    results.SourcePod = first.Pod
+    results.SourcePodUUID = first.PodUUID
+    results.SourceHandler = first.Handler
+    results.StartTimestamp = first.StartTimestamp
+    results.EndTimestamp = results.Hops[len(results.Hops)-1].EndTimestamp
+
+    return results, nil
 }
 
-func (d *databaseInstance) GetPods(page int, perPage int) (map[string]interface{}, error) {
-	queryString := "select uuid, name, namespace, phase, activeContainers, totalContainers, creationTime, createdBy from pods"
-    resultsMap, err := d.genericGet(queryString, page, perPage)
+// setVMIHopEnds ends each hop with the migration that moved the VMI away from
+// it: the first completed migration off its node after the pod was created,
+// or, for the target of a failed migration, that migration itself. Hops the
+// VMI still runs on keep a zero EndTimestamp.
+func (d *databaseInstance) setVMIHopEnds(vmiUUID string, hops []QueryHop) error {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+    var name, namespace string
+    err := d.db.QueryRowContext(ctx, "select name, namespace from vmis where caseId=? AND uuid=?", d.caseID, vmiUUID).Scan(&name, &namespace)
+    if err == sql.ErrNoRows {
+        // the launchers outlived the VMI object, there is nothing to follow
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    migrations, err := d.queryRecords("select targetPod, sourceNode, creationTime, endTimestamp, completed, failed from vmimigrations where caseId=? AND vmiName=? AND namespace=? ORDER BY creationTime ASC", d.caseID, name, namespace)
+    if err != nil {
+        return err
+    }
+    for i := range hops {
+        hop := &hops[i]
+        for _, migration := range migrations {
+            end := parseDBTime(migration["endTimestamp"])
+            if end.IsZero() {
+                continue
+            }
+            if recordString(migration, "targetPod") == hop.Pod {
+                if recordBool(migration, "failed") {
+                    hop.EndTimestamp = end
+                    break
+                }
+                continue
+            }
+            if recordBool(migration, "completed") && recordString(migration, "sourceNode") == hop.NodeName &&
+                !parseDBTime(migration["creationTime"]).Before(hop.StartTimestamp) {
+                hop.EndTimestamp = end
+                break
+            }
+        }
+    }
+    return nil
+}
+
+// GetKubeVirtVersion returns the KubeVirt version of the case: the version
+// the KubeVirt CR observed, else the version its components were deployed
+// with, else the one the operator labels the virt-handler pods with. It is
+// empty when unknown.
+func (d *databaseInstance) GetKubeVirtVersion() (string, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+    var version string
+    err := d.db.QueryRowContext(ctx, componentVersionQuery, d.caseID).Scan(&version)
+    if err == nil {
+        return version, nil
+    }
+    if err != sql.ErrNoRows {
+        return "", err
+    }
+
+    var content []byte
+    err = d.db.QueryRowContext(ctx, "select content from pods where caseId=? AND name like ? LIMIT 1", d.caseID, virtHandlerNamePattern).Scan(&content)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    if err != nil {
+        return "", err
+    }
+    pod := metav1.PartialObjectMetadata{}
+    if err := json.Unmarshal(content, &pod); err != nil {
+        return "", err
+    }
+    return pod.Labels[kubeVirtVersionLabel], nil
+}
+
+func (d *databaseInstance) GetPods(opts ListOptions) (map[string]interface{}, error) {
+	query := d.newCaseQuery("select uuid, name, namespace, phase, activeContainers, totalContainers, creationTime, createdBy from pods")
+    resultsMap, err := d.genericGet(query, opts, podListSpec)
+	if err != nil {
+		return nil, err
+	}
+    return resultsMap, nil 
+}
+
+func (d *databaseInstance) GetVmis(opts ListOptions) (map[string]interface{}, error) {
+	query := d.newCaseQuery("select uuid, name, namespace, phase, reason, nodeName, creationTime from vmis")
+    resultsMap, err := d.genericGet(query, opts, vmiListSpec)
 	if err != nil {
 		return nil, err
 	}
     return resultsMap, nil 
 }
 
-func (d *databaseInstance) GetVmis(page int, perPage int) (map[string]interface{}, error) {
-	queryString := "select uuid, name, namespace, phase, reason, nodeName, creationTime from vmis"
-    resultsMap, err := d.genericGet(queryString, page, perPage)
+// GetVms lists the VMs together with the UUID of their current VMI, which
+// shares the name and namespace of the VM.
+func (d *databaseInstance) GetVms(opts ListOptions) (map[string]interface{}, error) {
+	query := d.newCaseQuery(`select uuid, name, namespace, runStrategy, printableStatus, ready, creationTime, conditions, vmiUUID from (
+        select vms.caseId, vms.uuid, vms.name, vms.namespace, vms.runStrategy, vms.printableStatus, vms.ready, vms.creationTime, vms.conditions, vmis.uuid as vmiUUID
+        from vms left join vmis on vmis.caseId=vms.caseId AND vmis.name=vms.name AND vmis.namespace=vms.namespace) vmsWithVmis`)
+    resultsMap, err := d.genericGet(query, opts, vmListSpec)
+	if err != nil {
+		return nil, err
+	}
+    decodeJSONColumns(resultsMap, "conditions")
+    return resultsMap, nil 
+}
+
+// decodeJSONColumns returns the given columns, stored as JSON, as JSON instead
+// of strings.
+func decodeJSONColumns(resultsMap map[string]interface{}, columns ...string) {
+    for _, record := range resultsMap["data"].([]map[string]interface{}) {
+        decodeRecordJSON(record, columns...)
+    }
+}
+
+const nodeListQuery = "select uuid, name, kubeletVersion, ready, schedulable, kvmAvailable, creationTime, labels, taints, allocatable, capacity, conditions from nodes"
+
+func (d *databaseInstance) GetNodes(opts ListOptions) (map[string]interface{}, error) {
+	query := d.newCaseQuery(nodeListQuery)
+    resultsMap, err := d.genericGet(query, opts, nodeListSpec)
 	if err != nil {
 		return nil, err
 	}
+    decodeJSONColumns(resultsMap, "labels", "taints", "allocatable", "capacity", "conditions")
     return resultsMap, nil 
 }
 
-func (d *databaseInstance) GetVmiMigrations(page int, perPage int, vmiDetails *VMIMigrationQueryDetails) (map[string]interface{}, error) {
+// GetNode returns a node together with the pods, VMIs and migrations that ran
+// on it.
+func (d *databaseInstance) GetNode(name string) (map[string]interface{}, error) {
+    opts := DefaultListOptions()
+    opts.Filters = map[string]string{"name": name}
+    nodes, err := d.GetNodes(opts)
+	if err != nil {
+		return nil, err
+	}
+    nodeRecords := nodes["data"].([]map[string]interface{})
+    if len(nodeRecords) == 0 {
+        return nil, fmt.Errorf("%w: node %s", ErrNotFound, name)
+    }
+
+    opts.Filters = map[string]string{"nodeName": name}
+    pods, err := d.GetPods(opts)
+	if err != nil {
+		return nil, err
+	}
+    vmis, err := d.GetVmis(opts)
+	if err != nil {
+		return nil, err
+	}
+	migrationsQuery := d.newCaseQuery("select name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed from vmimigrations").
+        Where("(sourceNode=? OR targetNode=?)", name, name)
+    vmims, err := d.genericGet(migrationsQuery, DefaultListOptions(), vmiMigrationListSpec)
+	if err != nil {
+		return nil, err
+	}
+
+    return map[string]interface{}{
+        "node":  nodeRecords[0],
+        "pods":  pods["data"],
+        "vmis":  vmis["data"],
+        "vmims": vmims["data"],
+    }, nil
+}
+
+const eventListQuery = "select uuid, name, namespace, involvedKind, involvedName, reason, type, message, source, count, firstTimestamp, lastTimestamp from events"
+
+// GetObjectEvents lists the events about the object with the given UID,
+// oldest first unless opts sort them otherwise. The "summary" aggregates the
+// matching events per reason and type.
+func (d *databaseInstance) GetObjectEvents(involvedUID string, opts ListOptions) (map[string]interface{}, error) {
+    if opts.SortBy == "" {
+        opts.SortBy = "firstTimestamp"
+    }
+
+	query := d.newCaseQuery(eventListQuery).Where("involvedUID=?", involvedUID)
+    resultsMap, err := d.genericGet(query, opts, eventListSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	summaryQuery := d.newCaseQuery("select reason, type, sum(count), min(firstTimestamp), max(lastTimestamp) from events").
+        Where("involvedUID=?", involvedUID)
+    if err := opts.applyFilters(summaryQuery, eventListSpec); err != nil {
+        return nil, err
+    }
+    summaryQuery.Suffix("GROUP BY reason, type ORDER BY min(firstTimestamp) ASC")
+    summary, err := d.getEventSummary(summaryQuery)
+	if err != nil {
+		return nil, err
+	}
+    resultsMap["summary"] = summary
+    return resultsMap, nil
+}
+
+// EventSummary aggregates the events of one reason and type.
+type EventSummary struct {
+    Reason         string    `json:"reason"`
+    Type           string    `json:"type"`
+    Count          int       `json:"count"`
+    FirstTimestamp time.Time `json:"firstTimestamp"`
+    LastTimestamp  time.Time `json:"lastTimestamp"`
+}
+
+func (d *databaseInstance) getEventSummary(query *selectQuery) ([]EventSummary, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, query.String(), query.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+    summary := []EventSummary{}
+    for rows.Next() {
+        var entry EventSummary
+        var count sql.NullInt64
+        var first, last interface{}
+        if err := rows.Scan(&entry.Reason, &entry.Type, &count, &first, &last); err != nil {
+            return nil, err
+        }
+        entry.Count = int(count.Int64)
+        entry.FirstTimestamp = parseDBTime(first)
+        entry.LastTimestamp = parseDBTime(last)
+        summary = append(summary, entry)
+    }
+    return summary, rows.Err()
+}
+
+// parseDBTime reads a timestamp computed by an aggregate, which drivers
+// return either as a time or as text.
+func parseDBTime(value interface{}) time.Time {
+    switch v := value.(type) {
+    case time.Time:
+        return v
+    case []byte:
+        return parseDBTime(string(v))
+    case string:
+        for _, layout := range []string{dbTimeLayout, time.RFC3339Nano} {
+            if t, err := time.Parse(layout, v); err == nil {
+                return t
+            }
+        }
+    }
+    return time.Time{}
+}
 
-	queryString := "select name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed from vmimigrations"
+func (d *databaseInstance) GetVmiMigrations(opts ListOptions, vmiDetails *VMIMigrationQueryDetails) (map[string]interface{}, error) {
+
+	query := d.newCaseQuery("select name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed from vmimigrations")
 
     if vmiDetails != nil && vmiDetails.Name != "" {
-        queryString = fmt.Sprintf("%s where vmiName='%s' AND namespace='%s'", queryString, vmiDetails.Name, vmiDetails.Namespace)
+        query.Where("vmiName=?", vmiDetails.Name).Where("namespace=?", vmiDetails.Namespace)
     }
-    log.Log.Println("queryString: ", queryString)
-    resultsMap, err := d.genericGet(queryString, page, perPage)
+    log.Log.Println("queryString: ", query.String())
+    resultsMap, err := d.genericGet(query, opts, vmiMigrationListSpec)
 	if err != nil {
 		return nil, err
 	}
     return resultsMap, nil 
 }
 
-func (d *databaseInstance) genericGet(queryString string, page int, perPage int) (map[string]interface{}, error) {
+func (d *databaseInstance) genericGet(query *selectQuery, opts ListOptions, spec listSpec) (map[string]interface{}, error) {
 	response := map[string]interface{}{}
-	ctx, cancel := context.WithTimeout(d.ctx, 1*time.Second)
+	ctx, cancel := d.queryContext()
 	defer cancel()
 
-	limit := " "
+    if err := opts.apply(query, spec); err != nil {
+        return response, err
+    }
+    page, perPage := opts.Page, opts.PerPage
+	pageQuery := *query
     if perPage != -1 {
-        limit = " limit " + strconv.Itoa((page - 1) * perPage) + ", " + strconv.Itoa(perPage)  
+        pageQuery.Suffix("limit ? offset ?", perPage, (page - 1) * perPage)
     }
 
-	stmt, err := d.db.PrepareContext(ctx, queryString + limit)
+	stmt, err := d.db.PrepareContext(ctx, pageQuery.String())
 	if err != nil {
 		return response, err
 	}
 	defer stmt.Close()
 
 
-	rows, err := stmt.Query() 
+	rows, err := stmt.QueryContext(ctx, pageQuery.Args()...)
 	if err != nil {
 		return response, err
 	}
@@ -663,7 +1363,7 @@ func (d *databaseInstance) genericGet(queryString string, page int, perPage int)
 
     } 
 
-	meta, err := d.getMeta(page, perPage, queryString)
+	meta, err := d.getMeta(page, perPage, query)
 	if err != nil {
 		return nil, err
 	}
@@ -673,10 +1373,11 @@ func (d *databaseInstance) genericGet(queryString string, page int, perPage int)
 }
 
 func (d *databaseInstance) getPodUUIDByName(name string, namespace string) (string, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
 
     var podUUID string
-    query := fmt.Sprintf("SELECT uuid from pods WHERE name='%s' AND namespace='%s'", name, namespace)
-	rows := d.db.QueryRow(query) 
+	rows := d.db.QueryRowContext(ctx, "SELECT uuid from pods WHERE caseId=? AND name=? AND namespace=?", d.caseID, name, namespace)
 
     err := rows.Scan(&podUUID)
     if err != nil {
@@ -693,11 +1394,12 @@ func (d *databaseInstance) getPodUUIDByName(name string, namespace string) (stri
 }
 
 func (d *databaseInstance) getVMICreationTimeByName(name string, namespace string) (string, time.Time, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
 
     var creationTime time.Time
     var vmiUUID string
-    query := fmt.Sprintf("SELECT uuid, creationTime from vmis WHERE name='%s' AND namespace='%s'", name, namespace)
-	rows := d.db.QueryRow(query) 
+	rows := d.db.QueryRowContext(ctx, "SELECT uuid, creationTime from vmis WHERE caseId=? AND name=? AND namespace=?", d.caseID, name, namespace)
 
     err := rows.Scan(&vmiUUID, &creationTime)
     if err != nil {
@@ -714,13 +1416,14 @@ func (d *databaseInstance) getVMICreationTimeByName(name string, namespace strin
 }
 
 func (d *databaseInstance) getSingleMigrationByUUID(uuid string) (*VirtualMachineInstanceMigration, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
 
     vmim := VirtualMachineInstanceMigration{}
     var startTime time.Time
     var endTime time.Time
      
-    query := fmt.Sprintf("SELECT name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed from vmimigrations WHERE uuid='%s'", uuid)
-	rows := d.db.QueryRow(query) 
+	rows := d.db.QueryRowContext(ctx, "SELECT name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed from vmimigrations WHERE caseId=? AND uuid=?", d.caseID, uuid) 
     var targetNode string
     err := rows.Scan(&vmim.Name, &vmim.Namespace, &vmim.UUID, &vmim.Phase, &vmim.VMIName, &vmim.TargetPod, 
                      &startTime, &endTime, &vmim.SourceNode, &targetNode, &vmim.Completed,
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newTestStore returns an empty in-memory SQLite store scoped to a case.
+func newTestStore(t testing.TB) Store {
+	t.Helper()
+	store, err := NewSQLiteInstance(Config{Driver: DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatalf("failed to open the sqlite store: %v", err)
+	}
+	t.Cleanup(func() { store.Shutdown() })
+	if err := store.InitTables(); err != nil {
+		t.Fatalf("failed to create the tables: %v", err)
+	}
+	return store.ForCase("case")
+}
+
+func testPod(name string, namespace string, created time.Time) *Pod {
+	return &Pod{
+		Key:          name + "/" + namespace,
+		Kind:         "Pod",
+		Name:         name,
+		Namespace:    namespace,
+		UUID:         "pod-" + name,
+		Phase:        "Running",
+		NodeName:     "node01",
+		CreationTime: metav1.NewTime(created),
+		Content:      []byte("{}"),
+		CreatedBy:    "vmi-" + name,
+	}
+}
+
+func TestStorePodRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+	created := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	pod := testPod("virt-launcher-vm1-abcde", "default", created)
+	pod.ActiveContainers = 2
+	pod.TotalContainers = 3
+	if err := store.StorePod(pod); err != nil {
+		t.Fatalf("StorePod() error = %v", err)
+	}
+	// storing a pod again keeps the row stored first
+	again := *pod
+	again.Phase = "Succeeded"
+	if err := store.StorePod(&again); err != nil {
+		t.Fatalf("StorePod() again error = %v", err)
+	}
+
+	pods, err := store.GetPods(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	data := pods["data"].([]map[string]interface{})
+	if len(data) != 1 {
+		t.Fatalf("GetPods() returned %d pods, want 1", len(data))
+	}
+	got := data[0]
+	for column, want := range map[string]string{
+		"uuid":      pod.UUID,
+		"name":      pod.Name,
+		"namespace": pod.Namespace,
+		"phase":     "Running",
+		"createdBy": pod.CreatedBy,
+	} {
+		if got[column] != want {
+			t.Errorf("GetPods()[%q] = %v, want %v", column, got[column], want)
+		}
+	}
+	if fmt.Sprint(got["activeContainers"]) != "2" || fmt.Sprint(got["totalContainers"]) != "3" {
+		t.Errorf("GetPods() containers = %v/%v, want 2/3", got["activeContainers"], got["totalContainers"])
+	}
+	if creationTime, _ := got["creationTime"].(time.Time); !creationTime.Equal(created) {
+		t.Errorf("GetPods() creationTime = %v, want %v", got["creationTime"], created)
+	}
+
+	// the pod belongs to its case only
+	other, err := store.ForCase("other").GetPods(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetPods() of another case error = %v", err)
+	}
+	if n := len(other["data"].([]map[string]interface{})); n != 0 {
+		t.Errorf("another case has %d pods, want none", n)
+	}
+}
+
+func TestStoreVmiRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+	created := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	vmi := &VirtualMachineInstance{
+		Name:         "vm1",
+		Namespace:    "default",
+		UUID:         "vmi-1",
+		Phase:        "Failed",
+		Reason:       "PodTerminating",
+		NodeName:     "node01",
+		CreationTime: metav1.NewTime(created),
+		Content:      []byte(`{"kind":"VirtualMachineInstance"}`),
+	}
+	if err := store.StoreVmi(vmi); err != nil {
+		t.Fatalf("StoreVmi() error = %v", err)
+	}
+
+	vmis, err := store.GetVmis(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetVmis() error = %v", err)
+	}
+	data := vmis["data"].([]map[string]interface{})
+	if len(data) != 1 {
+		t.Fatalf("GetVmis() returned %d vmis, want 1", len(data))
+	}
+	got := data[0]
+	for column, want := range map[string]string{
+		"uuid":      vmi.UUID,
+		"name":      vmi.Name,
+		"namespace": vmi.Namespace,
+		"phase":     vmi.Phase,
+		"reason":    vmi.Reason,
+		"nodeName":  vmi.NodeName,
+	} {
+		if got[column] != want {
+			t.Errorf("GetVmis()[%q] = %v, want %v", column, got[column], want)
+		}
+	}
+	if creationTime, _ := got["creationTime"].(time.Time); !creationTime.Equal(created) {
+		t.Errorf("GetVmis() creationTime = %v, want %v", got["creationTime"], created)
+	}
+}
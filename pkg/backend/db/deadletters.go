@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// DeadLetter is an object of an import that could not be stored, together
+// with the file it was read from and why it failed.
+type DeadLetter struct {
+	Kind         string    `json:"kind"`
+	Name         string    `json:"name,omitempty"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	Error        string    `json:"error"`
+	CreationTime time.Time `json:"creationTime"`
+}
+
+var deadLetterColumns = []string{"caseId", "id", "kind", "name", "namespace", "source", "message", "creationTime"}
+
+func insertDeadLetterQuery(rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(deadLetterColumns)), ", ") + ")"
+	return "INSERT INTO dead_letters(" + strings.Join(deadLetterColumns, ", ") + ") values " +
+		strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+}
+
+// StoreDeadLetters records the dead letters of an import in a single
+// transaction.
+func (d *databaseInstance) StoreDeadLetters(deadLetters []*DeadLetter) error {
+	if len(deadLetters) == 0 {
+		return nil
+	}
+	// one query timeout for every insert, and one for the commit
+	statements := 1 + (len(deadLetters)+batchRows-1)/batchRows
+	ctx, cancel := context.WithTimeout(d.ctx, time.Duration(statements)*d.queryTimeout)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(deadLetters); start += batchRows {
+		end := start + batchRows
+		if end > len(deadLetters) {
+			end = len(deadLetters)
+		}
+		var args []interface{}
+		for _, deadLetter := range deadLetters[start:end] {
+			args = append(args,
+				d.caseID,
+				string(uuid.NewUUID()),
+				deadLetter.Kind,
+				deadLetter.Name,
+				deadLetter.Namespace,
+				deadLetter.Source,
+				deadLetter.Error,
+				deadLetter.CreationTime.UTC().Format(dbTimeLayout),
+			)
+		}
+		if _, err := tx.ExecContext(ctx, insertDeadLetterQuery(end-start), args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDeadLetters returns the dead letters of the case, oldest first.
+func (d *databaseInstance) GetDeadLetters() ([]DeadLetter, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, "SELECT kind, name, namespace, source, message, creationTime FROM dead_letters WHERE caseId=? ORDER BY creationTime ASC, kind ASC, namespace ASC, name ASC", d.caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deadLetters := []DeadLetter{}
+	for rows.Next() {
+		var deadLetter DeadLetter
+		if err := rows.Scan(&deadLetter.Kind, &deadLetter.Name, &deadLetter.Namespace, &deadLetter.Source, &deadLetter.Error, &deadLetter.CreationTime); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	return deadLetters, rows.Err()
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dialect captures the few SQL differences between the supported drivers.
+type dialect struct {
+	driverName string
+	// upsertClause renders the conflict handling for an insert into a table
+	// keyed by keyColumns, refreshing updateColumns on conflict.
+	upsertClause func(keyColumns []string, updateColumns []string) string
+	// dropIndex renders the statement dropping an index of table.
+	dropIndex func(table string, index string) string
+	// jsonText renders the text of the top-level key of a JSON object
+	// column. key is formatted into the statement, it must be a plain
+	// identifier.
+	jsonText func(column string, key string) string
+}
+
+var (
+	mysqlDialect = dialect{
+		driverName: "mysql",
+		upsertClause: func(keyColumns []string, updateColumns []string) string {
+			sets := make([]string, 0, len(updateColumns))
+			for _, col := range updateColumns {
+				sets = append(sets, fmt.Sprintf("%s=VALUES(%s)", col, col))
+			}
+			return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+		},
+		dropIndex: func(table string, index string) string {
+			return fmt.Sprintf("DROP INDEX %s ON %s", index, table)
+		},
+		jsonText: func(column string, key string) string {
+			return fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, '$.%s'))", column, key)
+		},
+	}
+
+	sqliteDialect = dialect{
+		driverName: "sqlite",
+		upsertClause: func(keyColumns []string, updateColumns []string) string {
+			sets := make([]string, 0, len(updateColumns))
+			for _, col := range updateColumns {
+				sets = append(sets, fmt.Sprintf("%s=excluded.%s", col, col))
+			}
+			return fmt.Sprintf("ON CONFLICT(%s) DO UPDATE SET %s", strings.Join(keyColumns, ", "), strings.Join(sets, ", "))
+		},
+		// index names are unique per database in SQLite
+		dropIndex: func(table string, index string) string {
+			return "DROP INDEX " + index
+		},
+		jsonText: func(column string, key string) string {
+			return fmt.Sprintf("json_extract(%s, '$.%s')", column, key)
+		},
+	}
+)
+
+// upsertQuery builds an INSERT statement of rows rows, with one placeholder
+// per column.
+func (d dialect) upsertQuery(table string, columns []string, keyColumns []string, updateColumns []string, rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	return fmt.Sprintf("INSERT INTO %s(%s) values %s %s;",
+		table,
+		strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat(row+", ", rows), ", "),
+		d.upsertClause(keyColumns, updateColumns))
+}
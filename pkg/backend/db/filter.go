@@ -0,0 +1,296 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidListOption is returned when a list request refers to a column
+// that cannot be filtered or sorted on, or carries a malformed value.
+var ErrInvalidListOption = errors.New("invalid list option")
+
+// ListOptions describes paging, filtering, sorting and search for list endpoints.
+type ListOptions struct {
+	Page    int
+	PerPage int
+	// Filters holds exact-match conditions keyed by column name.
+	Filters map[string]string
+	// Search is a substring match on the object name. It is case-insensitive
+	// with the default collations of MySQL, and for ASCII letters in SQLite.
+	Search   string
+	SortBy   string
+	SortDesc bool
+	// CreatedAfter and CreatedBefore bound the creation time when non-zero.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// DefaultListOptions returns the first page with no page size limit.
+func DefaultListOptions() ListOptions {
+	return ListOptions{Page: 1, PerPage: -1}
+}
+
+type columnKind int
+
+const (
+	stringColumn columnKind = iota
+	boolColumn
+	timeColumn
+	intColumn
+)
+
+// listSpec whitelists the columns of a table that list requests may use.
+type listSpec struct {
+	columns      map[string]columnKind
+	searchColumn string
+	timeColumn   string
+	keyColumn    string
+}
+
+var (
+	podListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":             stringColumn,
+			"name":             stringColumn,
+			"namespace":        stringColumn,
+			"phase":            stringColumn,
+			"nodeName":         stringColumn,
+			"createdBy":        stringColumn,
+			"activeContainers": intColumn,
+			"totalContainers":  intColumn,
+			"creationTime":     timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	vmiListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":         stringColumn,
+			"name":         stringColumn,
+			"namespace":    stringColumn,
+			"phase":        stringColumn,
+			"reason":       stringColumn,
+			"nodeName":     stringColumn,
+			"creationTime": timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	vmListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":            stringColumn,
+			"name":            stringColumn,
+			"namespace":       stringColumn,
+			"runStrategy":     stringColumn,
+			"printableStatus": stringColumn,
+			"ready":           boolColumn,
+			"vmiUUID":         stringColumn,
+			"creationTime":    timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	nodeListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":           stringColumn,
+			"name":           stringColumn,
+			"kubeletVersion": stringColumn,
+			"ready":          boolColumn,
+			"schedulable":    boolColumn,
+			"kvmAvailable":   boolColumn,
+			"creationTime":   timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	eventListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":           stringColumn,
+			"name":           stringColumn,
+			"reason":         stringColumn,
+			"type":           stringColumn,
+			"source":         stringColumn,
+			"count":          intColumn,
+			"firstTimestamp": timeColumn,
+			"lastTimestamp":  timeColumn,
+		},
+		searchColumn: "message",
+		timeColumn:   "lastTimestamp",
+		keyColumn:    "uuid",
+	}
+
+	vmiMigrationListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":         stringColumn,
+			"name":         stringColumn,
+			"namespace":    stringColumn,
+			"phase":        stringColumn,
+			"vmiName":      stringColumn,
+			"targetPod":    stringColumn,
+			"sourceNode":   stringColumn,
+			"targetNode":   stringColumn,
+			"completed":    boolColumn,
+			"failed":       boolColumn,
+			"creationTime": timeColumn,
+			"endTimestamp": timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	dataVolumeListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":         stringColumn,
+			"name":         stringColumn,
+			"namespace":    stringColumn,
+			"phase":        stringColumn,
+			"progress":     stringColumn,
+			"restartCount": intColumn,
+			"sourceType":   stringColumn,
+			"claimName":    stringColumn,
+			"storageClass": stringColumn,
+			"creationTime": timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	pvcListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":         stringColumn,
+			"name":         stringColumn,
+			"namespace":    stringColumn,
+			"phase":        stringColumn,
+			"volumeName":   stringColumn,
+			"storageClass": stringColumn,
+			"capacity":     stringColumn,
+			"volumeMode":   stringColumn,
+			"importPod":    stringColumn,
+			"uploadPod":    stringColumn,
+			"creationTime": timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	pvListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":           stringColumn,
+			"name":           stringColumn,
+			"phase":          stringColumn,
+			"storageClass":   stringColumn,
+			"capacity":       stringColumn,
+			"claimNamespace": stringColumn,
+			"claimName":      stringColumn,
+			"driver":         stringColumn,
+			"volumeHandle":   stringColumn,
+			"creationTime":   timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+
+	storageClassListSpec = listSpec{
+		columns: map[string]columnKind{
+			"uuid":                 stringColumn,
+			"name":                 stringColumn,
+			"provisioner":          stringColumn,
+			"reclaimPolicy":        stringColumn,
+			"volumeBindingMode":    stringColumn,
+			"allowVolumeExpansion": boolColumn,
+			"isDefault":            boolColumn,
+			"creationTime":         timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+)
+
+// apply translates the options into placeholder-bound conditions on query,
+// and orders it. Column names are only ever taken from the spec, never from
+// the request.
+func (o ListOptions) apply(query *selectQuery, spec listSpec) error {
+	if err := o.applyFilters(query, spec); err != nil {
+		return err
+	}
+	// the key column keeps the order stable across pages
+	if o.SortBy == "" {
+		query.Suffix(fmt.Sprintf("ORDER BY %s ASC", spec.keyColumn))
+		return nil
+	}
+	if _, ok := spec.columns[o.SortBy]; !ok {
+		return fmt.Errorf("%w: cannot sort on %q", ErrInvalidListOption, o.SortBy)
+	}
+	direction := "ASC"
+	if o.SortDesc {
+		direction = "DESC"
+	}
+	query.Suffix(fmt.Sprintf("ORDER BY %s %s, %s ASC", o.SortBy, direction, spec.keyColumn))
+	return nil
+}
+
+// applyFilters adds the conditions of the options to query, leaving the
+// order to the caller, e.g. for an aggregate of the listed rows.
+func (o ListOptions) applyFilters(query *selectQuery, spec listSpec) error {
+	for column, value := range o.Filters {
+		kind, ok := spec.columns[column]
+		if !ok {
+			return fmt.Errorf("%w: cannot filter on %q", ErrInvalidListOption, column)
+		}
+		arg, err := filterValue(kind, value)
+		if err != nil {
+			return fmt.Errorf("%w: %s=%q: %v", ErrInvalidListOption, column, value, err)
+		}
+		query.Where(column+"=?", arg)
+	}
+
+	if o.Search != "" {
+		query.Where(spec.searchColumn+" LIKE ? ESCAPE '!'", "%"+escapeLike(o.Search)+"%")
+	}
+	if !o.CreatedAfter.IsZero() {
+		query.Where(spec.timeColumn+" >= ?", o.CreatedAfter.UTC().Format(dbTimeLayout))
+	}
+	if !o.CreatedBefore.IsZero() {
+		query.Where(spec.timeColumn+" <= ?", o.CreatedBefore.UTC().Format(dbTimeLayout))
+	}
+	return nil
+}
+
+func filterValue(kind columnKind, value string) (interface{}, error) {
+	switch kind {
+	case boolColumn:
+		return strconv.ParseBool(value)
+	case intColumn:
+		return strconv.Atoi(value)
+	case timeColumn:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, err
+		}
+		return t.UTC().Format(dbTimeLayout), nil
+	default:
+		return value, nil
+	}
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
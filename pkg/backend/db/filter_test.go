@@ -0,0 +1,157 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newListStore stores the migrations of vm1 to vm4, one hour apart, where only
+// the last one failed. They are stored out of order.
+func newListStore(t *testing.T) Store {
+	t.Helper()
+	store := newTestStore(t)
+	created := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"vm3", "vm1", "vm4", "vm2"} {
+		i := int(name[2] - '1')
+		if err := store.StoreVmiMigration(&VirtualMachineInstanceMigration{
+			Name:         "migration-" + name,
+			Namespace:    "default",
+			UUID:         "vmim-" + name,
+			Phase:        "Succeeded",
+			VMIName:      name,
+			CreationTime: metav1.NewTime(created.Add(time.Duration(i) * time.Hour)),
+			Completed:    true,
+			Failed:       name == "vm4",
+			Content:      []byte("{}"),
+		}); err != nil {
+			t.Fatalf("StoreVmiMigration(%q) error = %v", name, err)
+		}
+	}
+	return store
+}
+
+func orderedNames(t *testing.T, results map[string]interface{}) []string {
+	t.Helper()
+	names := []string{}
+	for _, record := range results["data"].([]map[string]interface{}) {
+		names = append(names, record["vmiName"].(string))
+	}
+	return names
+}
+
+func TestListOptions(t *testing.T) {
+	store := newListStore(t)
+	for _, tc := range []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{
+			name: "sort descending",
+			opts: ListOptions{Page: 1, PerPage: -1, SortBy: "creationTime", SortDesc: true},
+			want: []string{"vm4", "vm3", "vm2", "vm1"},
+		},
+		{
+			name: "second page",
+			opts: ListOptions{Page: 2, PerPage: 3, SortBy: "vmiName"},
+			want: []string{"vm4"},
+		},
+		{
+			// without a sort column the pages follow the key column
+			name: "first page without a sort",
+			opts: ListOptions{Page: 1, PerPage: 2},
+			want: []string{"vm1", "vm2"},
+		},
+		{
+			name: "second page without a sort",
+			opts: ListOptions{Page: 2, PerPage: 2},
+			want: []string{"vm3", "vm4"},
+		},
+		{
+			name: "bool filter",
+			opts: ListOptions{Page: 1, PerPage: -1, Filters: map[string]string{"failed": "true"}},
+			want: []string{"vm4"},
+		},
+		{
+			name: "creation time range",
+			opts: ListOptions{
+				Page:          1,
+				PerPage:       -1,
+				SortBy:        "vmiName",
+				CreatedAfter:  time.Date(2022, 10, 1, 13, 0, 0, 0, time.UTC),
+				CreatedBefore: time.Date(2022, 10, 1, 14, 0, 0, 0, time.UTC),
+			},
+			want: []string{"vm2", "vm3"},
+		},
+		{
+			name: "search",
+			opts: ListOptions{Page: 1, PerPage: -1, Search: "vm3"},
+			want: []string{"vm3"},
+		},
+		{
+			name: "search ignores the case",
+			opts: ListOptions{Page: 1, PerPage: -1, Search: "VM3"},
+			want: []string{"vm3"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			migrations, err := store.GetVmiMigrations(tc.opts, nil)
+			if err != nil {
+				t.Fatalf("GetVmiMigrations() error = %v", err)
+			}
+			got := orderedNames(t, migrations)
+			if len(got) != len(tc.want) {
+				t.Fatalf("GetVmiMigrations() = %q, want %q", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("GetVmiMigrations() = %q, want %q", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestListOptionsRejectMalformedValues(t *testing.T) {
+	store := newListStore(t)
+	for column, value := range map[string]string{
+		"failed":       "maybe",
+		"creationTime": "yesterday",
+	} {
+		opts := DefaultListOptions()
+		opts.Filters = map[string]string{column: value}
+		if _, err := store.GetVmiMigrations(opts, nil); !errors.Is(err, ErrInvalidListOption) {
+			t.Errorf("GetVmiMigrations(%s=%q) error = %v, want ErrInvalidListOption", column, value, err)
+		}
+	}
+}
+
+func TestListOptionsOrder(t *testing.T) {
+	for _, tc := range []struct {
+		opts ListOptions
+		want string
+	}{
+		{DefaultListOptions(), "select uuid from pods ORDER BY uuid ASC"},
+		{ListOptions{SortBy: "name", SortDesc: true}, "select uuid from pods ORDER BY name DESC, uuid ASC"},
+	} {
+		query := newSelectQuery("select uuid from pods")
+		if err := tc.opts.apply(query, podListSpec); err != nil {
+			t.Fatalf("apply(%+v) error = %v", tc.opts, err)
+		}
+		if got := query.String(); got != tc.want {
+			t.Errorf("apply(%+v) = %q, want %q", tc.opts, got, tc.want)
+		}
+	}
+
+	// aggregates of the listed rows are ordered by their caller
+	query := newSelectQuery("select count(*) from pods")
+	if err := DefaultListOptions().applyFilters(query, podListSpec); err != nil {
+		t.Fatalf("applyFilters() error = %v", err)
+	}
+	if got := query.String(); got != "select count(*) from pods" {
+		t.Errorf("applyFilters() = %q, want no order", got)
+	}
+}
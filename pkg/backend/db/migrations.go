@@ -0,0 +1,513 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"logsviewer/pkg/backend/log"
+)
+
+// schemaMigration is a numbered change to the schema. up applies it and down
+// reverts it, each returning the statements for the dialect of the store.
+type schemaMigration struct {
+	version     int
+	description string
+	up          func(d dialect) []string
+	down        func(d dialect) []string
+}
+
+// schemaMigrations are applied in order and recorded in the schema_version
+// table. Once released a migration must not change; add a new one instead.
+var schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "create the case and object tables",
+		// IF NOT EXISTS adopts the tables of databases created before
+		// migrations were tracked
+		up: func(d dialect) []string {
+			return []string{`
+	CREATE TABLE IF NOT EXISTS pods (
+	  caseId varchar(100),
+	  keyid varchar(100),
+	  kind varchar(100),
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  activeContainers TINYINT,
+	  totalContainers TINYINT,
+	  nodeName varchar(100),
+	  creationTime datetime,
+	  content json,
+	  createdBy varchar(100),
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS vmis (
+	  caseId varchar(100),
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  reason varchar(100),
+	  phase varchar(100),
+	  nodeName varchar(100),
+	  creationTime datetime,
+	  content json,
+	  createdBy varchar(100),
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS vmimigrations (
+	  caseId varchar(100),
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  vmiName varchar(100),
+	  targetPod varchar(100),
+	  creationTime datetime,
+	  endTimestamp datetime,
+	  sourceNode varchar(100),
+	  targetNode varchar(100),
+	  completed BOOLEAN,
+	  failed BOOLEAN,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS vms (
+	  caseId varchar(100),
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  runStrategy varchar(100),
+	  printableStatus varchar(100),
+	  ready BOOLEAN,
+	  creationTime datetime,
+	  conditions json,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS nodes (
+	  caseId varchar(100),
+	  name varchar(100),
+	  uuid varchar(100),
+	  kubeletVersion varchar(100),
+	  ready BOOLEAN,
+	  schedulable BOOLEAN,
+	  kvmAvailable BOOLEAN,
+	  creationTime datetime,
+	  labels json,
+	  taints json,
+	  allocatable json,
+	  capacity json,
+	  conditions json,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS events (
+	  caseId varchar(100),
+	  name varchar(255),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  involvedUID varchar(100),
+	  involvedKind varchar(100),
+	  involvedName varchar(255),
+	  involvedNamespace varchar(100),
+	  reason varchar(100),
+	  type varchar(100),
+	  message text,
+	  source varchar(255),
+	  count int,
+	  firstTimestamp datetime,
+	  lastTimestamp datetime,
+	  content json,
+	  PRIMARY KEY (caseId, involvedUID, uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS cases (
+	  id varchar(100),
+	  name varchar(255),
+	  source varchar(255),
+	  creationTime datetime,
+	  PRIMARY KEY (id)
+	);`,
+			}
+		},
+		down: func(d dialect) []string {
+			return []string{
+				"DROP TABLE IF EXISTS cases",
+				"DROP TABLE IF EXISTS events",
+				"DROP TABLE IF EXISTS nodes",
+				"DROP TABLE IF EXISTS vms",
+				"DROP TABLE IF EXISTS vmimigrations",
+				"DROP TABLE IF EXISTS vmis",
+				"DROP TABLE IF EXISTS pods",
+			}
+		},
+	},
+	{
+		version:     2,
+		description: "index the launcher, handler and migration lookups",
+		up: func(d dialect) []string {
+			return []string{
+				"CREATE INDEX pods_created_by ON pods (caseId, createdBy)",
+				"CREATE INDEX pods_node_name ON pods (caseId, nodeName)",
+				"CREATE INDEX vmimigrations_vmi ON vmimigrations (caseId, namespace, vmiName)",
+			}
+		},
+		down: func(d dialect) []string {
+			return []string{
+				d.dropIndex("vmimigrations", "vmimigrations_vmi"),
+				d.dropIndex("pods", "pods_node_name"),
+				d.dropIndex("pods", "pods_created_by"),
+			}
+		},
+	},
+	{
+		version:     3,
+		description: "record the objects an import failed to store",
+		up: func(d dialect) []string {
+			return []string{`
+	CREATE TABLE dead_letters (
+	  caseId varchar(100),
+	  id varchar(100),
+	  kind varchar(100),
+	  name varchar(255),
+	  namespace varchar(100),
+	  source varchar(255),
+	  message text,
+	  creationTime datetime,
+	  PRIMARY KEY (caseId, id)
+	);`,
+			}
+		},
+		down: func(d dialect) []string {
+			return []string{"DROP TABLE IF EXISTS dead_letters"}
+		},
+	},
+	{
+		version:     4,
+		description: "create the storage tables",
+		up: func(d dialect) []string {
+			return []string{`
+	CREATE TABLE datavolumes (
+	  caseId varchar(100),
+	  name varchar(255),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  progress varchar(100),
+	  restartCount int,
+	  sourceType varchar(100),
+	  claimName varchar(255),
+	  storageClass varchar(255),
+	  creationTime datetime,
+	  conditions json,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE pvcs (
+	  caseId varchar(100),
+	  name varchar(255),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  volumeName varchar(255),
+	  storageClass varchar(255),
+	  capacity varchar(100),
+	  volumeMode varchar(100),
+	  accessModes json,
+	  importPod varchar(255),
+	  uploadPod varchar(255),
+	  creationTime datetime,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE pvs (
+	  caseId varchar(100),
+	  name varchar(255),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  storageClass varchar(255),
+	  capacity varchar(100),
+	  claimNamespace varchar(100),
+	  claimName varchar(255),
+	  driver varchar(255),
+	  volumeHandle varchar(255),
+	  creationTime datetime,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE storageclasses (
+	  caseId varchar(100),
+	  name varchar(255),
+	  uuid varchar(100),
+	  provisioner varchar(255),
+	  reclaimPolicy varchar(100),
+	  volumeBindingMode varchar(100),
+	  allowVolumeExpansion BOOLEAN,
+	  isDefault BOOLEAN,
+	  parameters json,
+	  creationTime datetime,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`, `
+	CREATE TABLE volumes (
+	  caseId varchar(100),
+	  ownerUID varchar(100),
+	  ownerKind varchar(100),
+	  namespace varchar(100),
+	  name varchar(255),
+	  claimName varchar(255),
+	  dataVolumeName varchar(255),
+	  PRIMARY KEY (caseId, ownerUID, name)
+	);`,
+				"CREATE INDEX pvcs_name ON pvcs (caseId, namespace, name)",
+				"CREATE INDEX volumes_claim ON volumes (caseId, namespace, claimName)",
+			}
+		},
+		down: func(d dialect) []string {
+			return []string{
+				"DROP TABLE IF EXISTS volumes",
+				"DROP TABLE IF EXISTS storageclasses",
+				"DROP TABLE IF EXISTS pvs",
+				"DROP TABLE IF EXISTS pvcs",
+				"DROP TABLE IF EXISTS datavolumes",
+			}
+		},
+	},
+	{
+		version:     5,
+		description: "create the cluster components table",
+		up: func(d dialect) []string {
+			return []string{`
+	CREATE TABLE components (
+	  caseId varchar(100),
+	  uuid varchar(100),
+	  kind varchar(100),
+	  name varchar(255),
+	  namespace varchar(100),
+	  version varchar(100),
+	  images json,
+	  desiredReplicas int,
+	  readyReplicas int,
+	  creationTime datetime,
+	  content json,
+	  PRIMARY KEY (caseId, uuid)
+	);`,
+			}
+		},
+		down: func(d dialect) []string {
+			return []string{"DROP TABLE IF EXISTS components"}
+		},
+	},
+	{
+		version:     6,
+		description: "create the generic resources table",
+		up: func(d dialect) []string {
+			return []string{`
+	CREATE TABLE resources (
+	  caseId varchar(100),
+	  kind varchar(100),
+	  uuid varchar(100),
+	  name varchar(255),
+	  namespace varchar(100),
+	  creationTime datetime,
+	  fields json,
+	  content json,
+	  PRIMARY KEY (caseId, kind, uuid)
+	);`,
+			}
+		},
+		down: func(d dialect) []string {
+			return []string{"DROP TABLE IF EXISTS resources"}
+		},
+	},
+	{
+		version:     7,
+		description: "create the object relations table",
+		up: func(d dialect) []string {
+			return []string{`
+	CREATE TABLE relations (
+	  caseId varchar(100),
+	  sourceUID varchar(100),
+	  sourceKind varchar(100),
+	  targetUID varchar(100),
+	  targetKind varchar(100),
+	  type varchar(100),
+	  PRIMARY KEY (caseId, sourceUID, targetUID, type)
+	);`,
+				"CREATE INDEX relations_target ON relations (caseId, targetUID)",
+			}
+		},
+		down: func(d dialect) []string {
+			return []string{"DROP TABLE IF EXISTS relations"}
+		},
+	},
+	{
+		version:     8,
+		description: "move the objects imported before cases into the legacy case",
+		// renameLegacyTables kept them as legacy_<table>; the tables are
+		// created empty for databases that never had them
+		up: func(d dialect) []string {
+			return []string{`
+	CREATE TABLE IF NOT EXISTS legacy_pods (
+	  keyid varchar(100),
+	  kind varchar(100),
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  activeContainers TINYINT,
+	  totalContainers TINYINT,
+	  nodeName varchar(100),
+	  creationTime datetime,
+	  content json,
+	  createdBy varchar(100),
+	  PRIMARY KEY (uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS legacy_vmis (
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  reason varchar(100),
+	  phase varchar(100),
+	  nodeName varchar(100),
+	  creationTime datetime,
+	  content json,
+	  createdBy varchar(100),
+	  PRIMARY KEY (uuid)
+	);`, `
+	CREATE TABLE IF NOT EXISTS legacy_vmimigrations (
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  vmiName varchar(100),
+	  targetPod varchar(100),
+	  creationTime datetime,
+	  endTimestamp datetime,
+	  sourceNode varchar(100),
+	  targetNode varchar(100),
+	  completed BOOLEAN,
+	  failed BOOLEAN,
+	  content json,
+	  PRIMARY KEY (uuid)
+	);`,
+				`INSERT INTO pods (caseId, keyid, kind, name, namespace, uuid, phase, activeContainers, totalContainers, nodeName, creationTime, content, createdBy)
+	SELECT '` + LegacyCaseID + `', keyid, kind, name, namespace, uuid, phase, activeContainers, totalContainers, nodeName, creationTime, content, createdBy FROM legacy_pods`,
+				`INSERT INTO vmis (caseId, name, namespace, uuid, reason, phase, nodeName, creationTime, content, createdBy)
+	SELECT '` + LegacyCaseID + `', name, namespace, uuid, reason, phase, nodeName, creationTime, content, createdBy FROM legacy_vmis`,
+				`INSERT INTO vmimigrations (caseId, name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed, content)
+	SELECT '` + LegacyCaseID + `', name, namespace, uuid, phase, vmiName, targetPod, creationTime, endTimestamp, sourceNode, targetNode, completed, failed, content FROM legacy_vmimigrations`,
+				// the case only exists when there were objects to move
+				`INSERT INTO cases (id, name, source, creationTime)
+	SELECT DISTINCT '` + LegacyCaseID + `', 'imported before cases', '', CURRENT_TIMESTAMP FROM (
+	  SELECT uuid FROM legacy_pods UNION ALL SELECT uuid FROM legacy_vmis UNION ALL SELECT uuid FROM legacy_vmimigrations
+	) legacy_objects`,
+				"DROP TABLE legacy_vmimigrations",
+				"DROP TABLE legacy_vmis",
+				"DROP TABLE legacy_pods",
+			}
+		},
+		// the moved objects stay in the legacy case, deleting it removes them
+		down: func(d dialect) []string {
+			return nil
+		},
+	},
+}
+
+const schemaVersionTableCreate = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+	  version int,
+	  description varchar(255),
+	  appliedAt datetime,
+	  PRIMARY KEY (version)
+	);
+	`
+
+// LatestSchemaVersion is the version InitTables migrates to.
+func LatestSchemaVersion() int {
+	return schemaMigrations[len(schemaMigrations)-1].version
+}
+
+// SchemaVersion returns the version of the last applied migration, 0 for an
+// empty database.
+func (d *databaseInstance) SchemaVersion() (int, error) {
+	if err := d.execTable(schemaVersionTableCreate); err != nil {
+		return 0, err
+	}
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	var version sql.NullInt64
+	if err := d.db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// MigrateTo applies, or reverts, the migrations between the current version
+// of the schema and version, one at a time.
+func (d *databaseInstance) MigrateTo(version int) error {
+	if version < 0 || version > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d, the latest is %d", version, LatestSchemaVersion())
+	}
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("the database schema version %d is newer than the latest known version %d", current, LatestSchemaVersion())
+	}
+	if current == 0 && version > 0 {
+		if err := d.renameLegacyTables(); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range schemaMigrations {
+		if m.version <= current || m.version > version {
+			continue
+		}
+		log.Log.Println("applying schema migration ", m.version, ": ", m.description)
+		if err := d.runMigration(m.up(d.dialect), "INSERT INTO schema_version(version, description, appliedAt) values (?, ?, ?)",
+			m.version, m.description, time.Now().UTC().Format(dbTimeLayout)); err != nil {
+			return fmt.Errorf("schema migration %d failed: %v", m.version, err)
+		}
+	}
+	for i := len(schemaMigrations) - 1; i >= 0; i-- {
+		m := schemaMigrations[i]
+		if m.version > current || m.version <= version {
+			continue
+		}
+		log.Log.Println("reverting schema migration ", m.version, ": ", m.description)
+		if err := d.runMigration(m.down(d.dialect), "DELETE FROM schema_version WHERE version=?", m.version); err != nil {
+			return fmt.Errorf("reverting schema migration %d failed: %v", m.version, err)
+		}
+	}
+	return nil
+}
+
+// runMigration runs the statements of a migration and records it in a single
+// transaction. MySQL commits each schema change on its own, so a failed
+// migration there may have to be completed by hand.
+func (d *databaseInstance) runMigration(statements []string, record string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(d.ctx, time.Duration(len(statements)+1)*d.queryTimeout)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
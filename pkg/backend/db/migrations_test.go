@@ -0,0 +1,184 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// legacySchema is the schema of the object tables before cases existed, with
+// a row in each.
+var legacySchema = []string{`
+	CREATE TABLE pods (
+	  keyid varchar(100),
+	  kind varchar(100),
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  activeContainers TINYINT,
+	  totalContainers TINYINT,
+	  nodeName varchar(100),
+	  creationTime datetime,
+	  content json,
+	  createdBy varchar(100),
+	  PRIMARY KEY (uuid)
+	);`, `
+	CREATE TABLE vmis (
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  reason varchar(100),
+	  phase varchar(100),
+	  nodeName varchar(100),
+	  creationTime datetime,
+	  content json,
+	  createdBy varchar(100),
+	  PRIMARY KEY (uuid)
+	);`, `
+	CREATE TABLE vmimigrations (
+	  name varchar(100),
+	  namespace varchar(100),
+	  uuid varchar(100),
+	  phase varchar(100),
+	  vmiName varchar(100),
+	  targetPod varchar(100),
+	  creationTime datetime,
+	  endTimestamp datetime,
+	  sourceNode varchar(100),
+	  targetNode varchar(100),
+	  completed BOOLEAN,
+	  failed BOOLEAN,
+	  content json,
+	  PRIMARY KEY (uuid)
+	);`,
+	`INSERT INTO pods VALUES ('virt-launcher-vm1/default', 'Pod', 'virt-launcher-vm1', 'default', 'pod-1', 'Running', 1, 1, 'node01', '2022-10-01 12:00:00', '{}', 'vmi-1')`,
+	`INSERT INTO vmis VALUES ('vm1', 'default', 'vmi-1', '', 'Running', 'node01', '2022-10-01 12:00:00', '{}', '')`,
+	`INSERT INTO vmimigrations VALUES ('migration1', 'default', 'vmim-1', 'Succeeded', 'vm1', 'virt-launcher-vm1', '2022-10-01 13:00:00', '2022-10-01 13:01:00', 'node01', 'node02', 1, 0, '{}')`,
+}
+
+func newSQLiteInstance(t *testing.T) *databaseInstance {
+	t.Helper()
+	store, err := NewSQLiteInstance(Config{Driver: DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatalf("failed to open the sqlite store: %v", err)
+	}
+	t.Cleanup(func() { store.Shutdown() })
+	return store
+}
+
+func countRows(t *testing.T, results map[string]interface{}, err error) int {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(results["data"].([]map[string]interface{}))
+}
+
+func TestMigrateMovesLegacyObjectsIntoTheLegacyCase(t *testing.T) {
+	store := newSQLiteInstance(t)
+	for _, statement := range legacySchema {
+		if err := store.execTable(statement); err != nil {
+			t.Fatalf("failed to create the legacy schema: %v", err)
+		}
+	}
+	if err := store.InitTables(); err != nil {
+		t.Fatalf("InitTables() error = %v", err)
+	}
+
+	legacy, err := store.GetCase(LegacyCaseID)
+	if err != nil {
+		t.Fatalf("GetCase(legacy) error = %v", err)
+	}
+	if legacy.CreationTime.IsZero() {
+		t.Errorf("the legacy case has no creation time")
+	}
+	legacyStore := store.ForCase(LegacyCaseID)
+	pods, err := legacyStore.GetPods(DefaultListOptions())
+	if got := countRows(t, pods, err); got != 1 {
+		t.Errorf("the legacy case has %d pods, want 1", got)
+	}
+	vmis, err := legacyStore.GetVmis(DefaultListOptions())
+	if got := countRows(t, vmis, err); got != 1 {
+		t.Errorf("the legacy case has %d vmis, want 1", got)
+	}
+	migrations, err := legacyStore.GetVmiMigrations(DefaultListOptions(), nil)
+	if got := countRows(t, migrations, err); got != 1 {
+		t.Errorf("the legacy case has %d migrations, want 1", got)
+	}
+	results, err := legacyStore.GetVMIQueryParams("vmi-1", "")
+	if err != nil || results.SourcePod != "virt-launcher-vm1" {
+		t.Errorf("GetVMIQueryParams(vmi-1) = %+v, %v, want the legacy launcher", results, err)
+	}
+
+	for _, table := range legacyTables {
+		if err := store.execTable("SELECT 1 FROM legacy_" + table); err == nil {
+			t.Errorf("legacy_%s was kept", table)
+		}
+	}
+}
+
+func TestMigrateWithoutLegacyTables(t *testing.T) {
+	store := newSQLiteInstance(t)
+	if err := store.InitTables(); err != nil {
+		t.Fatalf("InitTables() error = %v", err)
+	}
+	cases, err := store.GetCases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 0 {
+		t.Errorf("GetCases() = %+v, want no case", cases)
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	store := newSQLiteInstance(t)
+	if err := store.InitTables(); err != nil {
+		t.Fatalf("InitTables() error = %v", err)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion() = %d, %v, want %d", version, err, LatestSchemaVersion())
+	}
+	// migrating again is a no-op
+	if err := store.InitTables(); err != nil {
+		t.Fatalf("InitTables() again error = %v", err)
+	}
+	if err := store.StorePod(testPod("virt-launcher-vm1", "default", time.Now())); err != nil {
+		t.Fatalf("StorePod() error = %v", err)
+	}
+
+	if err := store.MigrateTo(0); err != nil {
+		t.Fatalf("MigrateTo(0) error = %v", err)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("SchemaVersion() = %d, %v, want 0", version, err)
+	}
+	for _, table := range caseTables {
+		if err := store.execTable("SELECT 1 FROM " + table); err == nil {
+			t.Errorf("%s was kept at version 0", table)
+		}
+	}
+
+	if err := store.InitTables(); err != nil {
+		t.Fatalf("InitTables() after MigrateTo(0) error = %v", err)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, %v, want %d", version, err, LatestSchemaVersion())
+	}
+	pods, err := store.GetPods(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	if n := len(pods["data"].([]map[string]interface{})); n != 0 {
+		t.Errorf("GetPods() = %d pods after re-creating the tables, want none", n)
+	}
+}
+
+func TestMigrateToUnknownVersion(t *testing.T) {
+	store := newSQLiteInstance(t)
+	for _, version := range []int{-1, LatestSchemaVersion() + 1} {
+		if err := store.MigrateTo(version); err == nil {
+			t.Errorf("MigrateTo(%d) did not fail", version)
+		}
+	}
+}
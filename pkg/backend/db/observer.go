@@ -1,116 +1,350 @@
 package db
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	k8sv1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/json"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
 
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
 	kubevirtv1 "kubevirt.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
     
     "logsviewer/pkg/backend/log"
 )
 
-func NewObjectStore() *ObjectStore {
+// commitAttempts bounds how often a transient failure to store objects is
+// retried. The batch is requeued with a delay of commitRetryDelay, doubled
+// after every attempt.
+const (
+	commitAttempts   = 5
+	commitRetryDelay = 500 * time.Millisecond
+	commitMaxDelay   = 30 * time.Second
+)
+
+// errMissingUID rejects objects that can't be keyed in their table.
+var errMissingUID = errors.New("object has no metadata.uid")
 
-	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "objectStore")
-	c := &ObjectStore{
-		Queue:             queue,
-		lockDBConn:        &sync.Mutex{},
+// NewObjectStore returns an object store that collects the objects of an
+// import and stores them under caseID in store, whose tables are expected to
+// exist, once Commit is called.
+func NewObjectStore(store Store, caseID string) *ObjectStore {
+	return &ObjectStore{
+		storeDB: store.ForCase(caseID),
+		caseID:  caseID,
+		batch:   &Batch{},
+		sources: map[interface{}]string{},
+		retries: workqueue.NewItemExponentialFailureRateLimiter(commitRetryDelay, commitMaxDelay),
 	}
-
-	return c
 }
 
 type ObjectStore struct {
-	Queue             workqueue.RateLimitingInterface
-	storeDB           *databaseInstance
-	lockDBConn   	  *sync.Mutex
-    wg                sync.WaitGroup
-
+	storeDB Store
+	caseID  string
+	lock    sync.Mutex
+	batch   *Batch
+	// sources maps the records of the batch to the file they were read from
+	sources     map[interface{}]string
+	deadLetters []*DeadLetter
+	// retries spaces the attempts to store a batch, see storeBatch
+	retries workqueue.RateLimiter
 }
 
-func (c *ObjectStore) Run(threadiness int, stopCh chan struct{}) {
-	defer c.Queue.ShutDown()
-    //workers := 1
+// Commit stores every object added so far and returns how many objects of
+// each kind were stored, and how many objects became dead letters. Transient
+// failures are retried commitAttempts times; when they persist nothing more
+// is stored and every object left becomes a dead letter. When the objects are
+// rejected by the database, the batch is split until the rejected objects are
+// found, so that only those become dead letters, each with its own error.
+// Dead letters are recorded either way, see Store.GetDeadLetters.
+func (c *ObjectStore) Commit() (map[string]int, int, error) {
+	c.lock.Lock()
+	batch, sources, deadLetters := c.batch, c.sources, c.deadLetters
+	c.batch, c.sources, c.deadLetters = &Batch{}, map[interface{}]string{}, nil
+	c.lock.Unlock()
 
-	// Start the actual work
-	for i := 0; i < threadiness; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+	mergeMigrationStates(batch)
+	linkObjects(batch)
+	counts := batch.Counts()
+	rejected, err := c.storeObjects(batch, batchObjects(batch))
+	for _, r := range rejected {
+		counts[r.object.table]--
+		deadLetters = append(deadLetters, newDeadLetter(r.object.kind, r.object.name, r.object.namespace, sources[r.object.record], r.err))
+	}
+	if err != nil {
+		log.Log.Println("giving up storing the objects of case ", c.caseID, " err: ", err)
+	} else {
+		log.Log.Println("stored ", batch.Len()-len(rejected), " objects of case ", c.caseID)
 	}
 
-	<-stopCh
-    c.wg.Wait()
-    
+	if len(deadLetters) > 0 {
+		log.Log.Println("recording ", len(deadLetters), " dead letters of case ", c.caseID)
+		if storeErr := c.storeDB.StoreDeadLetters(deadLetters); storeErr != nil {
+			log.Log.Println("failed to record the dead letters of case ", c.caseID, " err: ", storeErr)
+			if err == nil {
+				err = fmt.Errorf("failed to record %d dead letters: %v", len(deadLetters), storeErr)
+			}
+		}
+	}
+	if err != nil {
+		return nil, len(deadLetters), err
+	}
+	return counts, len(deadLetters), nil
 }
 
-func (c *ObjectStore) runWorker() {
-    log.Log.Println("runWorker")
-	for c.Execute() {
-	}
+// batchObject is an object of a batch, with what it takes to store it on its
+// own.
+type batchObject struct {
+	table     string
+	kind      string
+	name      string
+	namespace string
+	uid       string
+	// record is the record of the object in the batch, the key of its source
+	record interface{}
+	add    func(b *Batch)
 }
 
-func (c *ObjectStore) connectDatabaseIfNeeded() bool {
-	if c.storeDB == nil {
-		c.lockDBConn.Lock()
-		defer c.lockDBConn.Unlock()
+// rejectedObject is an object the database refused to store.
+type rejectedObject struct {
+	object batchObject
+	err    error
+}
 
-		dbInst, err := NewDatabaseInstance()
-		if err != nil {
-            log.Log.Println("failed to connect to database", err)
-			return false
+// batchObjects returns the objects of a batch, in the order of the batch.
+func batchObjects(batch *Batch) []batchObject {
+	objects := make([]batchObject, 0, batch.Len())
+	for _, pod := range batch.Pods {
+		pod := pod
+		objects = append(objects, batchObject{"pods", "Pod", pod.Name, pod.Namespace, pod.UUID, pod,
+			func(b *Batch) { b.Pods = append(b.Pods, pod) }})
+	}
+	for _, vmi := range batch.Vmis {
+		vmi := vmi
+		objects = append(objects, batchObject{"vmis", "VirtualMachineInstance", vmi.Name, vmi.Namespace, vmi.UUID, vmi,
+			func(b *Batch) { b.Vmis = append(b.Vmis, vmi) }})
+	}
+	for _, vmim := range batch.VmiMigrations {
+		vmim := vmim
+		objects = append(objects, batchObject{"vmimigrations", "VirtualMachineInstanceMigration", vmim.Name, vmim.Namespace, vmim.UUID, vmim,
+			func(b *Batch) { b.VmiMigrations = append(b.VmiMigrations, vmim) }})
+	}
+	for _, vm := range batch.Vms {
+		vm := vm
+		objects = append(objects, batchObject{"vms", "VirtualMachine", vm.Name, vm.Namespace, vm.UUID, vm,
+			func(b *Batch) { b.Vms = append(b.Vms, vm) }})
+	}
+	for _, node := range batch.Nodes {
+		node := node
+		objects = append(objects, batchObject{"nodes", "Node", node.Name, "", node.UUID, node,
+			func(b *Batch) { b.Nodes = append(b.Nodes, node) }})
+	}
+	for _, event := range batch.Events {
+		event := event
+		objects = append(objects, batchObject{"events", "Event", event.Name, event.Namespace, event.UUID, event,
+			func(b *Batch) { b.Events = append(b.Events, event) }})
+	}
+	for _, dv := range batch.DataVolumes {
+		dv := dv
+		objects = append(objects, batchObject{"datavolumes", "DataVolume", dv.Name, dv.Namespace, dv.UUID, dv,
+			func(b *Batch) { b.DataVolumes = append(b.DataVolumes, dv) }})
+	}
+	for _, pvc := range batch.PVCs {
+		pvc := pvc
+		objects = append(objects, batchObject{"pvcs", "PersistentVolumeClaim", pvc.Name, pvc.Namespace, pvc.UUID, pvc,
+			func(b *Batch) { b.PVCs = append(b.PVCs, pvc) }})
+	}
+	for _, pv := range batch.PVs {
+		pv := pv
+		objects = append(objects, batchObject{"pvs", "PersistentVolume", pv.Name, "", pv.UUID, pv,
+			func(b *Batch) { b.PVs = append(b.PVs, pv) }})
+	}
+	for _, sc := range batch.StorageClasses {
+		sc := sc
+		objects = append(objects, batchObject{"storageclasses", "StorageClass", sc.Name, "", sc.UUID, sc,
+			func(b *Batch) { b.StorageClasses = append(b.StorageClasses, sc) }})
+	}
+	for _, component := range batch.Components {
+		component := component
+		objects = append(objects, batchObject{"components", component.Kind, component.Name, component.Namespace, component.UUID, component,
+			func(b *Batch) { b.Components = append(b.Components, component) }})
+	}
+	for _, resource := range batch.Resources {
+		resource := resource
+		objects = append(objects, batchObject{"resources", resource.Kind, resource.Name, resource.Namespace, resource.UUID, resource,
+			func(b *Batch) { b.Resources = append(b.Resources, resource) }})
+	}
+	return objects
+}
+
+// subBatch returns the part of batch made of objects, with the volumes they
+// own and the relations they are an end of.
+func subBatch(batch *Batch, objects []batchObject) *Batch {
+	sub := &Batch{}
+	uids := map[string]bool{}
+	for _, object := range objects {
+		object.add(sub)
+		uids[object.uid] = true
+	}
+	for _, volume := range batch.Volumes {
+		if uids[volume.OwnerUID] {
+			sub.Volumes = append(sub.Volumes, volume)
 		}
-		c.storeDB = dbInst
-		if err := c.storeDB.InitTables(); err != nil {
-            log.Log.Println("failed to connect to database", err)
-			if err := c.storeDB.DropTables(); err != nil {
-                log.Log.Println("failed to drop tables", err)
-			}
-			c.storeDB.Shutdown()
-			c.storeDB = nil
-			return false
+	}
+	for _, relation := range batch.Relations {
+		if uids[relation.SourceUID] || uids[relation.TargetUID] {
+			sub.Relations = append(sub.Relations, relation)
 		}
 	}
-	return true
+	return sub
+}
+
+// storeObjects stores the objects of batch in a single transaction. When the
+// database rejects them, both halves are stored on their own, down to single
+// objects, which are returned with the error they were rejected with. A
+// transient failure that persists is returned as is, together with every
+// object that was not stored.
+func (c *ObjectStore) storeObjects(batch *Batch, objects []batchObject) ([]rejectedObject, error) {
+	err := c.storeBatch(subBatch(batch, objects))
+	if err == nil {
+		return nil, nil
+	}
+	if isTransient(err) || len(objects) == 0 {
+		rejected := make([]rejectedObject, 0, len(objects))
+		for _, object := range objects {
+			rejected = append(rejected, rejectedObject{object, err})
+		}
+		return rejected, err
+	}
+	if len(objects) == 1 {
+		log.Log.Println("failed to store ", objects[0].kind, " ", objects[0].uid, " of case ", c.caseID, " err: ", err)
+		return []rejectedObject{{objects[0], err}}, nil
+	}
 
+	half := len(objects) / 2
+	rejected, err := c.storeObjects(batch, objects[:half])
+	if err != nil {
+		for _, object := range objects[half:] {
+			rejected = append(rejected, rejectedObject{object, err})
+		}
+		return rejected, err
+	}
+	rest, err := c.storeObjects(batch, objects[half:])
+	return append(rejected, rest...), err
 }
 
-func (c *ObjectStore) Execute() bool {
-	if succedded := c.connectDatabaseIfNeeded(); !succedded {
-        log.Log.Println("failed to connect to DB")
-		return false
+// storeBatch stores batch, requeueing it through a rate-limited queue while
+// it fails transiently. The batch is stored in a single transaction, so a
+// failed attempt leaves nothing behind.
+func (c *ObjectStore) storeBatch(batch *Batch) error {
+	queue := workqueue.NewRateLimitingQueue(c.retries)
+	defer queue.ShutDown()
+	queue.Add(batch)
+	for {
+		item, _ := queue.Get()
+		err := c.storeDB.StoreBatch(item.(*Batch))
+		attempt := queue.NumRequeues(item) + 1
+		if err == nil || !isTransient(err) || attempt == commitAttempts {
+			queue.Forget(item)
+			queue.Done(item)
+			return err
+		}
+		log.Log.Println("failed to store the objects of case ", c.caseID, ", attempt ", attempt, " of ", commitAttempts, ", requeueing it, err: ", err)
+		queue.AddRateLimited(item)
+		queue.Done(item)
 	}
+}
 
-	obj, quit := c.Queue.Get()
-	if quit {
+// isTransient reports whether storing may succeed when retried: the
+// connection was lost, the database was busy or a deadlock was broken. Any
+// other error is caused by the objects and fails again.
+func isTransient(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		// too many connections, lock wait timeout, deadlock
+		case 1040, 1205, 1213:
+			return true
+		}
 		return false
 	}
-	defer c.Queue.Done(obj)
-	if err := c.execute(obj); err != nil {
-        log.Log.Println("re-enqueuing object ", obj, " err: ", err)
-		//c.Queue.AddRateLimited(obj)
-	} else {
-		c.Queue.Forget(obj)
-        c.wg.Done()
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// the primary result code is the low byte of the extended one
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return true
+		}
 	}
-
-	return true
+	return false
 }
 
-func (d *ObjectStore) execute(obj interface{}) error {
-	// Make sure we re-enqueue the key to ensure this new VMI is processed
-	// after the stale domain is removed
-	//	d.Queue.AddAfter(controller.VirtualMachineInstanceKey(vmi), time.Second*5)
-	d.processObject(obj)
+func newDeadLetter(kind string, name string, namespace string, source string, err error) *DeadLetter {
+	return &DeadLetter{
+		Kind:         kind,
+		Name:         name,
+		Namespace:    namespace,
+		Source:       source,
+		Error:        err.Error(),
+		CreationTime: time.Now().UTC(),
+	}
+}
 
-	return nil
+// mergeMigrationStates completes the migrations of the batch with the
+// migration state of their VMI, which carries the nodes, target pod and
+// outcome the migration objects lack.
+func mergeMigrationStates(batch *Batch) {
+	migrations := map[string]*VirtualMachineInstanceMigration{}
+	for _, vmim := range batch.VmiMigrations {
+		migrations[vmim.UUID] = vmim
+	}
+	for _, vmi := range batch.Vmis {
+		migrationState := vmi.Status.MigrationState
+		if migrationState == nil {
+			continue
+		}
+		vmim, ok := migrations[string(migrationState.MigrationUID)]
+		if !ok {
+			log.Log.Println("can't find migration ", migrationState.MigrationUID, " of vmi ", vmi.UUID)
+			continue
+		}
+		vmim.TargetPod = migrationState.TargetPod
+		if migrationState.StartTimestamp != nil {
+			vmim.CreationTime = *migrationState.StartTimestamp
+		}
+		if migrationState.EndTimestamp != nil {
+			vmim.EndTimestamp = *migrationState.EndTimestamp
+		}
+		vmim.SourceNode = migrationState.SourceNode
+		vmim.TargetNode = migrationState.TargetNode
+		vmim.Completed = migrationState.Completed
+		vmim.Failed = migrationState.Failed
+	}
 }
 
-func (d *ObjectStore) countPodContainers(pod *k8sv1.Pod) (int, int) {
+func countPodContainers(pod *k8sv1.Pod) (int, int) {
     totalContainers := len(pod.Spec.Containers)
     activeContainers := 0
     for _, container := range pod.Status.ContainerStatuses {
@@ -121,14 +355,17 @@ func (d *ObjectStore) countPodContainers(pod *k8sv1.Pod) (int, int) {
     return totalContainers, activeContainers
 }
 
-func (d *ObjectStore) storePod(pod *k8sv1.Pod) error {
+func newPodRecord(pod *k8sv1.Pod) (*Pod, error) {
+    if pod.GetUID() == "" {
+        return nil, errMissingUID
+    }
     jsonBytes, err := json.Marshal(pod)
     if err != nil {
-        log.Log.Println("failed to marshal pod object ", pod, " err: ", err)
+        return nil, err
     }
 
     createdByUID := pod.Labels[kubevirtv1.CreatedByLabel]
-    totalContainers, activeContainers := d.countPodContainers(pod)
+    totalContainers, activeContainers := countPodContainers(pod)
     name := pod.GetObjectMeta().GetName()
     namespace := pod.GetObjectMeta().GetNamespace()
     uid := string(pod.GetObjectMeta().GetUID())
@@ -147,17 +384,16 @@ func (d *ObjectStore) storePod(pod *k8sv1.Pod) error {
         Content: jsonBytes,
         CreatedBy: createdByUID,
 	}
-	if err := d.storeDB.StorePod(storeObj); err != nil {
-        log.Log.Println("failed to store obj  ", storeObj, " err: ", err)
-		return err
-	}
-	return nil
+	return storeObj, nil
 }
 
-func (d *ObjectStore) storeVmi(vmi *kubevirtv1.VirtualMachineInstance) error {
+func newVmiRecord(vmi *kubevirtv1.VirtualMachineInstance) (*VirtualMachineInstance, error) {
+    if vmi.GetUID() == "" {
+        return nil, errMissingUID
+    }
     jsonBytes, err := json.Marshal(vmi)
     if err != nil {
-        log.Log.Println("failed to marshal vmi object ", vmi, " err: ", err)
+        return nil, err
     }
 
     name := vmi.GetObjectMeta().GetName()
@@ -174,19 +410,17 @@ func (d *ObjectStore) storeVmi(vmi *kubevirtv1.VirtualMachineInstance) error {
         Status: vmi.Status,
         Content: jsonBytes,
 	}
-	if err := d.storeDB.StoreVmi(storeObj); err != nil {
-        log.Log.Println("failed to store vmi obj  ", storeObj, " err: ", err)
-		return err
-	}
-	return nil
+	return storeObj, nil
 }
 
-func (d *ObjectStore) storeVmiMigration(vmim *kubevirtv1.VirtualMachineInstanceMigration) error {
+func newVmiMigrationRecord(vmim *kubevirtv1.VirtualMachineInstanceMigration) (*VirtualMachineInstanceMigration, error) {
+    if vmim.GetUID() == "" {
+        return nil, errMissingUID
+    }
     jsonBytes, err := json.Marshal(vmim)
     if err != nil {
-        log.Log.Println("failed to marshal vmi migration object ", vmim, " err: ", err)
+        return nil, err
     }
-    log.Log.Println("Marshaled VMIM YAML: ", string(jsonBytes))
 
     name := vmim.GetObjectMeta().GetName()
     namespace := vmim.GetObjectMeta().GetNamespace()
@@ -200,59 +434,707 @@ func (d *ObjectStore) storeVmiMigration(vmim *kubevirtv1.VirtualMachineInstanceM
         CreationTime: vmim.CreationTimestamp,
         Content: jsonBytes,
 	}
-    log.Log.Println("storeObj VMIM YAML: ", storeObj)
-	if err := d.storeDB.StoreVmiMigration(storeObj); err != nil {
-        log.Log.Println("failed to store vmi migration obj  ", storeObj, " err: ", err)
-		return err
+	return storeObj, nil
+}
+
+func newVmRecord(vm *kubevirtv1.VirtualMachine) (*VirtualMachine, error) {
+    if vm.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(vm)
+    if err != nil {
+        return nil, err
+    }
+    conditions, err := json.Marshal(vm.Status.Conditions)
+    if err != nil {
+        return nil, err
+    }
+
+    // RunStrategy resolves the deprecated spec.running as well
+    runStrategy, err := vm.RunStrategy()
+    if err != nil {
+        log.Log.Println("failed to get the run strategy of vm ", vm.Name, " err: ", err)
+    }
+	storeObj := &VirtualMachine{
+		Name:      vm.GetObjectMeta().GetName(),
+		Namespace: vm.GetObjectMeta().GetNamespace(),
+		UUID:      string(vm.GetObjectMeta().GetUID()),
+        RunStrategy: string(runStrategy),
+        PrintableStatus: string(vm.Status.PrintableStatus),
+        Ready: vm.Status.Ready,
+        CreationTime: vm.CreationTimestamp,
+        Conditions: conditions,
+        Content: jsonBytes,
 	}
-	return nil
+	return storeObj, nil
 }
 
-func (d *ObjectStore) processObject(obj interface{}) {
-	switch obj.(type) {
-	case *k8sv1.Pod:
-		podObj := obj.(*k8sv1.Pod)
-		if err := d.storePod(podObj); err == nil {
-            log.Log.Println("stored obj  ", podObj)
-		}
-	case *kubevirtv1.VirtualMachineInstance:
-		vmi := obj.(*kubevirtv1.VirtualMachineInstance)
-		if err := d.storeVmi(vmi); err == nil {
-            log.Log.Println("stored vmi obj  ", vmi)
+// kvmDeviceResource is the device plugin resource virt-handler advertises on
+// nodes where /dev/kvm is usable.
+const kvmDeviceResource = k8sv1.ResourceName("devices.kubevirt.io/kvm")
+
+func newNodeRecord(node *k8sv1.Node) (*Node, error) {
+    if node.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(node)
+    if err != nil {
+        return nil, err
+    }
+
+    ready := false
+    for _, condition := range node.Status.Conditions {
+        if condition.Type == k8sv1.NodeReady {
+            ready = condition.Status == k8sv1.ConditionTrue
         }
-	case *kubevirtv1.VirtualMachineInstanceMigration:
-		vmim := obj.(*kubevirtv1.VirtualMachineInstanceMigration)
-		if err := d.storeVmiMigration(vmim); err == nil {
-            log.Log.Println("stored vmi migration obj  ", vmim)
+    }
+    kvm, hasKVM := node.Status.Allocatable[kvmDeviceResource]
+
+    // marshalling maps and slices of API types can't fail
+    labels, _ := json.Marshal(node.Labels)
+    taints, _ := json.Marshal(node.Spec.Taints)
+    allocatable, _ := json.Marshal(node.Status.Allocatable)
+    capacity, _ := json.Marshal(node.Status.Capacity)
+    conditions, _ := json.Marshal(node.Status.Conditions)
+	storeObj := &Node{
+		Name:      node.GetObjectMeta().GetName(),
+		UUID:      string(node.GetObjectMeta().GetUID()),
+        KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+        Ready: ready,
+        Schedulable: !node.Spec.Unschedulable,
+        KVMAvailable: hasKVM && kvm.Sign() > 0,
+        CreationTime: node.CreationTimestamp,
+        Labels: labels,
+        Taints: taints,
+        Allocatable: allocatable,
+        Capacity: capacity,
+        Conditions: conditions,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+func newEventRecord(event *k8sv1.Event) (*Event, error) {
+    jsonBytes, err := json.Marshal(event)
+    if err != nil {
+        return nil, err
+    }
+
+    // events.k8s.io style events only carry eventTime and series
+    first := event.FirstTimestamp
+    if first.IsZero() {
+        first = metav1.NewTime(event.EventTime.Time)
+    }
+    if first.IsZero() {
+        first = event.CreationTimestamp
+    }
+    last := event.LastTimestamp
+    if last.IsZero() && event.Series != nil {
+        last = metav1.NewTime(event.Series.LastObservedTime.Time)
+    }
+    if last.IsZero() {
+        last = first
+    }
+    count := int(event.Count)
+    if count == 0 && event.Series != nil {
+        count = int(event.Series.Count)
+    }
+    if count == 0 {
+        count = 1
+    }
+    source := event.Source.Component
+    if source == "" {
+        source = event.ReportingController
+    }
+
+    uid := string(event.GetObjectMeta().GetUID())
+    if uid == "" {
+        uid = fmt.Sprintf("%s/%s", event.Namespace, event.Name)
+    }
+	storeObj := &Event{
+		Name:      event.GetObjectMeta().GetName(),
+		Namespace: event.GetObjectMeta().GetNamespace(),
+		UUID:      uid,
+        InvolvedUID: string(event.InvolvedObject.UID),
+        InvolvedKind: event.InvolvedObject.Kind,
+        InvolvedName: event.InvolvedObject.Name,
+        InvolvedNamespace: event.InvolvedObject.Namespace,
+        Reason: event.Reason,
+        Type: event.Type,
+        Message: event.Message,
+        Source: source,
+        Count: count,
+        FirstTimestamp: first,
+        LastTimestamp: last,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+// CDI annotates the claims it populates with the pod doing it.
+const (
+    annImportPod = "cdi.kubevirt.io/storage.import.importPodName"
+    annUploadPod = "cdi.kubevirt.io/storage.uploadPodName"
+    annDefaultStorageClass = "storageclass.kubernetes.io/is-default-class"
+)
+
+func newDataVolumeRecord(dv *cdiv1.DataVolume) (*DataVolume, error) {
+    if dv.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(dv)
+    if err != nil {
+        return nil, err
+    }
+    conditions, err := json.Marshal(dv.Status.Conditions)
+    if err != nil {
+        return nil, err
+    }
+
+    claimName := dv.Status.ClaimName
+    if claimName == "" {
+        claimName = dv.Name
+    }
+    var storageClass *string
+    if dv.Spec.PVC != nil {
+        storageClass = dv.Spec.PVC.StorageClassName
+    } else if dv.Spec.Storage != nil {
+        storageClass = dv.Spec.Storage.StorageClassName
+    }
+	storeObj := &DataVolume{
+		Name:      dv.Name,
+		Namespace: dv.Namespace,
+		UUID:      string(dv.UID),
+        Phase: string(dv.Status.Phase),
+        Progress: string(dv.Status.Progress),
+        RestartCount: int(dv.Status.RestartCount),
+        SourceType: dataVolumeSourceType(&dv.Spec),
+        ClaimName: claimName,
+        StorageClass: stringValue(storageClass),
+        CreationTime: dv.CreationTimestamp,
+        Conditions: conditions,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+func dataVolumeSourceType(spec *cdiv1.DataVolumeSpec) string {
+    if spec.SourceRef != nil {
+        return "sourceRef"
+    }
+    source := spec.Source
+    switch {
+    case source == nil:
+        return ""
+    case source.HTTP != nil:
+        return "http"
+    case source.S3 != nil:
+        return "s3"
+    case source.Registry != nil:
+        return "registry"
+    case source.PVC != nil:
+        return "pvc"
+    case source.Upload != nil:
+        return "upload"
+    case source.Blank != nil:
+        return "blank"
+    case source.Imageio != nil:
+        return "imageio"
+    case source.VDDK != nil:
+        return "vddk"
+    }
+    return ""
+}
+
+func stringValue(value *string) string {
+    if value == nil {
+        return ""
+    }
+    return *value
+}
+
+func newPVCRecord(pvc *k8sv1.PersistentVolumeClaim) (*PersistentVolumeClaim, error) {
+    if pvc.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(pvc)
+    if err != nil {
+        return nil, err
+    }
+
+    // the claim is only granted its capacity and access modes once bound
+    capacity, ok := pvc.Status.Capacity[k8sv1.ResourceStorage]
+    if !ok {
+        capacity = pvc.Spec.Resources.Requests[k8sv1.ResourceStorage]
+    }
+    accessModes := pvc.Status.AccessModes
+    if len(accessModes) == 0 {
+        accessModes = pvc.Spec.AccessModes
+    }
+    // marshalling slices of API types can't fail
+    accessModesJSON, _ := json.Marshal(accessModes)
+    storageClass := stringValue(pvc.Spec.StorageClassName)
+    if storageClass == "" {
+        storageClass = pvc.Annotations[k8sv1.BetaStorageClassAnnotation]
+    }
+    volumeMode := ""
+    if pvc.Spec.VolumeMode != nil {
+        volumeMode = string(*pvc.Spec.VolumeMode)
+    }
+	storeObj := &PersistentVolumeClaim{
+		Name:      pvc.Name,
+		Namespace: pvc.Namespace,
+		UUID:      string(pvc.UID),
+        Phase: string(pvc.Status.Phase),
+        VolumeName: pvc.Spec.VolumeName,
+        StorageClass: storageClass,
+        Capacity: capacity.String(),
+        VolumeMode: volumeMode,
+        AccessModes: accessModesJSON,
+        ImportPod: pvc.Annotations[annImportPod],
+        UploadPod: pvc.Annotations[annUploadPod],
+        CreationTime: pvc.CreationTimestamp,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+func newPVRecord(pv *k8sv1.PersistentVolume) (*PersistentVolume, error) {
+    if pv.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(pv)
+    if err != nil {
+        return nil, err
+    }
+
+    capacity := pv.Spec.Capacity[k8sv1.ResourceStorage]
+    claimNamespace, claimName := "", ""
+    if pv.Spec.ClaimRef != nil {
+        claimNamespace, claimName = pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name
+    }
+    driver, volumeHandle := persistentVolumeDriver(&pv.Spec.PersistentVolumeSource)
+	storeObj := &PersistentVolume{
+		Name:      pv.Name,
+		UUID:      string(pv.UID),
+        Phase: string(pv.Status.Phase),
+        StorageClass: pv.Spec.StorageClassName,
+        Capacity: capacity.String(),
+        ClaimNamespace: claimNamespace,
+        ClaimName: claimName,
+        Driver: driver,
+        VolumeHandle: volumeHandle,
+        CreationTime: pv.CreationTimestamp,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+// persistentVolumeDriver names what backs a PV: the CSI driver, or the
+// in-tree plugin, together with the identifier of the volume in it.
+func persistentVolumeDriver(source *k8sv1.PersistentVolumeSource) (string, string) {
+    switch {
+    case source.CSI != nil:
+        return source.CSI.Driver, source.CSI.VolumeHandle
+    case source.Local != nil:
+        return "local", source.Local.Path
+    case source.HostPath != nil:
+        return "hostPath", source.HostPath.Path
+    case source.NFS != nil:
+        return "nfs", source.NFS.Server + ":" + source.NFS.Path
+    case source.ISCSI != nil:
+        return "iscsi", source.ISCSI.IQN
+    case source.RBD != nil:
+        return "rbd", source.RBD.RBDImage
+    case source.FC != nil:
+        return "fc", ""
+    }
+    return "", ""
+}
+
+func newStorageClassRecord(sc *storagev1.StorageClass) (*StorageClass, error) {
+    if sc.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(sc)
+    if err != nil {
+        return nil, err
+    }
+
+    // marshalling maps of strings can't fail
+    parameters, _ := json.Marshal(sc.Parameters)
+    reclaimPolicy, bindingMode := "", ""
+    if sc.ReclaimPolicy != nil {
+        reclaimPolicy = string(*sc.ReclaimPolicy)
+    }
+    if sc.VolumeBindingMode != nil {
+        bindingMode = string(*sc.VolumeBindingMode)
+    }
+	storeObj := &StorageClass{
+		Name:      sc.Name,
+		UUID:      string(sc.UID),
+        Provisioner: sc.Provisioner,
+        ReclaimPolicy: reclaimPolicy,
+        VolumeBindingMode: bindingMode,
+        AllowVolumeExpansion: sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion,
+        IsDefault: sc.Annotations[annDefaultStorageClass] == "true",
+        Parameters: parameters,
+        CreationTime: sc.CreationTimestamp,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+func newKubeVirtRecord(kv *kubevirtv1.KubeVirt) (*Component, error) {
+    if kv.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(kv)
+    if err != nil {
+        return nil, err
+    }
+
+	storeObj := &Component{
+        Kind:      "KubeVirt",
+		Name:      kv.Name,
+		Namespace: kv.Namespace,
+		UUID:      string(kv.UID),
+        Version: kv.Status.ObservedKubeVirtVersion,
+        Images: []byte("[]"),
+        CreationTime: kv.CreationTimestamp,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+// newHyperConvergedRecord converts the HyperConverged CR, which is read as
+// unstructured to not depend on the HCO API. Its version is the one the
+// operator reports for itself in status.versions.
+func newHyperConvergedRecord(hco *unstructured.Unstructured) (*Component, error) {
+    if hco.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(hco)
+    if err != nil {
+        return nil, err
+    }
+
+    version := ""
+    versions, _, _ := unstructured.NestedSlice(hco.Object, "status", "versions")
+    for _, v := range versions {
+        if entry, ok := v.(map[string]interface{}); ok && entry["name"] == "operator" {
+            version, _ = entry["version"].(string)
         }
-	default:
-		jsonBytes, err := json.Marshal(obj)
-		if err != nil {
-            log.Log.Println("failed to marshal obj", obj, " err: ", err)
-		}
-		log.Log.Println(jsonBytes)
+    }
+	storeObj := &Component{
+        Kind:      "HyperConverged",
+		Name:      hco.GetName(),
+		Namespace: hco.GetNamespace(),
+		UUID:      string(hco.GetUID()),
+        Version: version,
+        Images: []byte("[]"),
+        CreationTime: hco.GetCreationTimestamp(),
+        Content: jsonBytes,
 	}
+	return storeObj, nil
 }
 
-func (d *ObjectStore) Add(obj interface{}) {
+func newDeploymentRecord(deployment *appsv1.Deployment) (*Component, error) {
+    if deployment.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(deployment)
+    if err != nil {
+        return nil, err
+    }
 
+    images, version := componentImages(deployment.Labels, &deployment.Spec.Template.Spec)
+    desiredReplicas := 1
+    if deployment.Spec.Replicas != nil {
+        desiredReplicas = int(*deployment.Spec.Replicas)
+    }
+	storeObj := &Component{
+        Kind:      "Deployment",
+		Name:      deployment.Name,
+		Namespace: deployment.Namespace,
+		UUID:      string(deployment.UID),
+        Version: version,
+        Images: images,
+        DesiredReplicas: desiredReplicas,
+        ReadyReplicas: int(deployment.Status.ReadyReplicas),
+        CreationTime: deployment.CreationTimestamp,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+func newDaemonSetRecord(daemonSet *appsv1.DaemonSet) (*Component, error) {
+    if daemonSet.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(daemonSet)
+    if err != nil {
+        return nil, err
+    }
+
+    images, version := componentImages(daemonSet.Labels, &daemonSet.Spec.Template.Spec)
+	storeObj := &Component{
+        Kind:      "DaemonSet",
+		Name:      daemonSet.Name,
+		Namespace: daemonSet.Namespace,
+		UUID:      string(daemonSet.UID),
+        Version: version,
+        Images: images,
+        DesiredReplicas: int(daemonSet.Status.DesiredNumberScheduled),
+        ReadyReplicas: int(daemonSet.Status.NumberReady),
+        CreationTime: daemonSet.CreationTimestamp,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+// componentImages returns the container images of a component and the
+// version it was deployed with: the version label virt-operator sets, or
+// else the tag of its first image.
+func componentImages(labels map[string]string, spec *k8sv1.PodSpec) ([]byte, string) {
+    images := []string{}
+    for _, container := range spec.Containers {
+        images = append(images, container.Image)
+    }
+    version := labels[kubeVirtVersionLabel]
+    if version == "" && len(images) > 0 {
+        version = imageTag(images[0])
+    }
+    // marshalling slices of strings can't fail
+    imagesJSON, _ := json.Marshal(images)
+    return imagesJSON, version
+}
+
+// imageTag returns the tag of an image reference, empty for images pinned
+// by digest only.
+func imageTag(image string) string {
+    if i := strings.Index(image, "@"); i >= 0 {
+        image = image[:i]
+    }
+    i := strings.LastIndex(image, ":")
+    if i < 0 || strings.Contains(image[i:], "/") {
+        return ""
+    }
+    return image[i+1:]
+}
+
+// newResourceRecord converts an object of a kind read generically, kind being
+// its name in the registry and fields the columns extracted from it.
+func newResourceRecord(kind string, obj *unstructured.Unstructured, fields map[string]string) (*Resource, error) {
+    if obj.GetUID() == "" {
+        return nil, errMissingUID
+    }
+    jsonBytes, err := json.Marshal(obj)
+    if err != nil {
+        return nil, err
+    }
+
+    // marshalling maps of strings can't fail
+    fieldsJSON, _ := json.Marshal(fields)
+	storeObj := &Resource{
+        Kind:      kind,
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		UUID:      string(obj.GetUID()),
+        CreationTime: obj.GetCreationTimestamp(),
+        Fields: fieldsJSON,
+        Content: jsonBytes,
+	}
+	return storeObj, nil
+}
+
+// newVolumeRecords returns the volumes of a VMI or VM that are backed by a
+// claim, directly or through a DataVolume.
+func newVolumeRecords(owner metav1.Object, ownerKind string, volumes []kubevirtv1.Volume) []*Volume {
+    records := []*Volume{}
+    for _, volume := range volumes {
+        record := &Volume{
+            OwnerUID: string(owner.GetUID()),
+            OwnerKind: ownerKind,
+            Namespace: owner.GetNamespace(),
+            Name: volume.Name,
+        }
+        switch {
+        case volume.PersistentVolumeClaim != nil:
+            record.ClaimName = volume.PersistentVolumeClaim.ClaimName
+        case volume.DataVolume != nil:
+            // the claim of a DataVolume shares its name
+            record.ClaimName = volume.DataVolume.Name
+            record.DataVolumeName = volume.DataVolume.Name
+        default:
+            continue
+        }
+        records = append(records, record)
+    }
+    return records
+}
+
+// Add converts a supported object read from source, the file of the
+// must-gather it comes from, and adds it to the objects to commit. Objects
+// that can't be converted become dead letters.
+func (d *ObjectStore) Add(obj interface{}, source string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var kind string
+	var record interface{}
+	var err error
 	switch v := obj.(type) {
 	case *k8sv1.Pod:
-		podObj := obj.(*k8sv1.Pod)
-        
-        d.wg.Add(1)    
-	    d.Queue.Add(podObj)
+		kind = "Pod"
+		var pod *Pod
+		if pod, err = newPodRecord(v); err == nil {
+			d.batch.Pods = append(d.batch.Pods, pod)
+			record = pod
+		}
 	case *kubevirtv1.VirtualMachineInstance:
-		vmi := obj.(*kubevirtv1.VirtualMachineInstance)
-        
-        d.wg.Add(1)    
-	    d.Queue.Add(vmi)
+		kind = "VirtualMachineInstance"
+		var vmi *VirtualMachineInstance
+		if vmi, err = newVmiRecord(v); err == nil {
+			d.batch.Vmis = append(d.batch.Vmis, vmi)
+			d.batch.Volumes = append(d.batch.Volumes, newVolumeRecords(v, kind, v.Spec.Volumes)...)
+			record = vmi
+		}
 	case *kubevirtv1.VirtualMachineInstanceMigration:
-		vmim := obj.(*kubevirtv1.VirtualMachineInstanceMigration)
-        
-        d.wg.Add(1)    
-	    d.Queue.Add(vmim)
+		kind = "VirtualMachineInstanceMigration"
+		var vmim *VirtualMachineInstanceMigration
+		if vmim, err = newVmiMigrationRecord(v); err == nil {
+			d.batch.VmiMigrations = append(d.batch.VmiMigrations, vmim)
+			record = vmim
+		}
+	case *kubevirtv1.VirtualMachine:
+		kind = "VirtualMachine"
+		var vm *VirtualMachine
+		if vm, err = newVmRecord(v); err == nil {
+			d.batch.Vms = append(d.batch.Vms, vm)
+			if v.Spec.Template != nil {
+				d.batch.Volumes = append(d.batch.Volumes, newVolumeRecords(v, kind, v.Spec.Template.Spec.Volumes)...)
+			}
+			record = vm
+		}
+	case *k8sv1.Node:
+		kind = "Node"
+		var node *Node
+		if node, err = newNodeRecord(v); err == nil {
+			d.batch.Nodes = append(d.batch.Nodes, node)
+			record = node
+		}
+	case *k8sv1.Event:
+		kind = "Event"
+		var event *Event
+		if event, err = newEventRecord(v); err == nil {
+			d.batch.Events = append(d.batch.Events, event)
+			record = event
+		}
+	case *cdiv1.DataVolume:
+		kind = "DataVolume"
+		var dv *DataVolume
+		if dv, err = newDataVolumeRecord(v); err == nil {
+			d.batch.DataVolumes = append(d.batch.DataVolumes, dv)
+			record = dv
+		}
+	case *k8sv1.PersistentVolumeClaim:
+		kind = "PersistentVolumeClaim"
+		var pvc *PersistentVolumeClaim
+		if pvc, err = newPVCRecord(v); err == nil {
+			d.batch.PVCs = append(d.batch.PVCs, pvc)
+			record = pvc
+		}
+	case *k8sv1.PersistentVolume:
+		kind = "PersistentVolume"
+		var pv *PersistentVolume
+		if pv, err = newPVRecord(v); err == nil {
+			d.batch.PVs = append(d.batch.PVs, pv)
+			record = pv
+		}
+	case *storagev1.StorageClass:
+		kind = "StorageClass"
+		var sc *StorageClass
+		if sc, err = newStorageClassRecord(v); err == nil {
+			d.batch.StorageClasses = append(d.batch.StorageClasses, sc)
+			record = sc
+		}
+	case *kubevirtv1.KubeVirt:
+		kind = "KubeVirt"
+		var kv *Component
+		if kv, err = newKubeVirtRecord(v); err == nil {
+			d.batch.Components = append(d.batch.Components, kv)
+			record = kv
+		}
+	case *unstructured.Unstructured:
+		// HyperConverged is the only CR read without a typed API
+		if kind = v.GetKind(); kind != "HyperConverged" {
+			log.Log.Println("Cannot store unsupported obj ", kind)
+			return
+		}
+		var hco *Component
+		if hco, err = newHyperConvergedRecord(v); err == nil {
+			d.batch.Components = append(d.batch.Components, hco)
+			record = hco
+		}
+	case *appsv1.Deployment:
+		kind = "Deployment"
+		var deployment *Component
+		if deployment, err = newDeploymentRecord(v); err == nil {
+			d.batch.Components = append(d.batch.Components, deployment)
+			record = deployment
+		}
+	case *appsv1.DaemonSet:
+		kind = "DaemonSet"
+		var daemonSet *Component
+		if daemonSet, err = newDaemonSetRecord(v); err == nil {
+			d.batch.Components = append(d.batch.Components, daemonSet)
+			record = daemonSet
+		}
 	default:
 		log.Log.Println("Cannot store unsupported obj ", v)
-    }
+		return
+	}
+
+	if err != nil {
+		name, namespace := "", ""
+		if accessor, ok := obj.(metav1.Object); ok {
+			name, namespace = accessor.GetName(), accessor.GetNamespace()
+		}
+		log.Log.Println("failed to convert ", kind, " ", namespace, "/", name, " from ", source, " err: ", err)
+		d.deadLetters = append(d.deadLetters, newDeadLetter(kind, name, namespace, source, err))
+		return
+	}
+	d.sources[record] = source
+	if accessor, ok := obj.(metav1.Object); ok {
+		d.batch.Relations = append(d.batch.Relations, newOwnerRelations(accessor, kind)...)
+	}
+}
+
+// AddResource adds an object of a kind read generically, see package
+// resources, with the columns extracted from it. Like Add, objects that can't
+// be converted become dead letters.
+func (d *ObjectStore) AddResource(kind string, obj *unstructured.Unstructured, fields map[string]string, source string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	resource, err := newResourceRecord(kind, obj, fields)
+	if err != nil {
+		log.Log.Println("failed to convert ", kind, " ", obj.GetNamespace(), "/", obj.GetName(), " from ", source, " err: ", err)
+		d.deadLetters = append(d.deadLetters, newDeadLetter(kind, obj.GetName(), obj.GetNamespace(), source, err))
+		return
+	}
+	d.batch.Resources = append(d.batch.Resources, resource)
+	d.sources[resource] = source
+	d.batch.Relations = append(d.batch.Relations, newOwnerRelations(obj, obj.GetKind())...)
+}
+
+// Fail records a dead letter for a file of the must-gather whose objects of
+// kind could not be read at all.
+func (d *ObjectStore) Fail(kind string, source string, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	log.Log.Println("failed to read ", kind, " from ", source, " err: ", err)
+	d.deadLetters = append(d.deadLetters, newDeadLetter(kind, "", "", source, err))
 }
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// batchStore is a Store that fails the batches fail returns an error for and
+// keeps the others.
+type batchStore struct {
+	Store
+	fail        func(b *Batch) error
+	attempts    int
+	pods        []*Pod
+	deadLetters []*DeadLetter
+}
+
+func (s *batchStore) ForCase(caseID string) Store {
+	return s
+}
+
+func (s *batchStore) StoreBatch(b *Batch) error {
+	s.attempts++
+	if err := s.fail(b); err != nil {
+		return err
+	}
+	s.pods = append(s.pods, b.Pods...)
+	return nil
+}
+
+func (s *batchStore) StoreDeadLetters(deadLetters []*DeadLetter) error {
+	s.deadLetters = append(s.deadLetters, deadLetters...)
+	return nil
+}
+
+func addPods(objectStore *ObjectStore, names ...string) {
+	for _, name := range names {
+		objectStore.Add(&k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID("uid-" + name),
+		}}, "namespaces/default/pods/"+name+".yaml")
+	}
+}
+
+func TestCommitRejectsOnlyTheFailingObjects(t *testing.T) {
+	errBadRow := errors.New("bad row")
+	store := &batchStore{fail: func(b *Batch) error {
+		for _, pod := range b.Pods {
+			if pod.Name == "bad" {
+				return errBadRow
+			}
+		}
+		return nil
+	}}
+	objectStore := NewObjectStore(store, "case")
+	addPods(objectStore, "a", "b", "bad", "c", "d", "e", "f")
+
+	counts, failed, err := objectStore.Commit()
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if failed != 1 || counts["pods"] != 6 {
+		t.Errorf("Commit() = %d pods stored, %d failed, want 6 and 1", counts["pods"], failed)
+	}
+	if len(store.pods) != 6 {
+		t.Errorf("stored %d pods, want 6", len(store.pods))
+	}
+	for _, pod := range store.pods {
+		if pod.Name == "bad" {
+			t.Errorf("the rejected pod was stored")
+		}
+	}
+	if len(store.deadLetters) != 1 {
+		t.Fatalf("recorded %d dead letters, want 1", len(store.deadLetters))
+	}
+	deadLetter := store.deadLetters[0]
+	if deadLetter.Name != "bad" || deadLetter.Error != errBadRow.Error() || deadLetter.Source != "namespaces/default/pods/bad.yaml" {
+		t.Errorf("dead letter = %+v, want the bad pod with its own error and source", deadLetter)
+	}
+}
+
+func TestCommitRetriesTransientFailures(t *testing.T) {
+	store := &batchStore{}
+	store.fail = func(b *Batch) error {
+		if store.attempts == 1 {
+			return driver.ErrBadConn
+		}
+		return nil
+	}
+	objectStore := NewObjectStore(store, "case")
+	objectStore.retries = workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond)
+	addPods(objectStore, "a", "b")
+
+	counts, failed, err := objectStore.Commit()
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if store.attempts != 2 || failed != 0 || counts["pods"] != 2 {
+		t.Errorf("Commit() = %d pods stored, %d failed in %d attempts, want 2, 0 and 2", counts["pods"], failed, store.attempts)
+	}
+}
+
+func TestCommitKeepsUnconvertibleObjectsAsDeadLetters(t *testing.T) {
+	store := &batchStore{fail: func(b *Batch) error { return nil }}
+	objectStore := NewObjectStore(store, "case")
+	addPods(objectStore, "a")
+	objectStore.Add(&k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "no-uid", Namespace: "default"}}, "namespaces/default/pods/no-uid.yaml")
+	objectStore.Fail("Node", "cluster-scoped-resources/core/nodes/broken.yaml", errors.New("invalid yaml"))
+
+	counts, failed, err := objectStore.Commit()
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if failed != 2 || counts["pods"] != 1 {
+		t.Errorf("Commit() = %d pods stored, %d failed, want 1 and 2", counts["pods"], failed)
+	}
+	if len(store.deadLetters) != 2 {
+		t.Fatalf("recorded %d dead letters, want 2", len(store.deadLetters))
+	}
+	if deadLetter := store.deadLetters[0]; deadLetter.Name != "no-uid" || deadLetter.Error != errMissingUID.Error() || deadLetter.Source != "namespaces/default/pods/no-uid.yaml" {
+		t.Errorf("dead letter = %+v, want the pod without a uid", deadLetter)
+	}
+	if deadLetter := store.deadLetters[1]; deadLetter.Kind != "Node" || deadLetter.Source != "cluster-scoped-resources/core/nodes/broken.yaml" {
+		t.Errorf("dead letter = %+v, want the unreadable node file", deadLetter)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{errors.New("UNIQUE constraint failed"), false},
+		{errMissingUID, false},
+	} {
+		if got := isTransient(tc.err); got != tc.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestCommitGivesUpOnPersistentTransientFailures(t *testing.T) {
+	store := &batchStore{fail: func(b *Batch) error { return driver.ErrBadConn }}
+	objectStore := NewObjectStore(store, "case")
+	objectStore.retries = workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond)
+	addPods(objectStore, "a", "b")
+
+	_, failed, err := objectStore.Commit()
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("Commit() error = %v, want the transient error", err)
+	}
+	// the batch is not split, every object becomes a dead letter
+	if store.attempts != commitAttempts || failed != 2 || len(store.deadLetters) != 2 {
+		t.Errorf("Commit() = %d failed in %d attempts, want 2 in %d", failed, store.attempts, commitAttempts)
+	}
+}
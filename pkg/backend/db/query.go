@@ -0,0 +1,57 @@
+package db
+
+import (
+	"strings"
+)
+
+// selectQuery is a SELECT statement assembled from a fixed base and WHERE
+// conditions. Every value is carried in args and bound as a placeholder,
+// never formatted into the SQL text.
+type selectQuery struct {
+	base       string
+	conditions []string
+	args       []interface{}
+	suffix     string
+	suffixArgs []interface{}
+}
+
+func newSelectQuery(base string) *selectQuery {
+	return &selectQuery{base: base}
+}
+
+// Where adds a condition joined with AND. The condition must only contain
+// column names and "?" placeholders, one for each of args.
+func (q *selectQuery) Where(condition string, args ...interface{}) *selectQuery {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+	return q
+}
+
+// Suffix appends a trailing clause such as ORDER BY or LIMIT, with its own
+// placeholder values.
+func (q *selectQuery) Suffix(clause string, args ...interface{}) *selectQuery {
+	q.suffix = strings.TrimSpace(q.suffix + " " + clause)
+	q.suffixArgs = append(q.suffixArgs, args...)
+	return q
+}
+
+// filtered renders the statement without the suffix, e.g. for counting rows.
+func (q *selectQuery) filtered() string {
+	if len(q.conditions) == 0 {
+		return q.base
+	}
+	return q.base + " where " + strings.Join(q.conditions, " AND ")
+}
+
+func (q *selectQuery) String() string {
+	if q.suffix == "" {
+		return q.filtered()
+	}
+	return q.filtered() + " " + q.suffix
+}
+
+func (q *selectQuery) Args() []interface{} {
+	args := make([]interface{}, 0, len(q.args)+len(q.suffixArgs))
+	args = append(args, q.args...)
+	return append(args, q.suffixArgs...)
+}
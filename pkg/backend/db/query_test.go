@@ -0,0 +1,234 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// injectionPayloads are names that change a query built by concatenation.
+var injectionPayloads = []string{
+	"x'",
+	"x' OR '1'='1",
+	"x\" OR \"1\"=\"1",
+	"x'; DROP TABLE pods; --",
+	"x; DELETE FROM vmis",
+	"x -- comment",
+	"%",
+	"_",
+	"x%",
+	"x_y",
+	`x\`,
+}
+
+// newInjectionStore stores a pod, a VMI and a migration named after every
+// payload, one named "x" the payloads must not reach, and the virt-handler of
+// their node.
+func newInjectionStore(t *testing.T) Store {
+	t.Helper()
+	store := newTestStore(t)
+	created := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.StorePod(testPod("virt-handler-abcde", "openshift-cnv", created)); err != nil {
+		t.Fatalf("StorePod(virt-handler) error = %v", err)
+	}
+	for _, name := range append([]string{"x"}, injectionPayloads...) {
+		if err := store.StorePod(testPod(name, "default", created)); err != nil {
+			t.Fatalf("StorePod(%q) error = %v", name, err)
+		}
+		if err := store.StoreVmi(&VirtualMachineInstance{
+			Name:         name,
+			Namespace:    "default",
+			UUID:         "vmi-" + name,
+			Phase:        "Running",
+			NodeName:     "node01",
+			CreationTime: metav1.NewTime(created),
+			Content:      []byte("{}"),
+		}); err != nil {
+			t.Fatalf("StoreVmi(%q) error = %v", name, err)
+		}
+		if err := store.StoreVmiMigration(&VirtualMachineInstanceMigration{
+			Name:         "migration-" + name,
+			Namespace:    "default",
+			UUID:         "vmim-" + name,
+			Phase:        "Succeeded",
+			VMIName:      name,
+			CreationTime: metav1.NewTime(created.Add(time.Hour)),
+			Content:      []byte("{}"),
+		}); err != nil {
+			t.Fatalf("StoreVmiMigration(%q) error = %v", name, err)
+		}
+	}
+	return store
+}
+
+func listNames(t *testing.T, results map[string]interface{}, column string) []string {
+	t.Helper()
+	names := []string{}
+	for _, record := range results["data"].([]map[string]interface{}) {
+		names = append(names, record[column].(string))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func assertNames(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Errorf("%s = %q, want %q", what, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s = %q, want %q", what, got, want)
+			return
+		}
+	}
+}
+
+func assertTablesIntact(t *testing.T, store Store) {
+	t.Helper()
+	rows := len(injectionPayloads) + 1
+	pods, err := store.GetPods(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	vmis, err := store.GetVmis(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetVmis() error = %v", err)
+	}
+	migrations, err := store.GetVmiMigrations(DefaultListOptions(), nil)
+	if err != nil {
+		t.Fatalf("GetVmiMigrations() error = %v", err)
+	}
+	for table, results := range map[string]map[string]interface{}{"pods": pods, "vmis": vmis, "vmimigrations": migrations} {
+		want := rows
+		if table == "pods" {
+			// and the virt-handler
+			want++
+		}
+		if got := len(results["data"].([]map[string]interface{})); got != want {
+			t.Errorf("%s has %d rows, want %d", table, got, want)
+		}
+	}
+}
+
+func TestStoreKeepsPayloadsVerbatim(t *testing.T) {
+	store := newInjectionStore(t)
+	pods, err := store.GetPods(DefaultListOptions())
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	assertNames(t, "GetPods()", listNames(t, pods, "name"), append([]string{"x", "virt-handler-abcde"}, injectionPayloads...)...)
+	assertTablesIntact(t, store)
+}
+
+func TestListFiltersMatchPayloadsExactly(t *testing.T) {
+	store := newInjectionStore(t)
+	for _, payload := range injectionPayloads {
+		opts := DefaultListOptions()
+		opts.Filters = map[string]string{"name": payload}
+		pods, err := store.GetPods(opts)
+		if err != nil {
+			t.Fatalf("GetPods(name=%q) error = %v", payload, err)
+		}
+		assertNames(t, "GetPods(name="+payload+")", listNames(t, pods, "name"), payload)
+
+		opts.Filters = map[string]string{"namespace": payload}
+		vmis, err := store.GetVmis(opts)
+		if err != nil {
+			t.Fatalf("GetVmis(namespace=%q) error = %v", payload, err)
+		}
+		assertNames(t, "GetVmis(namespace="+payload+")", listNames(t, vmis, "name"))
+	}
+	assertTablesIntact(t, store)
+}
+
+func TestListSearchTreatsWildcardsLiterally(t *testing.T) {
+	store := newInjectionStore(t)
+	for _, tc := range []struct {
+		search string
+		want   []string
+	}{
+		{"%", []string{"%", "x%"}},
+		{"_", []string{"_", "x_y"}},
+		{"x_", []string{"x_y"}},
+		{"'", []string{"x'", "x' OR '1'='1", "x'; DROP TABLE pods; --"}},
+		{"--", []string{"x'; DROP TABLE pods; --", "x -- comment"}},
+		{";", []string{"x'; DROP TABLE pods; --", "x; DELETE FROM vmis"}},
+		{"' OR '1'='1' --", nil},
+	} {
+		opts := DefaultListOptions()
+		opts.Search = tc.search
+		pods, err := store.GetPods(opts)
+		if err != nil {
+			t.Fatalf("GetPods(search=%q) error = %v", tc.search, err)
+		}
+		assertNames(t, "GetPods(search="+tc.search+")", listNames(t, pods, "name"), tc.want...)
+	}
+	assertTablesIntact(t, store)
+}
+
+func TestListRejectsPayloadColumns(t *testing.T) {
+	store := newInjectionStore(t)
+	for _, payload := range injectionPayloads {
+		opts := DefaultListOptions()
+		opts.Filters = map[string]string{payload: "x"}
+		if _, err := store.GetPods(opts); !errors.Is(err, ErrInvalidListOption) {
+			t.Errorf("GetPods(filter on %q) error = %v, want ErrInvalidListOption", payload, err)
+		}
+		opts = DefaultListOptions()
+		opts.SortBy = payload
+		if _, err := store.GetVmiMigrations(opts, nil); !errors.Is(err, ErrInvalidListOption) {
+			t.Errorf("GetVmiMigrations(sort on %q) error = %v, want ErrInvalidListOption", payload, err)
+		}
+	}
+	assertTablesIntact(t, store)
+}
+
+func TestGetVmiMigrationsMatchesPayloadsExactly(t *testing.T) {
+	store := newInjectionStore(t)
+	for _, payload := range injectionPayloads {
+		migrations, err := store.GetVmiMigrations(DefaultListOptions(), &VMIMigrationQueryDetails{Name: payload, Namespace: "default"})
+		if err != nil {
+			t.Fatalf("GetVmiMigrations(%q) error = %v", payload, err)
+		}
+		assertNames(t, "GetVmiMigrations("+payload+")", listNames(t, migrations, "name"), "migration-"+payload)
+
+		migrations, err = store.GetVmiMigrations(DefaultListOptions(), &VMIMigrationQueryDetails{Name: "x", Namespace: payload})
+		if err != nil {
+			t.Fatalf("GetVmiMigrations(namespace %q) error = %v", payload, err)
+		}
+		assertNames(t, "GetVmiMigrations(namespace "+payload+")", listNames(t, migrations, "name"))
+	}
+	assertTablesIntact(t, store)
+}
+
+func TestQueryParamsIgnorePayloads(t *testing.T) {
+	store := newInjectionStore(t)
+	for _, payload := range injectionPayloads {
+		if _, err := store.GetVMIQueryParams(payload, "node01"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetVMIQueryParams(%q) error = %v, want sql.ErrNoRows", payload, err)
+		}
+		// the payload names a node no launcher of vmi-x ran on
+		if _, err := store.GetVMIQueryParams("vmi-x", payload); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetVMIQueryParams(vmi-x, %q) error = %v, want sql.ErrNoRows", payload, err)
+		}
+		if _, err := store.GetMigrationQueryParams(payload); err == nil {
+			t.Errorf("GetMigrationQueryParams(%q) found a migration", payload)
+		}
+
+		results, err := store.GetVMIQueryParams("vmi-"+payload, "node01")
+		if err != nil {
+			t.Fatalf("GetVMIQueryParams(vmi-%s) error = %v", payload, err)
+		}
+		if results.SourcePod != payload || results.SourceHandler != "virt-handler-abcde" {
+			t.Errorf("GetVMIQueryParams(vmi-%s) = %+v, want the launcher %q", payload, results, payload)
+		}
+	}
+	assertTablesIntact(t, store)
+}
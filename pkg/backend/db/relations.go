@@ -0,0 +1,293 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The types of relations, each read as "source <type> target".
+const (
+	relationOwns            = "owns"
+	relationLaunches        = "launches"
+	relationMigrates        = "migrates"
+	relationMigrationTarget = "migration-target"
+	relationRunsOn          = "runs-on"
+	relationHandler         = "handler"
+	relationUsesVolume      = "uses-volume"
+	relationBoundTo         = "bound-to"
+	relationStorageClass    = "storage-class"
+)
+
+// hubRelations point at objects shared by many others, nodes and storage
+// classes; GetRelatedObjects only follows them back from the object it
+// starts from, so that a node does not relate every pod it runs.
+var hubRelations = []interface{}{relationRunsOn, relationStorageClass}
+
+// MaxRelationDepth bounds how many relations GetRelatedObjects follows.
+const MaxRelationDepth = 5
+
+// RelatedObjects are the objects found by following the relations of an
+// object, each with the number of relations it is away from it.
+type RelatedObjects struct {
+	UID       string          `json:"uid"`
+	Depth     int             `json:"depth"`
+	Objects   []RelatedObject `json:"objects"`
+	Relations []Relation      `json:"relations"`
+}
+
+// RelatedObject is an object of the graph. Name and namespace are empty for
+// objects that were not collected in the must-gather, e.g. the ReplicaSet
+// owning a pod.
+type RelatedObject struct {
+	UID       string `json:"uid"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Depth     int    `json:"depth"`
+}
+
+// newOwnerRelations returns the relations of obj to its owners.
+func newOwnerRelations(obj metav1.Object, kind string) []*Relation {
+	relations := []*Relation{}
+	for _, owner := range obj.GetOwnerReferences() {
+		relations = append(relations, &Relation{
+			SourceUID:  string(owner.UID),
+			SourceKind: owner.Kind,
+			TargetUID:  string(obj.GetUID()),
+			TargetKind: kind,
+			Type:       relationOwns,
+		})
+	}
+	return relations
+}
+
+// linkObjects adds the relations the objects of the batch have by name: the
+// launcher pods of VMIs, the VMI and target pod of migrations, where pods
+// and VMIs run, the virt-handler of every node and the storage chain of the
+// volumes.
+func linkObjects(batch *Batch) {
+	nodes := map[string]string{}
+	for _, node := range batch.Nodes {
+		nodes[node.Name] = node.UUID
+	}
+	pods := map[string]string{}
+	for _, pod := range batch.Pods {
+		pods[pod.Namespace+"/"+pod.Name] = pod.UUID
+	}
+	vmis := map[string]string{}
+	for _, vmi := range batch.Vmis {
+		vmis[vmi.Namespace+"/"+vmi.Name] = vmi.UUID
+	}
+	dataVolumes := map[string]string{}
+	for _, dv := range batch.DataVolumes {
+		dataVolumes[dv.Namespace+"/"+dv.Name] = dv.UUID
+	}
+	pvcs := map[string]string{}
+	for _, pvc := range batch.PVCs {
+		pvcs[pvc.Namespace+"/"+pvc.Name] = pvc.UUID
+	}
+	pvs := map[string]string{}
+	for _, pv := range batch.PVs {
+		pvs[pv.Name] = pv.UUID
+	}
+	storageClasses := map[string]string{}
+	for _, sc := range batch.StorageClasses {
+		storageClasses[sc.Name] = sc.UUID
+	}
+
+	seen := map[Relation]bool{}
+	relations := []*Relation{}
+	link := func(sourceUID string, sourceKind string, targetUID string, targetKind string, relationType string) {
+		relation := Relation{SourceUID: sourceUID, SourceKind: sourceKind, TargetUID: targetUID, TargetKind: targetKind, Type: relationType}
+		// both ends must be known, and a multi-row upsert must not hit a
+		// row twice
+		if sourceUID == "" || targetUID == "" || seen[relation] {
+			return
+		}
+		seen[relation] = true
+		relations = append(relations, &relation)
+	}
+
+	for _, relation := range batch.Relations {
+		link(relation.SourceUID, relation.SourceKind, relation.TargetUID, relation.TargetKind, relation.Type)
+	}
+	for _, pod := range batch.Pods {
+		link(pod.CreatedBy, "VirtualMachineInstance", pod.UUID, "Pod", relationLaunches)
+		link(pod.UUID, "Pod", nodes[pod.NodeName], "Node", relationRunsOn)
+		if strings.HasPrefix(pod.Name, strings.TrimSuffix(virtHandlerNamePattern, "%")) {
+			link(nodes[pod.NodeName], "Node", pod.UUID, "Pod", relationHandler)
+		}
+	}
+	for _, vmi := range batch.Vmis {
+		link(vmi.UUID, "VirtualMachineInstance", nodes[vmi.NodeName], "Node", relationRunsOn)
+	}
+	for _, vmim := range batch.VmiMigrations {
+		link(vmim.UUID, "VirtualMachineInstanceMigration", vmis[vmim.Namespace+"/"+vmim.VMIName], "VirtualMachineInstance", relationMigrates)
+		link(vmim.UUID, "VirtualMachineInstanceMigration", pods[vmim.Namespace+"/"+vmim.TargetPod], "Pod", relationMigrationTarget)
+	}
+	for _, volume := range batch.Volumes {
+		if volume.DataVolumeName != "" {
+			link(volume.OwnerUID, volume.OwnerKind, dataVolumes[volume.Namespace+"/"+volume.DataVolumeName], "DataVolume", relationUsesVolume)
+		}
+		link(volume.OwnerUID, volume.OwnerKind, pvcs[volume.Namespace+"/"+volume.ClaimName], "PersistentVolumeClaim", relationUsesVolume)
+	}
+	for _, pvc := range batch.PVCs {
+		link(pvc.UUID, "PersistentVolumeClaim", pvs[pvc.VolumeName], "PersistentVolume", relationBoundTo)
+		link(pvc.UUID, "PersistentVolumeClaim", storageClasses[pvc.StorageClass], "StorageClass", relationStorageClass)
+	}
+	for _, pv := range batch.PVs {
+		link(pv.UUID, "PersistentVolume", storageClasses[pv.StorageClass], "StorageClass", relationStorageClass)
+	}
+	batch.Relations = relations
+}
+
+// objectTables are the tables GetRelatedObjects looks the objects up in, with
+// the kind and namespace of their rows.
+var objectTables = []struct {
+	table     string
+	kind      string
+	namespace string
+}{
+	{"pods", "'Pod'", "namespace"},
+	{"vmis", "'VirtualMachineInstance'", "namespace"},
+	{"vmimigrations", "'VirtualMachineInstanceMigration'", "namespace"},
+	{"vms", "'VirtualMachine'", "namespace"},
+	{"nodes", "'Node'", "''"},
+	{"datavolumes", "'DataVolume'", "namespace"},
+	{"pvcs", "'PersistentVolumeClaim'", "namespace"},
+	{"pvs", "'PersistentVolume'", "''"},
+	{"storageclasses", "'StorageClass'", "''"},
+	{"components", "kind", "namespace"},
+	{"resources", "kind", "namespace"},
+}
+
+// GetRelatedObjects follows the relations of an object, in both directions,
+// up to depth relations away.
+func (d *databaseInstance) GetRelatedObjects(uid string, depth int) (*RelatedObjects, error) {
+	if depth < 1 || depth > MaxRelationDepth {
+		return nil, fmt.Errorf("%w: depth must be between 1 and %d", ErrInvalidListOption, MaxRelationDepth)
+	}
+	related := &RelatedObjects{UID: uid, Depth: depth, Objects: []RelatedObject{}, Relations: []Relation{}}
+
+	depths := map[string]int{uid: 0}
+	kinds := map[string]string{}
+	seen := map[Relation]bool{}
+	frontier := []string{uid}
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		relations, err := d.getRelations(frontier, level == 1)
+		if err != nil {
+			return nil, err
+		}
+		next := []string{}
+		for _, relation := range relations {
+			if seen[relation] {
+				continue
+			}
+			seen[relation] = true
+			related.Relations = append(related.Relations, relation)
+			kinds[relation.SourceUID] = relation.SourceKind
+			kinds[relation.TargetUID] = relation.TargetKind
+			for _, end := range []string{relation.SourceUID, relation.TargetUID} {
+				if _, ok := depths[end]; !ok {
+					depths[end] = level
+					next = append(next, end)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	uids := make([]interface{}, 0, len(depths))
+	for objectUID := range depths {
+		uids = append(uids, objectUID)
+	}
+	objects, err := d.getObjects(uids)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := objects[uid]; !ok && len(related.Relations) == 0 {
+		return nil, fmt.Errorf("%w: object %s", ErrNotFound, uid)
+	}
+
+	for objectUID, objectDepth := range depths {
+		object := objects[objectUID]
+		object.UID = objectUID
+		object.Depth = objectDepth
+		// the relations carry the kinds of objects that were not collected,
+		// and of the resources read generically
+		if kind, ok := kinds[objectUID]; ok {
+			object.Kind = kind
+		}
+		related.Objects = append(related.Objects, object)
+	}
+	sort.Slice(related.Objects, func(i, j int) bool {
+		a, b := related.Objects[i], related.Objects[j]
+		if a.Depth != b.Depth {
+			return a.Depth < b.Depth
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return related, nil
+}
+
+// getRelations returns the relations of the objects of uids. Relations back
+// to them through a hub are only returned with hubs set.
+func (d *databaseInstance) getRelations(uids []string, hubs bool) ([]Relation, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(uids)), ", ")
+	args := []interface{}{d.caseID}
+	for _, uid := range uids {
+		args = append(args, uid)
+	}
+	targetCondition := "targetUID in (" + placeholders + ")"
+	for _, uid := range uids {
+		args = append(args, uid)
+	}
+	if !hubs {
+		targetCondition += " AND type not in (" + strings.TrimSuffix(strings.Repeat("?, ", len(hubRelations)), ", ") + ")"
+		args = append(args, hubRelations...)
+	}
+
+	records, err := d.queryRecords("select sourceUID, sourceKind, targetUID, targetKind, type from relations where caseId=? AND (sourceUID in ("+placeholders+") OR ("+targetCondition+"))", args...)
+	if err != nil {
+		return nil, err
+	}
+	relations := make([]Relation, 0, len(records))
+	for _, record := range records {
+		relations = append(relations, Relation{
+			SourceUID:  recordString(record, "sourceUID"),
+			SourceKind: recordString(record, "sourceKind"),
+			TargetUID:  recordString(record, "targetUID"),
+			TargetKind: recordString(record, "targetKind"),
+			Type:       recordString(record, "type"),
+		})
+	}
+	return relations, nil
+}
+
+// getObjects looks the objects of uids up in every object table.
+func (d *databaseInstance) getObjects(uids []interface{}) (map[string]RelatedObject, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(uids)), ", ")
+	args := append([]interface{}{d.caseID}, uids...)
+
+	objects := map[string]RelatedObject{}
+	for _, t := range objectTables {
+		records, err := d.queryRecords(fmt.Sprintf("select uuid, %s as kind, name, %s as namespace from %s where caseId=? AND uuid in (%s)", t.kind, t.namespace, t.table, placeholders), args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			objects[recordString(record, "uuid")] = RelatedObject{
+				Kind:      recordString(record, "kind"),
+				Name:      recordString(record, "name"),
+				Namespace: recordString(record, "namespace"),
+			}
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newRelationStore stores two VMIs running on node01 with their launcher
+// pods, the virt-handler of the node, and the VM and DaemonSet owning them.
+func newRelationStore(t *testing.T) Store {
+	t.Helper()
+	store := newTestStore(t)
+	created := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	batch := &Batch{
+		Nodes: []*Node{{Name: "node01", UUID: "node-1", CreationTime: metav1.NewTime(created), Content: []byte("{}")}},
+		Vms:   []*VirtualMachine{{Name: "vm1", Namespace: "default", UUID: "vm-1", CreationTime: metav1.NewTime(created), Content: []byte("{}")}},
+		Relations: []*Relation{
+			{SourceUID: "vm-1", SourceKind: "VirtualMachine", TargetUID: "vmi-1", TargetKind: "VirtualMachineInstance", Type: relationOwns},
+			// the DaemonSet was not collected
+			{SourceUID: "ds-1", SourceKind: "DaemonSet", TargetUID: "pod-virt-handler-abcde", TargetKind: "Pod", Type: relationOwns},
+		},
+	}
+	for _, name := range []string{"vm1", "vm2"} {
+		batch.Vmis = append(batch.Vmis, &VirtualMachineInstance{
+			Name:         name,
+			Namespace:    "default",
+			UUID:         "vmi-" + name[2:],
+			NodeName:     "node01",
+			CreationTime: metav1.NewTime(created),
+			Content:      []byte("{}"),
+		})
+		launcher := testPod("virt-launcher-"+name, "default", created)
+		launcher.CreatedBy = "vmi-" + name[2:]
+		batch.Pods = append(batch.Pods, launcher)
+	}
+	handler := testPod("virt-handler-abcde", "openshift-cnv", created)
+	handler.CreatedBy = ""
+	batch.Pods = append(batch.Pods, handler)
+
+	linkObjects(batch)
+	if err := store.StoreBatch(batch); err != nil {
+		t.Fatalf("StoreBatch() error = %v", err)
+	}
+	return store
+}
+
+// objectDepths returns the depth of every related object by kind and name,
+// or UID for the objects that were not collected.
+func objectDepths(related *RelatedObjects) map[string]int {
+	depths := map[string]int{}
+	for _, object := range related.Objects {
+		name := object.Name
+		if name == "" {
+			name = object.UID
+		}
+		depths[object.Kind+" "+name] = object.Depth
+	}
+	return depths
+}
+
+func TestGetRelatedObjects(t *testing.T) {
+	store := newRelationStore(t)
+	direct := map[string]int{
+		"VirtualMachineInstance vm1": 0,
+		"VirtualMachine vm1":         1,
+		"Node node01":                1,
+		"Pod virt-launcher-vm1":      1,
+	}
+	withDepth := func(objects map[string]int, more map[string]int) map[string]int {
+		merged := map[string]int{}
+		for _, m := range []map[string]int{objects, more} {
+			for name, depth := range m {
+				merged[name] = depth
+			}
+		}
+		return merged
+	}
+
+	for _, tc := range []struct {
+		name  string
+		uid   string
+		depth int
+		want  map[string]int
+	}{
+		{"direct relations", "vmi-1", 1, direct},
+		// the node leads to its virt-handler, not back to vm2 and the other
+		// pods running on it
+		{"hubs are not followed back past the start", "vmi-1", 2, withDepth(direct, map[string]int{
+			"Pod virt-handler-abcde": 2,
+		})},
+		{"objects that were not collected", "vmi-1", MaxRelationDepth, withDepth(direct, map[string]int{
+			"Pod virt-handler-abcde": 2,
+			"DaemonSet ds-1":         3,
+		})},
+		{"hubs are followed back from the start", "node-1", 1, map[string]int{
+			"Node node01":                0,
+			"VirtualMachineInstance vm1": 1,
+			"VirtualMachineInstance vm2": 1,
+			"Pod virt-launcher-vm1":      1,
+			"Pod virt-launcher-vm2":      1,
+			"Pod virt-handler-abcde":     1,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			related, err := store.GetRelatedObjects(tc.uid, tc.depth)
+			if err != nil {
+				t.Fatalf("GetRelatedObjects() error = %v", err)
+			}
+			if got := objectDepths(related); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GetRelatedObjects(%s, %d) = %v, want %v", tc.uid, tc.depth, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetRelatedObjectsRejectsInvalidRequests(t *testing.T) {
+	store := newRelationStore(t)
+	for _, depth := range []int{0, MaxRelationDepth + 1} {
+		if _, err := store.GetRelatedObjects("vmi-1", depth); !errors.Is(err, ErrInvalidListOption) {
+			t.Errorf("GetRelatedObjects() with depth %d error = %v, want ErrInvalidListOption", depth, err)
+		}
+	}
+	if _, err := store.GetRelatedObjects("missing", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRelatedObjects() of a missing object error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.ForCase("other").GetRelatedObjects("vmi-1", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRelatedObjects() of another case error = %v, want ErrNotFound", err)
+	}
+}
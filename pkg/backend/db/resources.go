@@ -0,0 +1,55 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resourceListSpec returns the list spec of a kind read generically: the
+// common columns and the extracted ones, which are all strings.
+func resourceListSpec(fields []string) listSpec {
+	spec := listSpec{
+		columns: map[string]columnKind{
+			"uuid":         stringColumn,
+			"name":         stringColumn,
+			"namespace":    stringColumn,
+			"creationTime": timeColumn,
+		},
+		searchColumn: "name",
+		timeColumn:   "creationTime",
+		keyColumn:    "uuid",
+	}
+	for _, field := range fields {
+		spec.columns[field] = stringColumn
+	}
+	return spec
+}
+
+// GetResources lists the objects of a kind read generically, with the fields
+// extracted from them as columns. fields must be the column names of the
+// kind, see resources.Kind, as they are formatted into the query.
+func (d *databaseInstance) GetResources(kind string, fields []string, opts ListOptions) (map[string]interface{}, error) {
+	columns := []string{"uuid", "name", "namespace", "creationTime"}
+	extracted := []string{"caseId", "kind", "uuid", "name", "namespace", "creationTime"}
+	for _, field := range fields {
+		columns = append(columns, field)
+		extracted = append(extracted, fmt.Sprintf("%s as %s", d.dialect.jsonText("fields", field), field))
+	}
+	query := d.newCaseQuery(fmt.Sprintf("select %s from (select %s from resources) resourcesWithFields",
+		strings.Join(columns, ", "), strings.Join(extracted, ", "))).Where("kind=?", kind)
+	return d.genericGet(query, opts, resourceListSpec(fields))
+}
+
+// GetResource returns an object of a kind read generically, with its fields
+// and content.
+func (d *databaseInstance) GetResource(kind string, uid string) (map[string]interface{}, error) {
+	resource, err := d.queryRecord("select kind, uuid, name, namespace, creationTime, fields, content from resources where caseId=? AND kind=? AND uuid=?", d.caseID, kind, uid)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotFound, kind, uid)
+	}
+	decodeRecordJSON(resource, "fields", "content")
+	return resource, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"logsviewer/pkg/backend/log"
+
+	_ "modernc.org/sqlite"
+)
+
+// NewSQLiteInstance opens (or creates) an embedded SQLite database at
+// cfg.Path. Use ":memory:" for a throwaway database, e.g. in tests.
+// No external database is needed; the schema is created by InitTables.
+func NewSQLiteInstance(cfg Config) (*databaseInstance, error) {
+	cfg = cfg.withDefaults()
+	path := cfg.Path
+	if path == "" {
+		path = defaultSQLitePath
+	}
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	dbInstance := &databaseInstance{
+		dbName:       path,
+		dsn:          path,
+		dialect:      sqliteDialect,
+		caseID:       DefaultCaseID,
+		queryTimeout: cfg.QueryTimeout.Duration,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	dbInstance.ctx = ctx
+	dbInstance.cancel = cancel
+	if err := dbInstance.connect(); err != nil {
+		log.Log.Println("failed to open sqlite db: ", err)
+		return nil, err
+	}
+
+	// SQLite allows a single writer; serializing on one connection also keeps
+	// an in-memory database alive for the lifetime of the instance.
+	dbInstance.db.SetMaxOpenConns(1)
+	if _, err := dbInstance.db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		dbInstance.Shutdown()
+		return nil, fmt.Errorf("failed to configure sqlite db: %v", err)
+	}
+	return dbInstance, nil
+}
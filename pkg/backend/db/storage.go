@@ -0,0 +1,203 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VMIStorage follows the volumes of a VMI down to the storage backing them.
+type VMIStorage struct {
+	VMIUUID   string          `json:"vmiUUID"`
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace"`
+	Volumes   []StorageVolume `json:"volumes"`
+	// ClaimNames and PodNames collect the claims and CDI pods of all
+	// volumes, and Since is the creation of the oldest claim or DataVolume,
+	// so that callers can look up their logs.
+	ClaimNames []string  `json:"claimNames"`
+	PodNames   []string  `json:"podNames"`
+	Since      time.Time `json:"since"`
+}
+
+// StorageVolume is the chain behind a single volume: volume, DataVolume,
+// PVC, PV and storage class, together with the CDI importer and upload pods
+// that populated the claim. Links whose objects were not collected in the
+// must-gather are left empty.
+type StorageVolume struct {
+	Name         string                   `json:"name"`
+	ClaimName    string                   `json:"claimName"`
+	DataVolume   map[string]interface{}   `json:"dataVolume,omitempty"`
+	PVC          map[string]interface{}   `json:"pvc,omitempty"`
+	PV           map[string]interface{}   `json:"pv,omitempty"`
+	StorageClass map[string]interface{}   `json:"storageClass,omitempty"`
+	Pods         []map[string]interface{} `json:"pods"`
+}
+
+const (
+	dataVolumeListQuery   = "select uuid, name, namespace, phase, progress, restartCount, sourceType, claimName, storageClass, creationTime, conditions from datavolumes"
+	pvcListQuery          = "select uuid, name, namespace, phase, volumeName, storageClass, capacity, volumeMode, accessModes, importPod, uploadPod, creationTime from pvcs"
+	pvListQuery           = "select uuid, name, phase, storageClass, capacity, claimNamespace, claimName, driver, volumeHandle, creationTime from pvs"
+	storageClassListQuery = "select uuid, name, provisioner, reclaimPolicy, volumeBindingMode, allowVolumeExpansion, isDefault, parameters, creationTime from storageclasses"
+)
+
+func (d *databaseInstance) GetDataVolumes(opts ListOptions) (map[string]interface{}, error) {
+	resultsMap, err := d.genericGet(d.newCaseQuery(dataVolumeListQuery), opts, dataVolumeListSpec)
+	if err != nil {
+		return nil, err
+	}
+	decodeJSONColumns(resultsMap, "conditions")
+	return resultsMap, nil
+}
+
+func (d *databaseInstance) GetPVCs(opts ListOptions) (map[string]interface{}, error) {
+	resultsMap, err := d.genericGet(d.newCaseQuery(pvcListQuery), opts, pvcListSpec)
+	if err != nil {
+		return nil, err
+	}
+	decodeJSONColumns(resultsMap, "accessModes")
+	return resultsMap, nil
+}
+
+func (d *databaseInstance) GetPVs(opts ListOptions) (map[string]interface{}, error) {
+	return d.genericGet(d.newCaseQuery(pvListQuery), opts, pvListSpec)
+}
+
+func (d *databaseInstance) GetStorageClasses(opts ListOptions) (map[string]interface{}, error) {
+	resultsMap, err := d.genericGet(d.newCaseQuery(storageClassListQuery), opts, storageClassListSpec)
+	if err != nil {
+		return nil, err
+	}
+	decodeJSONColumns(resultsMap, "parameters")
+	return resultsMap, nil
+}
+
+// GetVMIStorage resolves the storage chain of every volume of a VMI that is
+// backed by a claim, directly or through a DataVolume.
+func (d *databaseInstance) GetVMIStorage(vmiUUID string) (*VMIStorage, error) {
+	vmi, err := d.queryRecord("select name, namespace from vmis where caseId=? AND uuid=?", d.caseID, vmiUUID)
+	if err != nil {
+		return nil, err
+	}
+	if vmi == nil {
+		return nil, fmt.Errorf("%w: vmi %s", ErrNotFound, vmiUUID)
+	}
+	storage := &VMIStorage{
+		VMIUUID:    vmiUUID,
+		Name:       recordString(vmi, "name"),
+		Namespace:  recordString(vmi, "namespace"),
+		Volumes:    []StorageVolume{},
+		ClaimNames: []string{},
+		PodNames:   []string{},
+	}
+
+	volumes, err := d.queryRecords("select name, claimName, dataVolumeName from volumes where caseId=? AND ownerUID=? ORDER BY name ASC", d.caseID, vmiUUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes {
+		chain, err := d.getStorageVolume(storage.Namespace, recordString(volume, "name"), recordString(volume, "claimName"), recordString(volume, "dataVolumeName"))
+		if err != nil {
+			return nil, err
+		}
+		storage.Volumes = append(storage.Volumes, *chain)
+		storage.ClaimNames = append(storage.ClaimNames, chain.ClaimName)
+		for _, pod := range chain.Pods {
+			storage.PodNames = append(storage.PodNames, recordString(pod, "name"))
+		}
+		for _, record := range []map[string]interface{}{chain.DataVolume, chain.PVC} {
+			if created := parseDBTime(record["creationTime"]); !created.IsZero() && (storage.Since.IsZero() || created.Before(storage.Since)) {
+				storage.Since = created
+			}
+		}
+	}
+	return storage, nil
+}
+
+func (d *databaseInstance) getStorageVolume(namespace string, name string, claimName string, dataVolumeName string) (*StorageVolume, error) {
+	chain := &StorageVolume{Name: name, ClaimName: claimName, Pods: []map[string]interface{}{}}
+
+	var err error
+	if dataVolumeName != "" {
+		if chain.DataVolume, err = d.queryRecord(dataVolumeListQuery+" where caseId=? AND namespace=? AND name=?", d.caseID, namespace, dataVolumeName); err != nil {
+			return nil, err
+		}
+		if claim := recordString(chain.DataVolume, "claimName"); claim != "" {
+			chain.ClaimName = claim
+		}
+		decodeRecordJSON(chain.DataVolume, "conditions")
+	}
+
+	if chain.PVC, err = d.queryRecord(pvcListQuery+" where caseId=? AND namespace=? AND name=?", d.caseID, namespace, chain.ClaimName); err != nil {
+		return nil, err
+	}
+	decodeRecordJSON(chain.PVC, "accessModes")
+
+	// a claim that is not bound yet is still referenced by a pre-bound PV
+	if volumeName := recordString(chain.PVC, "volumeName"); volumeName != "" {
+		chain.PV, err = d.queryRecord(pvListQuery+" where caseId=? AND name=?", d.caseID, volumeName)
+	} else {
+		chain.PV, err = d.queryRecord(pvListQuery+" where caseId=? AND claimNamespace=? AND claimName=?", d.caseID, namespace, chain.ClaimName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	storageClass := ""
+	for _, record := range []map[string]interface{}{chain.PVC, chain.PV, chain.DataVolume} {
+		if storageClass = recordString(record, "storageClass"); storageClass != "" {
+			break
+		}
+	}
+	if storageClass != "" {
+		if chain.StorageClass, err = d.queryRecord(storageClassListQuery+" where caseId=? AND name=?", d.caseID, storageClass); err != nil {
+			return nil, err
+		}
+		decodeRecordJSON(chain.StorageClass, "parameters")
+	}
+
+	if chain.Pods, err = d.getCDIPods(namespace, chain.ClaimName, chain.PVC); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// getCDIPods returns the importer and upload pods of a claim. CDI annotates
+// the claim with them, but they are named after the claim, or after the
+// prime claim populating it, as well.
+func (d *databaseInstance) getCDIPods(namespace string, claimName string, pvc map[string]interface{}) ([]map[string]interface{}, error) {
+	names := []interface{}{"importer-" + claimName, "cdi-upload-" + claimName}
+	if uid := recordString(pvc, "uuid"); uid != "" {
+		names = append(names, "importer-prime-"+uid, "cdi-upload-prime-"+uid)
+	}
+	for _, column := range []string{"importPod", "uploadPod"} {
+		if name := recordString(pvc, column); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	args := append([]interface{}{d.caseID, namespace}, names...)
+	return d.queryRecords("select uuid, name, namespace, phase, nodeName, creationTime from pods where caseId=? AND namespace=? AND name in ("+placeholders+") ORDER BY creationTime ASC", args...)
+}
+
+// queryRecord runs a query for a single row, returning nil when there is
+// none.
+func (d *databaseInstance) queryRecord(query string, args ...interface{}) (map[string]interface{}, error) {
+	records, err := d.queryRecords(query, args...)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// decodeRecordJSON returns the given columns of a record, stored as JSON, as
+// JSON instead of strings.
+func decodeRecordJSON(record map[string]interface{}, columns ...string) {
+	for _, column := range columns {
+		if value, ok := record[column].(string); ok && json.Valid([]byte(value)) {
+			record[column] = json.RawMessage(value)
+		}
+	}
+}
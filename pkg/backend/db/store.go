@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"logsviewer/pkg/backend/log"
+)
+
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+
+	defaultSQLitePath = "/space/objtracker.db"
+)
+
+// ErrNotFound is returned when a single requested object does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store is the persistence layer behind the object store and the HTTP handlers.
+// The MySQL sidecar and the embedded SQLite database both implement it.
+type Store interface {
+	// ForCase returns a store limited to the objects of a single case.
+	ForCase(caseID string) Store
+	// WithContext returns a store whose statements are canceled with ctx.
+	WithContext(ctx context.Context) Store
+
+	// InitTables migrates the schema to LatestSchemaVersion.
+	InitTables() error
+	// DropTables reverts every migration, leaving an empty database.
+	DropTables() error
+	SchemaVersion() (int, error)
+	MigrateTo(version int) error
+	Shutdown() error
+
+	StorePod(pod *Pod) error
+	StoreVmi(vmi *VirtualMachineInstance) error
+	StoreVmiMigration(vmim *VirtualMachineInstanceMigration) error
+	StoreVm(vm *VirtualMachine) error
+	StoreNode(node *Node) error
+	StoreEvent(event *Event) error
+	// StoreBatch stores all objects of a batch in a single transaction.
+	StoreBatch(batch *Batch) error
+	// StoreDeadLetters records the objects an import failed to store.
+	StoreDeadLetters(deadLetters []*DeadLetter) error
+
+	GetPods(opts ListOptions) (map[string]interface{}, error)
+	GetVmis(opts ListOptions) (map[string]interface{}, error)
+	GetVmiMigrations(opts ListOptions, vmiDetails *VMIMigrationQueryDetails) (map[string]interface{}, error)
+	GetVms(opts ListOptions) (map[string]interface{}, error)
+	GetNodes(opts ListOptions) (map[string]interface{}, error)
+	GetNode(name string) (map[string]interface{}, error)
+	GetObjectEvents(involvedUID string, opts ListOptions) (map[string]interface{}, error)
+	GetVMITimeline(vmiUUID string) (*VMITimeline, error)
+	GetDataVolumes(opts ListOptions) (map[string]interface{}, error)
+	GetPVCs(opts ListOptions) (map[string]interface{}, error)
+	GetPVs(opts ListOptions) (map[string]interface{}, error)
+	GetStorageClasses(opts ListOptions) (map[string]interface{}, error)
+	GetVMIStorage(vmiUUID string) (*VMIStorage, error)
+	// GetResources and GetResource read the objects of kinds read
+	// generically, see package resources.
+	GetResources(kind string, fields []string, opts ListOptions) (map[string]interface{}, error)
+	GetResource(kind string, uid string) (map[string]interface{}, error)
+	// GetRelatedObjects follows the relations of an object, see Relation.
+	GetRelatedObjects(uid string, depth int) (*RelatedObjects, error)
+
+	GetVMIQueryParams(vmiUUID string, nodeName string) (QueryResults, error)
+	GetMigrationQueryParams(migrationUUID string) (QueryResults, error)
+	GetKubeVirtVersion() (string, error)
+	GetClusterInfo() (*ClusterInfo, error)
+	GetDeadLetters() ([]DeadLetter, error)
+
+	CreateCase(c *Case) error
+	GetCases() ([]Case, error)
+	GetCase(id string) (*Case, error)
+	DeleteCase(id string) error
+}
+
+// Config selects the database and where to reach it.
+type Config struct {
+	// Driver is DriverMySQL, the sidecar of the logsviewer pod, or
+	// DriverSQLite for the embedded database.
+	Driver string `json:"driver"`
+	// Path is the SQLite database file.
+	Path     string `json:"path,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Port     string `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Name     string `json:"name,omitempty"`
+
+	// MaxOpenConns and MaxIdleConns size the MySQL connection pool shared
+	// by all requests; SQLite always uses a single connection.
+	MaxOpenConns    int             `json:"maxOpenConns,omitempty"`
+	MaxIdleConns    int             `json:"maxIdleConns,omitempty"`
+	ConnMaxLifetime metav1.Duration `json:"connMaxLifetime,omitempty"`
+	// QueryTimeout bounds every statement.
+	QueryTimeout metav1.Duration `json:"queryTimeout,omitempty"`
+	// ConnectTimeout is how long Open keeps retrying while the database
+	// is still starting.
+	ConnectTimeout metav1.Duration `json:"connectTimeout,omitempty"`
+}
+
+// DefaultConfig is the MySQL sidecar of the logsviewer pod.
+func DefaultConfig() Config {
+	return Config{
+		Driver:   DriverMySQL,
+		Path:     defaultSQLitePath,
+		Host:     "0.0.0.0",
+		Port:     "3306",
+		Username: "mysql",
+		Password: "supersecret",
+		Name:     "objtracker",
+
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: metav1.Duration{Duration: 5 * time.Minute},
+		QueryTimeout:    metav1.Duration{Duration: 5 * time.Second},
+		ConnectTimeout:  metav1.Duration{Duration: 2 * time.Minute},
+	}
+}
+
+// withDefaults fills the pool settings and timeouts left unset.
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.MaxOpenConns <= 0 {
+		c.MaxOpenConns = defaults.MaxOpenConns
+	}
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if c.ConnMaxLifetime.Duration <= 0 {
+		c.ConnMaxLifetime = defaults.ConnMaxLifetime
+	}
+	if c.QueryTimeout.Duration <= 0 {
+		c.QueryTimeout = defaults.QueryTimeout
+	}
+	if c.ConnectTimeout.Duration <= 0 {
+		c.ConnectTimeout = defaults.ConnectTimeout
+	}
+	return c
+}
+
+// NewStore opens the store selected by cfg.Driver.
+func NewStore(cfg Config) (Store, error) {
+	cfg = cfg.withDefaults()
+	switch cfg.Driver {
+	case DriverSQLite:
+		return NewSQLiteInstance(cfg)
+	default:
+		return NewDatabaseInstance(cfg)
+	}
+}
+
+// Open opens the store shared by the whole service. The MySQL sidecar may
+// still be starting along with the service, so failed attempts are retried
+// with an increasing delay until cfg.ConnectTimeout.
+func Open(ctx context.Context, cfg Config) (Store, error) {
+	cfg = cfg.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout.Duration)
+	defer cancel()
+
+	delay := 500 * time.Millisecond
+	for {
+		store, err := NewStore(cfg)
+		if err == nil {
+			return store, nil
+		}
+		log.Log.Println("failed to open the database, retrying in ", delay, " - ", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > 10*time.Second {
+			delay = 10 * time.Second
+		}
+	}
+}
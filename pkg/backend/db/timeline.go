@@ -0,0 +1,238 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// Timeline entry kinds.
+const (
+	TimelineVMI       = "vmi"
+	TimelinePhase     = "phase"
+	TimelineCondition = "condition"
+	TimelinePod       = "pod"
+	TimelineMigration = "migration"
+	TimelineEvent     = "event"
+	TimelineLog       = "log"
+)
+
+// TimelineEntry is a single point in the lifecycle of a VMI.
+type TimelineEntry struct {
+	Time    time.Time              `json:"time"`
+	Kind    string                 `json:"kind"`
+	Name    string                 `json:"name"`
+	Message string                 `json:"message,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// VMITimeline is the lifecycle of a VMI together with the objects it was
+// correlated with, so that callers can look up related data such as logs.
+type VMITimeline struct {
+	VMIUUID   string          `json:"vmiUUID"`
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace"`
+	Created   time.Time       `json:"creationTime"`
+	PodNames  []string        `json:"podNames"`
+	Entries   []TimelineEntry `json:"entries"`
+}
+
+// SortTimeline orders entries by time, keeping the order of simultaneous ones.
+func SortTimeline(entries []TimelineEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+}
+
+// GetVMITimeline merges, in time order, the creation, phase transitions and
+// condition transitions of a VMI, the virt-launcher pods created for it, its
+// migrations and the Kubernetes events of all of them.
+func (d *databaseInstance) GetVMITimeline(vmiUUID string) (*VMITimeline, error) {
+	vmi, err := d.getVMIObject(vmiUUID)
+	if err != nil {
+		return nil, err
+	}
+	timeline := &VMITimeline{
+		VMIUUID:   vmiUUID,
+		Name:      vmi.Name,
+		Namespace: vmi.Namespace,
+		Created:   vmi.CreationTimestamp.Time,
+		PodNames:  []string{},
+	}
+	entries := []TimelineEntry{{
+		Time: vmi.CreationTimestamp.Time,
+		Kind: TimelineVMI,
+		Name: vmi.Name,
+	}}
+	for _, transition := range vmi.Status.PhaseTransitionTimestamps {
+		entries = append(entries, TimelineEntry{
+			Time: transition.PhaseTransitionTimestamp.Time,
+			Kind: TimelinePhase,
+			Name: string(transition.Phase),
+		})
+	}
+	for _, condition := range vmi.Status.Conditions {
+		if condition.LastTransitionTime.IsZero() {
+			continue
+		}
+		entries = append(entries, TimelineEntry{
+			Time:    condition.LastTransitionTime.Time,
+			Kind:    TimelineCondition,
+			Name:    fmt.Sprintf("%s=%s", condition.Type, condition.Status),
+			Message: strings.TrimSpace(condition.Reason + " " + condition.Message),
+		})
+	}
+
+	// the same correlation GetVMIQueryParams uses: launcher pods are created by the VMI
+	involvedUIDs := []string{vmiUUID}
+	pods, err := d.queryRecords("select uuid, name, nodeName, phase, creationTime from pods where caseId=? AND createdBy=?", d.caseID, vmiUUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		name := recordString(pod, "name")
+		timeline.PodNames = append(timeline.PodNames, name)
+		involvedUIDs = append(involvedUIDs, recordString(pod, "uuid"))
+		entries = append(entries, TimelineEntry{
+			Time:    parseDBTime(pod["creationTime"]),
+			Kind:    TimelinePod,
+			Name:    name,
+			Details: pod,
+		})
+	}
+
+	// and migrations refer to the VMI by name, as in GetMigrationQueryParams
+	migrations, err := d.queryRecords("select uuid, name, phase, targetPod, sourceNode, targetNode, creationTime, endTimestamp, completed, failed from vmimigrations where caseId=? AND vmiName=? AND namespace=?", d.caseID, vmi.Name, vmi.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range migrations {
+		name := recordString(migration, "name")
+		involvedUIDs = append(involvedUIDs, recordString(migration, "uuid"))
+		entries = append(entries, TimelineEntry{
+			Time:    parseDBTime(migration["creationTime"]),
+			Kind:    TimelineMigration,
+			Name:    name,
+			Message: "started",
+			Details: migration,
+		})
+		if end := parseDBTime(migration["endTimestamp"]); !end.IsZero() {
+			entries = append(entries, TimelineEntry{
+				Time:    end,
+				Kind:    TimelineMigration,
+				Name:    name,
+				Message: "ended",
+				Details: migration,
+			})
+		}
+	}
+
+	events, err := d.getEventsOf(involvedUIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		entries = append(entries, TimelineEntry{
+			Time:    parseDBTime(event["firstTimestamp"]),
+			Kind:    TimelineEvent,
+			Name:    recordString(event, "reason"),
+			Message: recordString(event, "message"),
+			Details: event,
+		})
+	}
+
+	SortTimeline(entries)
+	timeline.Entries = entries
+	return timeline, nil
+}
+
+// getVMIObject returns the VMI as it was collected in the must-gather.
+func (d *databaseInstance) getVMIObject(vmiUUID string) (*kubevirtv1.VirtualMachineInstance, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+	var content []byte
+	row := d.db.QueryRowContext(ctx, "SELECT content from vmis WHERE caseId=? AND uuid=?", d.caseID, vmiUUID)
+	if err := row.Scan(&content); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: vmi %s", ErrNotFound, vmiUUID)
+		}
+		return nil, err
+	}
+	vmi := &kubevirtv1.VirtualMachineInstance{}
+	if err := json.Unmarshal(content, vmi); err != nil {
+		return nil, err
+	}
+	return vmi, nil
+}
+
+func (d *databaseInstance) getEventsOf(involvedUIDs []string) ([]map[string]interface{}, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(involvedUIDs)), ", ")
+	args := []interface{}{d.caseID}
+	for _, uid := range involvedUIDs {
+		args = append(args, uid)
+	}
+	return d.queryRecords("select uuid, involvedKind, involvedName, reason, type, message, count, firstTimestamp, lastTimestamp from events where caseId=? AND involvedUID in ("+placeholders+")", args...)
+}
+
+// queryRecords runs a query and returns its rows keyed by column name.
+func (d *databaseInstance) queryRecords(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	ctx, cancel := d.queryContext()
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	records := []map[string]interface{}{}
+	values := make([]interface{}, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		record := map[string]interface{}{}
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				record[column] = string(b)
+			} else {
+				record[column] = values[i]
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func recordString(record map[string]interface{}, column string) string {
+	if value, ok := record[column].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// recordBool reads a BOOLEAN column, which drivers return as an integer.
+func recordBool(record map[string]interface{}, column string) bool {
+	switch value := record[column].(type) {
+	case bool:
+		return value
+	case int64:
+		return value != 0
+	case string:
+		return value == "1" || value == "true"
+	}
+	return false
+}
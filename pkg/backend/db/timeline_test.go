@@ -0,0 +1,137 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+func TestGetVMITimeline(t *testing.T) {
+	store := newTestStore(t)
+	at := func(minute int) time.Time {
+		return time.Date(2022, 10, 1, 12, minute, 0, 0, time.UTC)
+	}
+
+	vmi := kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "vm1", Namespace: "default", UID: "vmi-1", CreationTimestamp: metav1.NewTime(at(0))},
+		Status: kubevirtv1.VirtualMachineInstanceStatus{
+			// out of order, and Pending at the creation time
+			PhaseTransitionTimestamps: []kubevirtv1.VirtualMachineInstancePhaseTransitionTimestamp{
+				{Phase: kubevirtv1.Running, PhaseTransitionTimestamp: metav1.NewTime(at(3))},
+				{Phase: kubevirtv1.Pending, PhaseTransitionTimestamp: metav1.NewTime(at(0))},
+				{Phase: kubevirtv1.Scheduled, PhaseTransitionTimestamp: metav1.NewTime(at(2))},
+			},
+			Conditions: []kubevirtv1.VirtualMachineInstanceCondition{
+				{Type: kubevirtv1.VirtualMachineInstanceReady, Status: k8sv1.ConditionTrue, LastTransitionTime: metav1.NewTime(at(4))},
+				// conditions that never transitioned are left out
+				{Type: kubevirtv1.VirtualMachineInstancePaused, Status: k8sv1.ConditionFalse},
+			},
+		},
+	}
+	content, err := json.Marshal(vmi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreVmi(&VirtualMachineInstance{
+		Name:         "vm1",
+		Namespace:    "default",
+		UUID:         "vmi-1",
+		Phase:        "Running",
+		CreationTime: metav1.NewTime(at(0)),
+		Content:      content,
+	}); err != nil {
+		t.Fatalf("StoreVmi() error = %v", err)
+	}
+
+	launcher := testPod("virt-launcher-vm1-abcde", "default", at(1))
+	launcher.CreatedBy = "vmi-1"
+	target := testPod("virt-launcher-vm1-fghij", "default", at(6))
+	target.CreatedBy = "vmi-1"
+	unrelated := testPod("virt-launcher-vm2-abcde", "default", at(1))
+	for _, pod := range []*Pod{target, launcher, unrelated} {
+		if err := store.StorePod(pod); err != nil {
+			t.Fatalf("StorePod() error = %v", err)
+		}
+	}
+	for _, migration := range []*VirtualMachineInstanceMigration{
+		{Name: "migrate-vm1", Namespace: "default", UUID: "vmim-1", VMIName: "vm1", CreationTime: metav1.NewTime(at(5)), EndTimestamp: metav1.NewTime(at(7)), Completed: true, Content: []byte("{}")},
+		// the migration of a VMI of the same name in another namespace
+		{Name: "migrate-other-vm1", Namespace: "other", UUID: "vmim-2", VMIName: "vm1", CreationTime: metav1.NewTime(at(5)), Content: []byte("{}")},
+	} {
+		if err := store.StoreVmiMigration(migration); err != nil {
+			t.Fatalf("StoreVmiMigration() error = %v", err)
+		}
+	}
+	for i, event := range []*Event{
+		{InvolvedUID: "vmim-1", Reason: "PreparingTarget", FirstTimestamp: metav1.NewTime(at(6))},
+		{InvolvedUID: launcher.UUID, Reason: "Started", FirstTimestamp: metav1.NewTime(at(2))},
+		{InvolvedUID: "vmi-1", Reason: "SuccessfulCreate", FirstTimestamp: metav1.NewTime(at(1))},
+		{InvolvedUID: unrelated.UUID, Reason: "Started", FirstTimestamp: metav1.NewTime(at(2))},
+		{InvolvedUID: "vmim-2", Reason: "PreparingTarget", FirstTimestamp: metav1.NewTime(at(6))},
+	} {
+		event.Name = fmt.Sprintf("event-%d", i)
+		event.Namespace = "default"
+		event.UUID = fmt.Sprintf("event-%d", i)
+		event.Content = []byte("{}")
+		if err := store.StoreEvent(event); err != nil {
+			t.Fatalf("StoreEvent() error = %v", err)
+		}
+	}
+
+	timeline, err := store.GetVMITimeline("vmi-1")
+	if err != nil {
+		t.Fatalf("GetVMITimeline() error = %v", err)
+	}
+	type entry struct {
+		minute int
+		kind   string
+		name   string
+	}
+	// simultaneous entries keep the order they were collected in: the
+	// VMI, its phases and conditions, pods, migrations and then events
+	want := []entry{
+		{0, TimelineVMI, "vm1"},
+		{0, TimelinePhase, "Pending"},
+		{1, TimelinePod, "virt-launcher-vm1-abcde"},
+		{1, TimelineEvent, "SuccessfulCreate"},
+		{2, TimelinePhase, "Scheduled"},
+		{2, TimelineEvent, "Started"},
+		{3, TimelinePhase, "Running"},
+		{4, TimelineCondition, "Ready=True"},
+		{5, TimelineMigration, "migrate-vm1"},
+		{6, TimelinePod, "virt-launcher-vm1-fghij"},
+		{6, TimelineEvent, "PreparingTarget"},
+		{7, TimelineMigration, "migrate-vm1"},
+	}
+	got := []entry{}
+	for _, e := range timeline.Entries {
+		got = append(got, entry{int(e.Time.Sub(at(0)) / time.Minute), e.Kind, e.Name})
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetVMITimeline() entries = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GetVMITimeline() entry %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if last := timeline.Entries[len(timeline.Entries)-1]; last.Message != "ended" {
+		t.Errorf("the last migration entry message = %q, want ended", last.Message)
+	}
+	if timeline.Name != "vm1" || timeline.Namespace != "default" || !timeline.Created.Equal(at(0)) || len(timeline.PodNames) != 2 {
+		t.Errorf("GetVMITimeline() = %s/%s created %v with pods %v", timeline.Namespace, timeline.Name, timeline.Created, timeline.PodNames)
+	}
+
+	if _, err := store.GetVMITimeline("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetVMITimeline() of a missing VMI error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.ForCase("other").GetVMITimeline("vmi-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetVMITimeline() of another case error = %v, want ErrNotFound", err)
+	}
+}
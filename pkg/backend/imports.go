@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"logsviewer/pkg/backend/config"
+	"logsviewer/pkg/backend/jobs"
+	"logsviewer/pkg/backend/log"
+)
+
+// runImport extracts src, when it is an archive or a directory, into the
+// directory of the case and loads the must-gather into the database and the
+// log store, reporting each phase on the job. removeSource deletes src once it
+// is extracted.
+func (s *server) runImport(jobID string, caseID string, src string, removeSource bool) {
+	s.importLock.Lock()
+	defer s.importLock.Unlock()
+	defer s.importJobs.Finish(jobID)
+
+	s.importJobs.StartPhase(jobID, jobs.PhaseExtract)
+	var err error
+	if removeSource {
+		err = handleArchive(src, s.config.CaseDir(caseID))
+	} else {
+		err = extractArchive(src, s.config.CaseDir(caseID))
+	}
+	s.importJobs.FinishPhase(jobID, jobs.PhaseExtract, 0, err)
+	if err != nil {
+		return
+	}
+
+	if err := s.processMustGather(jobID, caseID); err != nil {
+		log.Log.Println("failed to import ", src, " - ", err)
+	}
+}
+
+// processMustGather loads the extracted must-gather of a case. It stops at
+// the first phase that fails.
+func (s *server) processMustGather(jobID string, caseID string) error {
+	logsHandler := NewLogsHandler(s.config, s.store, caseID)
+
+	steps := []struct {
+		phase jobs.Phase
+		run   func() (int, error)
+	}{
+		{jobs.PhaseNodes, logsHandler.processNodeYAMLs},
+		{jobs.PhasePods, logsHandler.processPodYAMLs},
+		{jobs.PhaseMigrations, logsHandler.processVirtualMachineInstanceMigrationsYAMLs},
+		{jobs.PhaseVMIs, logsHandler.processVirtualMachineInstanceYAMLs},
+		{jobs.PhaseVMs, logsHandler.processVirtualMachineYAMLs},
+		{jobs.PhaseEvents, logsHandler.processEventYAMLs},
+		{jobs.PhaseStorage, logsHandler.processStorageYAMLs},
+		{jobs.PhaseCluster, logsHandler.processClusterYAMLs},
+		{jobs.PhaseResources, func() (int, error) { return logsHandler.processResourceYAMLs(s.resources) }},
+		{jobs.PhaseStore, func() (int, error) {
+			counts, failed, err := logsHandler.commitObjects()
+			s.importJobs.SetCounts(jobID, jobs.PhaseStore, counts, failed)
+			total := 0
+			for _, count := range counts {
+				total += count
+			}
+			return total, err
+		}},
+		{jobs.PhaseLogs, func() (int, error) {
+			stats, err := logsHandler.indexLogs()
+			return stats.Indexed, err
+		}},
+	}
+	for _, step := range steps {
+		// the local log store reads the extracted files, there is nothing
+		// to index
+		if step.phase == jobs.PhaseLogs && s.config.LogStore != config.LogStoreElasticsearch {
+			s.importJobs.SkipPhase(jobID, step.phase)
+			continue
+		}
+		s.importJobs.StartPhase(jobID, step.phase)
+		count, err := step.run()
+		s.importJobs.FinishPhase(jobID, step.phase, count, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(200)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		log.Log.Println("failed to encode response", err)
+	}
+}
+
+// getImports lists the import jobs, oldest first.
+func (s *server) getImports(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"data": s.importJobs.List(),
+	})
+}
+
+// getImport returns the status of the job in /api/imports/<id>.
+func (s *server) getImport(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/imports/")
+	job, ok := s.importJobs.Get(id)
+	if !ok {
+		http.Error(w, "import job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, job)
+}
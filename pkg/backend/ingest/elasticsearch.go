@@ -0,0 +1,172 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"logsviewer/pkg/backend/log"
+)
+
+// Entry is a document together with its stable ID. IDs are derived from the
+// file and line a document came from, so indexing the same logs twice
+// overwrites instead of duplicating.
+type Entry struct {
+	ID  string
+	Doc Document
+}
+
+// Indexer stores parsed documents. Index returns how many of the entries
+// were rejected, and an error when the entries could not be sent at all.
+type Indexer interface {
+	Index(entries []Entry) (int, error)
+}
+
+// ElasticsearchIndexer writes documents through the Elasticsearch _bulk API
+// into daily indices named "<prefix>YYYY.MM.dd", matching the Logstash output
+// the service used before.
+type ElasticsearchIndexer struct {
+	url         string
+	indexPrefix string
+	client      *http.Client
+}
+
+func NewElasticsearchIndexer(url string, indexPrefix string) *ElasticsearchIndexer {
+	return &ElasticsearchIndexer{
+		url:         strings.TrimSuffix(url, "/"),
+		indexPrefix: indexPrefix,
+		client:      &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error,omitempty"`
+	} `json:"items"`
+}
+
+func (e *ElasticsearchIndexer) indexName(doc Document) string {
+	ts := doc.Timestamp()
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	return e.indexPrefix + ts.Format("2006.01.02")
+}
+
+// Index sends entries in a single _bulk request. Documents Elasticsearch
+// rejects are counted and the first rejection is logged, while the request
+// itself failing, e.g. on a transport error or a non-2xx status, is an error.
+func (e *ElasticsearchIndexer) Index(entries []Entry) (int, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, entry := range entries {
+		action := map[string]map[string]string{"index": {"_index": e.indexName(entry.Doc), "_id": entry.ID}}
+		if err := enc.Encode(action); err != nil {
+			return 0, err
+		}
+		if err := enc.Encode(entry.Doc); err != nil {
+			return 0, err
+		}
+	}
+
+	request, err := http.NewRequest("POST", e.url+"/_bulk", &body)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	respBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, err
+	}
+	if response.StatusCode >= 300 {
+		return 0, fmt.Errorf("bulk request failed with %s: %s", response.Status, string(respBody))
+	}
+
+	var result bulkResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, fmt.Errorf("failed to decode bulk response: %v", err)
+	}
+	if !result.Errors {
+		return 0, nil
+	}
+	failed := 0
+	var firstErr json.RawMessage
+	for _, item := range result.Items {
+		for _, status := range item {
+			if status.Status >= 300 {
+				failed++
+				if firstErr == nil {
+					firstErr = status.Error
+				}
+			}
+		}
+	}
+	log.Log.Println(failed, " of ", len(entries), " documents failed to index, first error: ", string(firstErr))
+	return failed, nil
+}
+
+// DeleteIndices removes the indices matching indexPattern. Indices are
+// resolved first and deleted by name, since clusters usually refuse wildcard
+// deletes.
+func DeleteIndices(url string, indexPattern string) error {
+	url = strings.TrimSuffix(url, "/")
+	client := &http.Client{Timeout: 60 * time.Second}
+
+	response, err := client.Get(fmt.Sprintf("%s/_cat/indices/%s?format=json&h=index&expand_wildcards=all", url, indexPattern))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("listing indices failed with %s: %s", response.Status, string(body))
+	}
+	var indices []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&indices); err != nil {
+		return fmt.Errorf("failed to decode index list: %v", err)
+	}
+	if len(indices) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(indices))
+	for _, index := range indices {
+		names = append(names, index.Index)
+	}
+	request, err := http.NewRequest("DELETE", url+"/"+strings.Join(names, ","), nil)
+	if err != nil {
+		return err
+	}
+	deleteResponse, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer deleteResponse.Body.Close()
+	if deleteResponse.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(deleteResponse.Body)
+		return fmt.Errorf("deleting indices failed with %s: %s", deleteResponse.Status, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePodLog writes content as the current log of the compute container of
+// pod under root.
+func writePodLog(t *testing.T, root string, pod string, content string) {
+	t.Helper()
+	logDir := filepath.Join(root, "namespaces", "default", "pods", pod, "compute", "compute", "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "current.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newBulkServer answers _bulk requests and rejects the first document of
+// every request.
+func newBulkServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		documents := 0
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			documents++
+		}
+		items := []map[string]interface{}{}
+		for i := 0; i < documents/2; i++ {
+			status := map[string]interface{}{"status": 201}
+			if i == 0 {
+				status = map[string]interface{}{"status": 400, "error": map[string]string{"type": "mapper_parsing_exception"}}
+			}
+			items = append(items, map[string]interface{}{"index": status})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": true, "items": items})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIngesterCountsRejectedDocuments(t *testing.T) {
+	root := t.TempDir()
+	lines := `2022-10-01T12:00:00Z {"msg":"first"}` + "\n" + `2022-10-01T12:00:01Z {"msg":"second"}` + "\n"
+	writePodLog(t, root, "virt-launcher-vm1-abcde", lines)
+	writePodLog(t, root, "virt-launcher-vm2-abcde", lines)
+
+	server := newBulkServer(t)
+	stats, err := NewIngester(root, nil, NewElasticsearchIndexer(server.URL, "logs-")).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// one document of each file is rejected, the next file is indexed anyway
+	if stats.Files != 2 || stats.Indexed != 2 || stats.Failed != 2 {
+		t.Errorf("Run() = %+v, want 2 files, 2 documents indexed and 2 failed", stats)
+	}
+}
+
+func TestIngesterStopsWhenTheBulkRequestFails(t *testing.T) {
+	root := t.TempDir()
+	writePodLog(t, root, "virt-launcher-vm1-abcde", `2022-10-01T12:00:00Z {"msg":"first"}`+"\n")
+	writePodLog(t, root, "virt-launcher-vm2-abcde", `2022-10-01T12:00:00Z {"msg":"first"}`+"\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	stats, err := NewIngester(root, nil, NewElasticsearchIndexer(server.URL, "logs-")).Run()
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Run() error = %v, want the failed request", err)
+	}
+	if stats.Files != 0 || stats.Indexed != 0 || stats.Failed != 1 {
+		t.Errorf("Run() = %+v, want the first document failed and no file completed", stats)
+	}
+}
@@ -0,0 +1,169 @@
+package ingest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"logsviewer/pkg/backend/log"
+)
+
+const (
+	defaultBatchSize = 1000
+	// container logs can carry long JSON lines, e.g. full domain XML dumps
+	maxLineSize = 4 * 1024 * 1024
+)
+
+// Stats summarizes an ingestion run.
+type Stats struct {
+	Files   int `json:"files"`
+	Lines   int `json:"lines"`
+	Indexed int `json:"indexed"`
+	Failed  int `json:"failed"`
+}
+
+// Ingester walks the container logs of an extracted must-gather, parses every
+// line, joins the pod enrichment data and hands the documents to an Indexer.
+type Ingester struct {
+	root       string
+	enrichment map[string]interface{}
+	indexer    Indexer
+	batchSize  int
+}
+
+// NewIngester reads the logs under root/namespaces. enrichment is keyed by
+// "<namespace>/<pod>" and is attached to each document as "enrichment_data".
+func NewIngester(root string, enrichment map[string]interface{}, indexer Indexer) *Ingester {
+	return &Ingester{
+		root:       root,
+		enrichment: enrichment,
+		indexer:    indexer,
+		batchSize:  defaultBatchSize,
+	}
+}
+
+// LogFiles lists the container log files of an extracted must-gather.
+func LogFiles(root string) ([]string, error) {
+	var files []string
+	namespacesDir := filepath.Join(root, "namespaces")
+	err := filepath.WalkDir(namespacesDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() && strings.HasSuffix(path, ".log") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return files, err
+}
+
+func (i *Ingester) Run() (Stats, error) {
+	stats := Stats{}
+	files, err := LogFiles(i.root)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, path := range files {
+		if err := i.ingestFile(path, &stats); err != nil {
+			return stats, err
+		}
+		stats.Files++
+	}
+	log.Log.Println("finished indexing logs: ", stats)
+	return stats, nil
+}
+
+func (i *Ingester) ingestFile(path string, stats *Stats) error {
+	fields, err := ParsePath(path)
+	if err != nil {
+		log.Log.Println("skipping log file: ", err)
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	batch := make([]Entry, 0, i.batchSize)
+	// rejected documents are counted and skipped, only a failed request
+	// stops the run
+	flush := func() error {
+		failed, err := i.indexer.Index(batch)
+		if err != nil {
+			stats.Failed += len(batch)
+			return err
+		}
+		stats.Indexed += len(batch) - failed
+		stats.Failed += failed
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		stats.Lines++
+		doc, err := ParseLine(scanner.Text())
+		if err != nil {
+			continue
+		}
+		i.enrich(doc, path, lineNumber, fields)
+		batch = append(batch, Entry{ID: entryID(path, lineNumber), Doc: doc})
+		if len(batch) >= i.batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+func entryID(path string, lineNumber int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%d", path, lineNumber)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Annotate adds the fields derived from the log file location. As with the
+// Logstash pipeline, fields present in the log line itself take precedence.
+func Annotate(doc Document, path string, lineNumber int, fields PathFields) {
+	derived := map[string]interface{}{
+		"podName":       fields.PodName,
+		"containerName": fields.ContainerName,
+		"namespace":     fields.Namespace,
+		"key":           fields.Key(),
+		"type":          "CNVLogs",
+		"log": map[string]interface{}{
+			"file":   map[string]string{"path": path},
+			"offset": lineNumber,
+		},
+	}
+	for field, value := range derived {
+		if _, exists := doc[field]; !exists {
+			doc[field] = value
+		}
+	}
+}
+
+func (i *Ingester) enrich(doc Document, path string, lineNumber int, fields PathFields) {
+	Annotate(doc, path, lineNumber, fields)
+	if data, ok := i.enrichment[fields.Key()]; ok {
+		doc["enrichment_data"] = data
+	}
+}
@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Document is a single log line as it is sent to Elasticsearch.
+type Document map[string]interface{}
+
+// PathFields holds what can be derived from the location of a container log
+// inside a must-gather:
+//
+//	namespaces/<namespace>/pods/<pod>/<container>/<container>/logs/<file>.log
+type PathFields struct {
+	Namespace     string
+	PodName       string
+	ContainerName string
+}
+
+// Key is the namespace/pod key used to look up the pod enrichment data.
+func (p PathFields) Key() string {
+	return fmt.Sprintf("%s/%s", p.Namespace, p.PodName)
+}
+
+// ParsePath derives the pod, container and namespace of a container log file.
+func ParsePath(path string) (PathFields, error) {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	if len(parts) < 7 || parts[len(parts)-6] != "pods" {
+		return PathFields{}, fmt.Errorf("unexpected log file location: %s", path)
+	}
+	return PathFields{
+		Namespace:     parts[len(parts)-7],
+		PodName:       parts[len(parts)-5],
+		ContainerName: parts[len(parts)-4],
+	}, nil
+}
+
+// ParseLine parses a "<timestamp> {json}" container log line. The JSON fields
+// become document fields; "@timestamp" is taken from the "timestamp" field and
+// falls back to the line prefix. Lines without a JSON payload are kept as a
+// plain message tagged with "_jsonparsefailure".
+func ParseLine(line string) (Document, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	prefix := line
+	doc := Document{}
+	if idx := strings.Index(line, "{"); idx >= 0 {
+		prefix = line[:idx]
+		message := line[idx:]
+		doc["message"] = message
+		if err := json.Unmarshal([]byte(message), &doc); err != nil {
+			doc = Document{"message": message, "tags": []string{"_jsonparsefailure"}}
+		}
+	} else {
+		doc["message"] = line
+		doc["tags"] = []string{"_jsonparsefailure"}
+	}
+
+	if ts, ok := parseTimestamp(doc["timestamp"]); ok {
+		doc["@timestamp"] = ts
+	} else if fields := strings.Fields(prefix); len(fields) > 0 {
+		if ts, ok := parseTimestamp(fields[0]); ok {
+			doc["@timestamp"] = ts
+		}
+	}
+	return doc, nil
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999Z07:00",
+}
+
+func parseTimestamp(value interface{}) (time.Time, bool) {
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Timestamp returns the document time, or the zero time when it has none.
+func (d Document) Timestamp() time.Time {
+	if ts, ok := d["@timestamp"].(time.Time); ok {
+		return ts
+	}
+	return time.Time{}
+}
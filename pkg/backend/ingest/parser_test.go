@@ -0,0 +1,208 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		line string
+		// want are the fields the document must have
+		want          Document
+		wantTimestamp time.Time
+	}{
+		{
+			name: "json",
+			line: `{"component":"virt-handler","level":"info","msg":"Processing event","timestamp":"2022-10-01T12:00:00.123456Z"}`,
+			want: Document{
+				"component": "virt-handler",
+				"level":     "info",
+				"msg":       "Processing event",
+			},
+			wantTimestamp: time.Date(2022, 10, 1, 12, 0, 0, 123456000, time.UTC),
+		},
+		{
+			name: "json with a timestamp prefix",
+			line: `2022-10-01T12:00:00.5Z {"level":"error","msg":"failed"}`,
+			want: Document{
+				"level":   "error",
+				"msg":     "failed",
+				"message": `{"level":"error","msg":"failed"}`,
+			},
+			wantTimestamp: time.Date(2022, 10, 1, 12, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name: "json with a cri prefix",
+			line: `2022-10-01T14:00:00.000000001+02:00 stderr F {"level":"info","msg":"ok"}` + "\r\n",
+			want: Document{
+				"level": "info",
+				"msg":   "ok",
+			},
+			wantTimestamp: time.Date(2022, 10, 1, 12, 0, 0, 1, time.UTC),
+		},
+		{
+			name: "the json timestamp wins over the prefix",
+			line: `2022-10-01T12:00:00Z {"msg":"late","timestamp":"2022-10-01T12:00:05Z"}`,
+			want: Document{
+				"msg": "late",
+			},
+			wantTimestamp: time.Date(2022, 10, 1, 12, 0, 5, 0, time.UTC),
+		},
+		{
+			name: "plain text",
+			line: `2022-10-01T12:00:00Z libvirt: starting up`,
+			want: Document{
+				"message": `2022-10-01T12:00:00Z libvirt: starting up`,
+				"tags":    []string{"_jsonparsefailure"},
+			},
+			wantTimestamp: time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "invalid json",
+			line: `2022-10-01T12:00:00Z {"msg": "cut`,
+			want: Document{
+				"message": `{"msg": "cut`,
+				"tags":    []string{"_jsonparsefailure"},
+			},
+			wantTimestamp: time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "no timestamp",
+			line: `starting {"msg":"no time"}`,
+			want: Document{
+				"msg": "no time",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := ParseLine(tc.line)
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			for field, want := range tc.want {
+				if got := doc[field]; !reflect.DeepEqual(got, want) {
+					t.Errorf("ParseLine()[%q] = %#v, want %#v", field, got, want)
+				}
+			}
+			if _, tagged := tc.want["tags"]; !tagged && doc["tags"] != nil {
+				t.Errorf("ParseLine() tagged the line with %v", doc["tags"])
+			}
+			if got := doc.Timestamp(); !got.Equal(tc.wantTimestamp) {
+				t.Errorf("ParseLine().Timestamp() = %v, want %v", got, tc.wantTimestamp)
+			}
+		})
+	}
+}
+
+func TestParseLineRejectsEmptyLines(t *testing.T) {
+	for _, line := range []string{"", "\n", "   \r\n"} {
+		if _, err := ParseLine(line); err == nil {
+			t.Errorf("ParseLine(%q) did not fail", line)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	for _, tc := range []struct {
+		path    string
+		want    PathFields
+		wantErr bool
+	}{
+		{
+			path: "/space/cases/1/must-gather/namespaces/openshift-cnv/pods/virt-handler-x7b2q/virt-handler/virt-handler/logs/current.log",
+			want: PathFields{Namespace: "openshift-cnv", PodName: "virt-handler-x7b2q", ContainerName: "virt-handler"},
+		},
+		{
+			path: "namespaces/default/pods/virt-launcher-vm1-abcde/compute/compute/logs/previous.log",
+			want: PathFields{Namespace: "default", PodName: "virt-launcher-vm1-abcde", ContainerName: "compute"},
+		},
+		{
+			path: "namespaces/default/pods/virt-launcher-vm1-abcde/./compute/compute/logs/current.log",
+			want: PathFields{Namespace: "default", PodName: "virt-launcher-vm1-abcde", ContainerName: "compute"},
+		},
+		{path: "namespaces/default/core/events.log", wantErr: true},
+		{path: "namespaces/default/apps/deployments/x/y/logs/current.log", wantErr: true},
+		{path: "current.log", wantErr: true},
+	} {
+		got, err := ParsePath(tc.path)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParsePath(%q) = %+v, want an error", tc.path, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParsePath(%q) = %+v, %v, want %+v", tc.path, got, err, tc.want)
+		}
+	}
+	if key := (PathFields{Namespace: "default", PodName: "virt-launcher-vm1-abcde"}).Key(); key != "default/virt-launcher-vm1-abcde" {
+		t.Errorf("Key() = %q", key)
+	}
+}
+
+// collectingIndexer keeps the documents it is given.
+type collectingIndexer struct {
+	entries []Entry
+}
+
+func (c *collectingIndexer) Index(entries []Entry) (int, error) {
+	c.entries = append(c.entries, entries...)
+	return 0, nil
+}
+
+func TestIngesterAnnotatesAndEnrichesDocuments(t *testing.T) {
+	root := t.TempDir()
+	logDir := filepath.Join(root, "namespaces", "default", "pods", "virt-launcher-vm1-abcde", "compute", "compute", "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `2022-10-01T12:00:00Z {"msg":"first"}` + "\n\n" + `2022-10-01T12:00:01Z {"msg":"second","podName":"from-the-line"}` + "\n"
+	if err := os.WriteFile(filepath.Join(logDir, "current.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	enrichment := map[string]interface{}{
+		"default/virt-launcher-vm1-abcde": map[string]interface{}{"vmi": "vm1"},
+	}
+
+	indexer := &collectingIndexer{}
+	stats, err := NewIngester(root, enrichment, indexer).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if stats.Files != 1 || stats.Lines != 3 || stats.Indexed != 2 {
+		t.Errorf("Run() = %+v, want 1 file, 3 lines and 2 documents", stats)
+	}
+	if len(indexer.entries) != 2 {
+		t.Fatalf("indexed %d documents, want 2", len(indexer.entries))
+	}
+	first, second := indexer.entries[0].Doc, indexer.entries[1].Doc
+	for field, want := range map[string]interface{}{
+		"podName":       "virt-launcher-vm1-abcde",
+		"containerName": "compute",
+		"namespace":     "default",
+		"key":           "default/virt-launcher-vm1-abcde",
+		"type":          "CNVLogs",
+	} {
+		if first[field] != want {
+			t.Errorf("document[%q] = %v, want %v", field, first[field], want)
+		}
+	}
+	if !reflect.DeepEqual(first["enrichment_data"], enrichment["default/virt-launcher-vm1-abcde"]) {
+		t.Errorf("document enrichment_data = %v", first["enrichment_data"])
+	}
+	// fields of the line take precedence over the derived ones
+	if second["podName"] != "from-the-line" {
+		t.Errorf("document podName = %v, want the value of the line", second["podName"])
+	}
+	if offset := second["log"].(map[string]interface{})["offset"]; offset != 3 {
+		t.Errorf("document log.offset = %v, want line 3", offset)
+	}
+	if indexer.entries[0].ID == indexer.entries[1].ID {
+		t.Errorf("two lines share the document ID %s", indexer.entries[0].ID)
+	}
+}
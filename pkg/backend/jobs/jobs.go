@@ -0,0 +1,271 @@
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// Phase is one step of an import.
+type Phase string
+
+const (
+	PhaseUpload     Phase = "upload"
+	PhaseExtract    Phase = "extract"
+	PhaseNodes      Phase = "nodes"
+	PhasePods       Phase = "pods"
+	PhaseMigrations Phase = "vmims"
+	PhaseVMIs       Phase = "vmis"
+	PhaseVMs        Phase = "vms"
+	PhaseEvents     Phase = "events"
+	PhaseStorage    Phase = "storage"
+	PhaseCluster    Phase = "cluster"
+	PhaseResources  Phase = "resources"
+	PhaseStore      Phase = "store"
+	PhaseLogs       Phase = "logs"
+)
+
+// ImportPhases lists the phases of a must-gather import in execution order.
+var ImportPhases = []Phase{PhaseUpload, PhaseExtract, PhaseNodes, PhasePods, PhaseMigrations, PhaseVMIs, PhaseVMs, PhaseEvents, PhaseStorage, PhaseCluster, PhaseResources, PhaseStore, PhaseLogs}
+
+// State is the state of a job or of one of its phases.
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	// StateSkipped is a phase that does not apply to the configuration
+	StateSkipped State = "skipped"
+)
+
+type PhaseStatus struct {
+	Name  Phase `json:"name"`
+	State State `json:"state"`
+	Count int   `json:"count"`
+	// Counts breaks Count down by object kind, for the phases storing several
+	Counts map[string]int `json:"counts,omitempty"`
+	// Failed is the number of items that could not be stored, kept as
+	// dead letters of the case
+	Failed     int        `json:"failed,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Job is the status of a single import.
+type Job struct {
+	ID        string         `json:"id"`
+	Source    string         `json:"source"`
+	State     State          `json:"state"`
+	Error     string         `json:"error,omitempty"`
+	Phases    []*PhaseStatus `json:"phases"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+// Event is published whenever a job changes; it carries a snapshot of the job.
+type Event struct {
+	JobID string `json:"jobId"`
+	Phase Phase  `json:"phase,omitempty"`
+	State State  `json:"state"`
+	Job   Job    `json:"job"`
+}
+
+func (j *Job) phase(name Phase) *PhaseStatus {
+	for _, phase := range j.Phases {
+		if phase.Name == name {
+			return phase
+		}
+	}
+	phase := &PhaseStatus{Name: name, State: StatePending}
+	j.Phases = append(j.Phases, phase)
+	return phase
+}
+
+func (j *Job) snapshot() Job {
+	copied := *j
+	copied.Phases = make([]*PhaseStatus, 0, len(j.Phases))
+	for _, phase := range j.Phases {
+		phaseCopy := *phase
+		copied.Phases = append(copied.Phases, &phaseCopy)
+	}
+	return copied
+}
+
+// Manager keeps track of import jobs and fans their progress out to subscribers.
+type Manager struct {
+	lock        sync.Mutex
+	jobs        map[string]*Job
+	subscribers map[chan Event]struct{}
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		jobs:        map[string]*Job{},
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+// Create registers a new pending job with the given phases.
+func (m *Manager) Create(source string, phases []Phase) Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        string(uuid.NewUUID()),
+		Source:    source,
+		State:     StatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, phase := range phases {
+		job.phase(phase)
+	}
+	m.jobs[job.ID] = job
+	m.publish(job, "")
+	return job.snapshot()
+}
+
+// Get returns a snapshot of a job.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.snapshot(), true
+}
+
+// List returns snapshots of all known jobs, oldest first.
+func (m *Manager) List() []Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// StartPhase marks a phase, and the job, as running.
+func (m *Manager) StartPhase(id string, name Phase) {
+	m.update(id, name, func(job *Job, phase *PhaseStatus, now time.Time) {
+		job.State = StateRunning
+		phase.State = StateRunning
+		phase.StartedAt = &now
+	})
+}
+
+// Progress updates the item count of a running phase.
+func (m *Manager) Progress(id string, name Phase, count int) {
+	m.update(id, name, func(job *Job, phase *PhaseStatus, now time.Time) {
+		phase.Count = count
+	})
+}
+
+// SetCounts sets the per-kind item counts of a phase, and the number of
+// items that failed.
+func (m *Manager) SetCounts(id string, name Phase, counts map[string]int, failed int) {
+	m.update(id, name, func(job *Job, phase *PhaseStatus, now time.Time) {
+		phase.Counts = counts
+		phase.Failed = failed
+	})
+}
+
+// FinishPhase completes a phase. A non-nil err fails the phase and the job.
+func (m *Manager) FinishPhase(id string, name Phase, count int, err error) {
+	m.update(id, name, func(job *Job, phase *PhaseStatus, now time.Time) {
+		phase.Count = count
+		phase.FinishedAt = &now
+		if phase.StartedAt == nil {
+			phase.StartedAt = &now
+		}
+		if err != nil {
+			phase.State = StateFailed
+			phase.Error = err.Error()
+			job.State = StateFailed
+			job.Error = err.Error()
+			return
+		}
+		phase.State = StateSucceeded
+	})
+}
+
+// SkipPhase marks a phase as skipped.
+func (m *Manager) SkipPhase(id string, name Phase) {
+	m.update(id, name, func(job *Job, phase *PhaseStatus, now time.Time) {
+		phase.State = StateSkipped
+		phase.FinishedAt = &now
+	})
+}
+
+// Finish completes the job unless a phase already failed it.
+func (m *Manager) Finish(id string) {
+	m.update(id, "", func(job *Job, phase *PhaseStatus, now time.Time) {
+		if job.State != StateFailed {
+			job.State = StateSucceeded
+		}
+	})
+}
+
+func (m *Manager) update(id string, name Phase, apply func(job *Job, phase *PhaseStatus, now time.Time)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	var phase *PhaseStatus
+	if name != "" {
+		phase = job.phase(name)
+	}
+	apply(job, phase, now)
+	job.UpdatedAt = now
+	m.publish(job, name)
+}
+
+// Subscribe returns a channel of job events and a function to stop receiving
+// them. Events are dropped for subscribers that do not keep up.
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ch := make(chan Event, 64)
+	m.subscribers[ch] = struct{}{}
+	return ch, func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		if _, ok := m.subscribers[ch]; ok {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish must be called with the lock held.
+func (m *Manager) publish(job *Job, phase Phase) {
+	state := job.State
+	if phase != "" {
+		state = job.phase(phase).State
+	}
+	event := Event{JobID: job.ID, Phase: phase, State: state, Job: job.snapshot()}
+	for ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
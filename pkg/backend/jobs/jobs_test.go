@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+)
+
+func phaseStates(job Job) map[Phase]State {
+	states := map[Phase]State{}
+	for _, phase := range job.Phases {
+		states[phase.Name] = phase.State
+	}
+	return states
+}
+
+func TestManagerPhaseTransitions(t *testing.T) {
+	m := NewManager()
+	job := m.Create("must-gather.tar.gz", []Phase{PhaseUpload, PhaseExtract, PhaseLogs})
+	if job.State != StatePending {
+		t.Errorf("Create() state = %s, want %s", job.State, StatePending)
+	}
+	for _, phase := range job.Phases {
+		if phase.State != StatePending {
+			t.Errorf("Create() phase %s = %s, want %s", phase.Name, phase.State, StatePending)
+		}
+	}
+
+	m.StartPhase(job.ID, PhaseUpload)
+	m.Progress(job.ID, PhaseUpload, 10)
+	got, _ := m.Get(job.ID)
+	if got.State != StateRunning || got.Phases[0].State != StateRunning || got.Phases[0].Count != 10 || got.Phases[0].StartedAt == nil {
+		t.Errorf("after StartPhase() and Progress() = %s %+v, want a running job and upload phase at 10", got.State, *got.Phases[0])
+	}
+
+	m.FinishPhase(job.ID, PhaseUpload, 12, nil)
+	m.SkipPhase(job.ID, PhaseLogs)
+	m.StartPhase(job.ID, PhaseExtract)
+	m.SetCounts(job.ID, PhaseExtract, map[string]int{"pods": 3}, 1)
+	m.FinishPhase(job.ID, PhaseExtract, 3, errors.New("corrupt archive"))
+	m.Finish(job.ID)
+
+	got, _ = m.Get(job.ID)
+	want := map[Phase]State{PhaseUpload: StateSucceeded, PhaseExtract: StateFailed, PhaseLogs: StateSkipped}
+	for name, state := range phaseStates(got) {
+		if state != want[name] {
+			t.Errorf("phase %s = %s, want %s", name, state, want[name])
+		}
+	}
+	// a failed phase fails the job, Finish does not override it
+	if got.State != StateFailed || got.Error != "corrupt archive" {
+		t.Errorf("job = %s %q, want failed with the phase error", got.State, got.Error)
+	}
+	extract := got.Phases[1]
+	if extract.Error != "corrupt archive" || extract.Count != 3 || extract.Failed != 1 || extract.Counts["pods"] != 3 || extract.FinishedAt == nil {
+		t.Errorf("extract phase = %+v", *extract)
+	}
+
+	// snapshots do not share state with the manager
+	got.Phases[0].State = StatePending
+	if again, _ := m.Get(job.ID); again.Phases[0].State != StateSucceeded {
+		t.Errorf("changing a snapshot changed the job")
+	}
+
+	other := m.Create("other", []Phase{PhaseUpload})
+	m.Finish(other.ID)
+	if got, _ := m.Get(other.ID); got.State != StateSucceeded {
+		t.Errorf("Finish() = %s, want %s", got.State, StateSucceeded)
+	}
+	if jobs := m.List(); len(jobs) != 2 || jobs[0].ID != job.ID || jobs[1].ID != other.ID {
+		t.Errorf("List() = %v, want both jobs oldest first", jobs)
+	}
+	if _, ok := m.Get("missing"); ok {
+		t.Errorf("Get() of an unknown job succeeded")
+	}
+	// updates of unknown jobs are ignored
+	m.StartPhase("missing", PhaseUpload)
+}
+
+func TestManagerDropsEventsForSlowSubscribers(t *testing.T) {
+	m := NewManager()
+	slow, stopSlow := m.Subscribe()
+	fast, stopFast := m.Subscribe()
+	defer stopFast()
+
+	job := m.Create("must-gather.tar.gz", []Phase{PhaseUpload})
+	const updates = 100
+	received := 1
+	if event := <-fast; event.JobID != job.ID || event.State != StatePending {
+		t.Errorf("first event = %+v, want the pending job", event)
+	}
+	m.StartPhase(job.ID, PhaseUpload)
+	if event := <-fast; event.Phase != PhaseUpload || event.State != StateRunning || event.Job.State != StateRunning {
+		t.Errorf("StartPhase() event = %+v, want the running upload phase", event)
+	}
+	received++
+	for i := 0; i < updates; i++ {
+		// the publisher never blocks on the slow subscriber
+		m.Progress(job.ID, PhaseUpload, i)
+		if event := <-fast; event.Job.Phases[0].Count != i {
+			t.Errorf("Progress() event count = %d, want %d", event.Job.Phases[0].Count, i)
+		}
+		received++
+	}
+
+	stopSlow()
+	buffered := 0
+	for range slow {
+		buffered++
+	}
+	if buffered == 0 || buffered >= received {
+		t.Errorf("the slow subscriber got %d of %d events, want the buffered ones only", buffered, received)
+	}
+	// stopping twice is harmless
+	stopSlow()
+}
@@ -0,0 +1,98 @@
+package logquery
+
+import (
+	"encoding/json"
+	"time"
+
+	"logsviewer/pkg/backend/noise"
+)
+
+// RenderElasticsearch renders the body of an Elasticsearch _search request
+// against the indices of the query.
+func RenderElasticsearch(q Query) (string, error) {
+	filter := []interface{}{
+		map[string]interface{}{"exists": map[string]interface{}{"field": "msg"}},
+	}
+	if timeRange := esTimeRange(q.From, q.To); timeRange != nil {
+		filter = append(filter, timeRange)
+	}
+
+	should := make([]interface{}, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		should = append(should, esTerm(term))
+	}
+	mustNot := make([]interface{}, 0, len(q.Excluded))
+	for _, rule := range q.Excluded {
+		mustNot = append(mustNot, ExclusionClause(rule))
+	}
+
+	boolQuery := map[string]interface{}{
+		"filter":   filter,
+		"must_not": mustNot,
+	}
+	if len(should) > 0 {
+		boolQuery["should"] = should
+		boolQuery["minimum_should_match"] = 1
+	}
+	body := map[string]interface{}{
+		"query":   map[string]interface{}{"bool": boolQuery},
+		"_source": q.Columns,
+		"sort":    []interface{}{map[string]string{"@timestamp": "asc"}},
+	}
+
+	raw, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// ExclusionClause is the Elasticsearch query matching the lines of a noise
+// rule. Regular expressions run against msg.keyword, which only holds messages
+// up to the ignore_above length of the mapping, and use the Lucene syntax.
+func ExclusionClause(rule noise.Rule) map[string]interface{} {
+	var match map[string]interface{}
+	if rule.Phrase != "" {
+		match = map[string]interface{}{"match_phrase": map[string]interface{}{"msg": rule.Phrase}}
+	} else {
+		match = map[string]interface{}{"regexp": map[string]interface{}{"msg.keyword": map[string]interface{}{"value": ".*(" + rule.Regex + ").*"}}}
+	}
+	if rule.Component == "" {
+		return match
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"component.keyword": rule.Component}},
+		match,
+	}}}
+}
+
+func esTerm(term Term) map[string]interface{} {
+	var match map[string]interface{}
+	if term.Field == "" {
+		match = map[string]interface{}{
+			"multi_match": map[string]interface{}{"query": term.Value, "type": "phrase", "fields": []string{"*"}, "lenient": true},
+		}
+	} else {
+		match = map[string]interface{}{"term": map[string]interface{}{term.Field + ".keyword": term.Value}}
+	}
+
+	timeRange := esTimeRange(term.From, term.To)
+	if timeRange == nil {
+		return match
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": []interface{}{match, timeRange}}}
+}
+
+func esTimeRange(from time.Time, to time.Time) map[string]interface{} {
+	timeRange := map[string]interface{}{}
+	if !from.IsZero() {
+		timeRange["gte"] = from.UTC().Format(time.RFC3339Nano)
+	}
+	if !to.IsZero() {
+		timeRange["lte"] = to.UTC().Format(time.RFC3339Nano)
+	}
+	if len(timeRange) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"range": map[string]interface{}{"@timestamp": timeRange}}
+}
@@ -0,0 +1,118 @@
+package logquery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"logsviewer/pkg/backend/noise"
+)
+
+// RenderGrep renders a shell command that prints the matching lines of an
+// extracted must-gather, in time order. It is meant to be run from the root of
+// the must-gather, where the container logs are found under
+//
+//	namespaces/<namespace>/pods/<pod>/<container>/<container>/logs/<file>.log
+//
+// Pod and container terms select whole log files; the other terms are
+// matched with grep -E against every log line. Log lines start with their
+// RFC3339 timestamp, which is what the time ranges are compared with.
+func RenderGrep(q Query) (string, error) {
+	var files, windowed, values []string
+	for _, term := range q.Terms {
+		var path string
+		switch term.Field {
+		case FieldPodName:
+			path = "*/pods/" + globQuote(term.Value) + "/*"
+		case FieldContainerName:
+			path = "*/pods/*/" + globQuote(term.Value) + "/*"
+		default:
+			values = append(values, regexp.QuoteMeta(term.Value))
+			continue
+		}
+		if term.From.IsZero() && term.To.IsZero() {
+			files = append(files, "-path "+shellQuote(path))
+			continue
+		}
+		windowed = append(windowed, findLogs("-path "+shellQuote(path))+" | "+grepTimeRange(term.From, term.To))
+	}
+
+	var commands []string
+	if len(files) > 0 {
+		commands = append(commands, findLogs(`\( `+strings.Join(files, " -o ")+` \)`))
+	}
+	commands = append(commands, windowed...)
+	if len(values) > 0 {
+		commands = append(commands, fmt.Sprintf("grep -rhE --include='*.log' %s namespaces", shellQuote(strings.Join(values, "|"))))
+	}
+	if len(commands) == 0 {
+		commands = append(commands, findLogs(""))
+	}
+
+	command := "{ " + strings.Join(commands, "; ") + "; } | sort -u"
+	if !q.From.IsZero() || !q.To.IsZero() {
+		command += " | " + grepTimeRange(q.From, q.To)
+	}
+	for _, rule := range q.Excluded {
+		switch {
+		case rule.Component != "":
+			component := regexp.QuoteMeta(fmt.Sprintf(`"component":"%s"`, rule.Component))
+			message := rawRegex(rule)
+			pattern := fmt.Sprintf("%s.*(%s)|(%s).*%s", component, message, message, component)
+			command += " | grep -vE -e " + shellQuote(pattern)
+		case rule.Phrase != "":
+			command += " | grep -vF"
+			for _, phrase := range rawPhrases(rule.Phrase) {
+				command += " -e " + shellQuote(phrase)
+			}
+		default:
+			command += " | grep -vE -e " + shellQuote(rule.Regex)
+		}
+	}
+	return command, nil
+}
+
+func findLogs(predicate string) string {
+	if predicate != "" {
+		predicate += " "
+	}
+	return "find namespaces -name '*.log' " + predicate + "-exec cat {} +"
+}
+
+// grepTimeRange keeps the lines whose leading timestamp is in the range. The
+// timestamps compare as strings as long as both are in UTC.
+func grepTimeRange(from time.Time, to time.Time) string {
+	var conditions []string
+	if !from.IsZero() {
+		conditions = append(conditions, fmt.Sprintf(`$1 >= "%s"`, from.UTC().Format("2006-01-02T15:04:05")))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, fmt.Sprintf(`$1 <= "%s"`, FormatTime(to)))
+	}
+	return "awk " + shellQuote(strings.Join(conditions, " && "))
+}
+
+// rawRegex is the regular expression matching the message of a noise rule in
+// a raw log line.
+func rawRegex(rule noise.Rule) string {
+	if rule.Phrase == "" {
+		return rule.Regex
+	}
+	phrases := rawPhrases(rule.Phrase)
+	for i, phrase := range phrases {
+		phrases[i] = regexp.QuoteMeta(phrase)
+	}
+	return strings.Join(phrases, "|")
+}
+
+// globEscaper escapes the wildcards of a find -path pattern.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+func globQuote(value string) string {
+	return globEscaper.Replace(value)
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,153 @@
+package logquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenderKibana renders the Discover URL state, the part after "#/?", of a
+// Kibana Discover link.
+func RenderKibana(q Query) (string, error) {
+	return fmt.Sprintf("_g=%s&_a=%s",
+		urlState(kibanaGlobalState(q)),
+		urlState(fmt.Sprintf("(index:%s,columns:%s,filters:%s,interval:auto,query:%s,sort:%s)",
+			risonString(q.Index), risonColumns(q.Columns), kibanaFilters(q), kibanaQuery(q), kibanaSort))), nil
+}
+
+// RenderOpenSearch renders the URL state of an OpenSearch Dashboards Discover
+// link, which keeps the query and the filters in a separate _q state.
+func RenderOpenSearch(q Query) (string, error) {
+	return fmt.Sprintf("_a=%s&_g=%s&_q=%s",
+		urlState(fmt.Sprintf("(discover:(columns:%s,isDirty:!f,sort:%s),metadata:(indexPattern:%s,view:discover))",
+			risonColumns(q.Columns), kibanaSort, risonString(q.Index))),
+		urlState(kibanaGlobalState(q)),
+		urlState(fmt.Sprintf("(filters:%s,query:%s)", kibanaFilters(q), kibanaQuery(q)))), nil
+}
+
+// urlStateEscaper percent-encodes what would end a URL state parameter, or
+// be decoded, or dropped, by the browser. The rison syntax is left readable.
+var urlStateEscaper = strings.NewReplacer("%", "%25", "&", "%26", "#", "%23", "+", "%2B", "\t", "%09", "\n", "%0A", "\r", "%0D")
+
+func urlState(rison string) string {
+	return urlStateEscaper.Replace(rison)
+}
+
+const kibanaSort = "!(!('@timestamp',asc))"
+
+func kibanaGlobalState(q Query) string {
+	to := "now"
+	if !q.To.IsZero() {
+		to = risonString(FormatTime(q.To))
+	}
+	return fmt.Sprintf("(filters:!(),refreshInterval:(pause:!t,value:0),time:(from:%s,to:%s))", risonString(FormatTime(q.From)), to)
+}
+
+// kibanaFilters keeps only lines with a message and drops the noise. Phrases
+// for every component use plain phrase filters, other rules custom DSL ones.
+func kibanaFilters(q Query) string {
+	filters := []string{"('$state':(store:appState),meta:(alias:!n,disabled:!f,key:msg,negate:!f,type:exists,value:exists),query:(exists:(field:msg)))"}
+	for _, rule := range q.Excluded {
+		if rule.Phrase != "" && rule.Component == "" {
+			filters = append(filters, fmt.Sprintf("('$state':(store:appState),meta:(alias:!n,disabled:!f,key:msg,negate:!t,params:(query:%s),type:phrase),query:(match_phrase:(msg:%s)))",
+				risonString(rule.Phrase), risonString(rule.Phrase)))
+			continue
+		}
+		clause := ExclusionClause(rule)
+		value, _ := json.Marshal(clause)
+		filters = append(filters, fmt.Sprintf("('$state':(store:appState),meta:(alias:%s,disabled:!f,key:query,negate:!t,type:custom,value:%s),query:%s)",
+			risonString(rule.ID), risonString(string(value)), risonValue(clause)))
+	}
+	return "!(" + strings.Join(filters, ",") + ")"
+}
+
+func kibanaQuery(q Query) string {
+	return fmt.Sprintf("(language:kuery,query:%s)", risonString(KQL(q)))
+}
+
+// KQL renders the terms of q as a Kibana Query Language expression.
+func KQL(q Query) string {
+	terms := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		kql := kqlString(term.Value)
+		if term.Field != "" {
+			kql = term.Field + ": " + kql
+		}
+		if term.From.IsZero() && term.To.IsZero() {
+			terms = append(terms, kql)
+			continue
+		}
+		if !term.From.IsZero() {
+			kql += fmt.Sprintf(" and @timestamp >= %s", kqlString(FormatTime(term.From)))
+		}
+		if !term.To.IsZero() {
+			kql += fmt.Sprintf(" and @timestamp <= %s", kqlString(FormatTime(term.To)))
+		}
+		terms = append(terms, "("+kql+")")
+	}
+	return strings.Join(terms, " or ")
+}
+
+// FormatTime formats a time the way Kibana shows absolute times.
+func FormatTime(t time.Time) string {
+	return fmt.Sprintf("%sZ", t.UTC().Format("2006-01-02T15:04:05.000"))
+}
+
+func kqlString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+var risonEscaper = strings.NewReplacer("!", "!!", "'", "!'")
+
+func risonString(value string) string {
+	return "'" + risonEscaper.Replace(value) + "'"
+}
+
+func risonColumns(columns []string) string {
+	return "!(" + strings.Join(columns, ",") + ")"
+}
+
+var risonID = regexp.MustCompile(`^[a-zA-Z_./~-][a-zA-Z0-9_./~-]*$`)
+
+// risonValue encodes the JSON-like values of an Elasticsearch query.
+func risonValue(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]string, 0, len(keys))
+		for _, key := range keys {
+			name := key
+			if !risonID.MatchString(key) {
+				name = risonString(key)
+			}
+			fields = append(fields, name+":"+risonValue(v[key]))
+		}
+		return "(" + strings.Join(fields, ",") + ")"
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, risonValue(item))
+		}
+		return "!(" + strings.Join(items, ",") + ")"
+	case string:
+		return risonString(v)
+	case bool:
+		if v {
+			return "!t"
+		}
+		return "!f"
+	case int:
+		return strconv.Itoa(v)
+	case nil:
+		return "!n"
+	}
+	return risonString(fmt.Sprint(value))
+}
@@ -0,0 +1,146 @@
+// Package logquery describes the logs related to an object independently of
+// the tool they are searched with, and renders that description for Kibana,
+// Elasticsearch, OpenSearch Dashboards, Loki or grep.
+package logquery
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/noise"
+)
+
+// Fields a Term can match on. A Term without a field matches its value
+// anywhere in the log line.
+const (
+	FieldPodName       = "podName"
+	FieldContainerName = "containerName"
+)
+
+// Term selects log lines. A line is part of a Query when it matches any of its
+// terms.
+type Term struct {
+	Field string
+	Value string
+	// From and To narrow the term to a window inside the time range of the
+	// query, e.g. the time a VMI spent on a node. Zero values leave it open.
+	From time.Time
+	To   time.Time
+}
+
+// Query is a structured log query.
+type Query struct {
+	// Index is the data view, or index pattern, the logs are stored in.
+	Index string
+	Terms []Term
+	// Excluded drops the known noise from the lines matching the terms.
+	Excluded []noise.Rule
+	Columns  []string
+	From     time.Time
+	// To is zero for a range that is still open.
+	To time.Time
+}
+
+// Renderer turns a Query into the query language of a single tool.
+type Renderer func(q Query) (string, error)
+
+const DefaultFormat = "kibana"
+
+var renderers = map[string]Renderer{
+	"kibana":        RenderKibana,
+	"elasticsearch": RenderElasticsearch,
+	"opensearch":    RenderOpenSearch,
+	"loki":          RenderLoki,
+	"grep":          RenderGrep,
+}
+
+// Formats lists the names accepted by Render.
+func Formats() []string {
+	formats := make([]string, 0, len(renderers))
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Render renders q in the named format, DefaultFormat when it is empty.
+func Render(q Query, format string) (string, error) {
+	if format == "" {
+		format = DefaultFormat
+	}
+	renderer, ok := renderers[format]
+	if !ok {
+		return "", fmt.Errorf("unknown query format %q, expected one of %v", format, Formats())
+	}
+	return renderer(q)
+}
+
+var defaultColumns = []string{"msg", "podName", "component", "uid", "subcomponent", "reason", "enrichment_data.pod.uid", "enrichment_data.host.name", "level"}
+
+func newQuery(index string, excluded []noise.Rule) Query {
+	return Query{
+		Index: index,
+		Terms: []Term{
+			{Field: FieldContainerName, Value: "virt-controller"},
+			{Field: FieldContainerName, Value: "virt-api"},
+		},
+		Excluded: excluded,
+		Columns:  defaultColumns,
+	}
+}
+
+// ForVMI covers the whole life of a VMI: the logs of all of its virt-launcher
+// pods, and the logs of the virt-handler of each node while the VMI ran there.
+func ForVMI(index string, res db.QueryResults, excluded []noise.Rule) Query {
+	q := newQuery(index, excluded)
+	q.From = res.StartTimestamp
+	q.To = res.EndTimestamp
+	for _, hop := range res.Hops {
+		q.Terms = append(q.Terms, Term{Field: FieldPodName, Value: hop.Pod})
+		if hop.Handler != "" {
+			q.Terms = append(q.Terms, Term{Field: FieldPodName, Value: hop.Handler, From: hop.StartTimestamp, To: hop.EndTimestamp})
+		}
+	}
+	for _, hop := range res.Hops {
+		q.Terms = append(q.Terms, Term{Value: hop.PodUUID})
+	}
+	q.Terms = append(q.Terms, Term{Value: res.VMIUUID})
+	return q
+}
+
+// ForMigration covers a single migration: the source and target launchers
+// and virt-handlers between the start and the end of the migration.
+func ForMigration(index string, res db.QueryResults, excluded []noise.Rule) Query {
+	q := newQuery(index, excluded)
+	q.From = res.StartTimestamp
+	q.To = res.EndTimestamp
+	for _, pod := range []string{res.SourcePod, res.SourceHandler, res.TargetPod, res.TargetHandler} {
+		q.Terms = append(q.Terms, Term{Field: FieldPodName, Value: pod})
+	}
+	for _, uid := range []string{res.SourcePodUUID, res.VMIUUID, res.TargetPodUUID, res.MigrationUUID} {
+		q.Terms = append(q.Terms, Term{Value: uid})
+	}
+	return q
+}
+
+// ForStorage covers the provisioning of the volumes of a VMI: the logs of the
+// CDI importer and upload pods, and the lines mentioning its claims, since
+// the oldest of them was created.
+func ForStorage(index string, storage *db.VMIStorage, excluded []noise.Rule) Query {
+	q := Query{
+		Index:    index,
+		Excluded: excluded,
+		Columns:  defaultColumns,
+		From:     storage.Since,
+	}
+	for _, pod := range storage.PodNames {
+		q.Terms = append(q.Terms, Term{Field: FieldPodName, Value: pod})
+	}
+	for _, claim := range storage.ClaimNames {
+		q.Terms = append(q.Terms, Term{Value: claim})
+	}
+	return q
+}
@@ -0,0 +1,470 @@
+package logquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"logsviewer/pkg/backend/noise"
+)
+
+// hostileValues are pod names and noise phrases carrying the characters each
+// query language, or the URL or shell around it, gives a meaning to.
+var hostileValues = []string{
+	`virt-launcher-vm'1`,
+	`vm"(2)"`,
+	`vm!(x)!t`,
+	`vm-(a|b).*+?^$`,
+	`vm[0-9]{2}`,
+	`back\slash`,
+	`amp&hash#pct%20plus+`,
+	`spaced out: or and`,
+}
+
+var (
+	queryFrom = time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	queryTo   = time.Date(2022, 10, 1, 13, 0, 0, 0, time.UTC)
+)
+
+// hostileQuery selects the pod named value and the lines mentioning value,
+// and drops the lines containing value as a phrase, for every component and
+// for virt-handler only.
+func hostileQuery(value string) Query {
+	return Query{
+		Index: "cnvlogs-" + value,
+		Terms: []Term{
+			{Field: FieldPodName, Value: value},
+			{Field: FieldContainerName, Value: value, From: queryFrom, To: queryTo},
+			{Value: value},
+		},
+		Excluded: []noise.Rule{
+			{ID: "everywhere", Phrase: value},
+			{ID: "handler " + value, Component: "virt-handler", Phrase: value},
+		},
+		Columns: []string{"msg", "podName"},
+		From:    queryFrom,
+		To:      queryTo,
+	}
+}
+
+func TestRender(t *testing.T) {
+	q := hostileQuery("vm1")
+	for _, format := range append(Formats(), "") {
+		if _, err := Render(q, format); err != nil {
+			t.Errorf("Render(%q) error = %v", format, err)
+		}
+	}
+	if _, err := Render(q, "splunk"); err == nil {
+		t.Errorf("Render(splunk) did not fail")
+	}
+}
+
+// risonParser decodes the rison encoding of the Kibana URL state.
+type risonParser struct {
+	s   string
+	pos int
+}
+
+func parseRison(s string) (interface{}, error) {
+	p := &risonParser{s: s}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("trailing %q", p.s[p.pos:])
+	}
+	return value, nil
+}
+
+const risonIDChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_./~-@$"
+
+func (p *risonParser) value() (interface{}, error) {
+	if p.pos >= len(p.s) {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '(':
+		p.pos++
+		object := map[string]interface{}{}
+		for p.pos < len(p.s) && p.s[p.pos] != ')' {
+			key, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok || p.pos >= len(p.s) || p.s[p.pos] != ':' {
+				return nil, fmt.Errorf("invalid key at %d", p.pos)
+			}
+			p.pos++
+			if object[name], err = p.value(); err != nil {
+				return nil, err
+			}
+			if p.pos < len(p.s) && p.s[p.pos] == ',' {
+				p.pos++
+			}
+		}
+		p.pos++
+		return object, nil
+	case c == '\'':
+		p.pos++
+		var value strings.Builder
+		for p.pos < len(p.s) && p.s[p.pos] != '\'' {
+			if p.s[p.pos] == '!' {
+				p.pos++
+				if p.pos >= len(p.s) || (p.s[p.pos] != '!' && p.s[p.pos] != '\'') {
+					return nil, fmt.Errorf("invalid escape at %d", p.pos)
+				}
+			}
+			value.WriteByte(p.s[p.pos])
+			p.pos++
+		}
+		if p.pos >= len(p.s) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		p.pos++
+		return value.String(), nil
+	case c == '!':
+		p.pos += 2
+		switch p.s[p.pos-1] {
+		case 't':
+			return true, nil
+		case 'f':
+			return false, nil
+		case 'n':
+			return nil, nil
+		case '(':
+			list := []interface{}{}
+			for p.pos < len(p.s) && p.s[p.pos] != ')' {
+				item, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+				if p.pos < len(p.s) && p.s[p.pos] == ',' {
+					p.pos++
+				}
+			}
+			p.pos++
+			return list, nil
+		}
+		return nil, fmt.Errorf("invalid ! at %d", p.pos-2)
+	default:
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte(risonIDChars, p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		if start == p.pos {
+			return nil, fmt.Errorf("unexpected %q at %d", c, p.pos)
+		}
+		id := p.s[start:p.pos]
+		if n, err := strconv.Atoi(id); err == nil {
+			return n, nil
+		}
+		return id, nil
+	}
+}
+
+// parseURLState decodes the parameters of a URL state the way Kibana reads
+// them from the location.
+func parseURLState(t *testing.T, state string) map[string]interface{} {
+	t.Helper()
+	if strings.ContainsAny(state, "\t\n\r") {
+		t.Fatalf("the URL state %q has characters the browser drops", state)
+	}
+	params := map[string]interface{}{}
+	for _, param := range strings.Split(state, "&") {
+		name, value := param, ""
+		if i := strings.Index(param, "="); i >= 0 {
+			name, value = param[:i], param[i+1:]
+		}
+		decoded, err := url.QueryUnescape(value)
+		if err != nil {
+			t.Fatalf("parameter %s = %q is not URL encoded: %v", name, value, err)
+		}
+		if params[name], err = parseRison(decoded); err != nil {
+			t.Fatalf("parameter %s = %q is not rison: %v", name, decoded, err)
+		}
+	}
+	return params
+}
+
+func field(t *testing.T, value interface{}, keys ...string) interface{} {
+	t.Helper()
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s of %v is not in an object", key, value)
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// kqlToken matches the tokens of the KQL the renderers write: quoted strings,
+// field names, operators and parentheses.
+var kqlToken = regexp.MustCompile(`^(?:"((?:[^"\\]|\\.)*)"|(podName|containerName|@timestamp)(?::)?|or|and|>=|<=|\(|\))`)
+
+// kqlStrings returns the quoted strings of kql, and fails when anything else
+// than the renderer's own syntax is found outside of them.
+func kqlStrings(t *testing.T, kql string) []string {
+	t.Helper()
+	var values []string
+	rest := kql
+	for rest = strings.TrimLeft(rest, " "); rest != ""; rest = strings.TrimLeft(rest, " ") {
+		m := kqlToken.FindStringSubmatch(rest)
+		if m == nil {
+			t.Fatalf("KQL %q has unexpected syntax at %q", kql, rest)
+		}
+		if strings.HasPrefix(m[0], `"`) {
+			values = append(values, regexp.MustCompile(`\\(.)`).ReplaceAllString(m[1], "$1"))
+		}
+		rest = rest[len(m[0]):]
+	}
+	return values
+}
+
+func assertKibanaState(t *testing.T, value string, q Query, query interface{}, filters interface{}) {
+	t.Helper()
+	kql, _ := field(t, query, "query").(string)
+	if kql != KQL(q) {
+		t.Errorf("query = %q, want %q", kql, KQL(q))
+	}
+	want := []string{value, value, FormatTime(queryFrom), FormatTime(queryTo), value}
+	if got := kqlStrings(t, kql); !reflect.DeepEqual(got, want) {
+		t.Errorf("KQL strings = %q, want %q", got, want)
+	}
+
+	list, _ := filters.([]interface{})
+	if len(list) != 3 {
+		t.Fatalf("filters = %v, want exists and the 2 rules", filters)
+	}
+	if phrase := field(t, list[1], "meta", "params", "query"); phrase != value {
+		t.Errorf("phrase filter = %q, want %q", phrase, value)
+	}
+	if phrase := field(t, list[1], "query", "match_phrase", "msg"); phrase != value {
+		t.Errorf("phrase filter query = %q, want %q", phrase, value)
+	}
+	if alias := field(t, list[2], "meta", "alias"); alias != "handler "+value {
+		t.Errorf("custom filter alias = %q, want the rule ID", alias)
+	}
+	var clause map[string]interface{}
+	if err := json.Unmarshal([]byte(field(t, list[2], "meta", "value").(string)), &clause); err != nil {
+		t.Fatalf("custom filter value is not JSON: %v", err)
+	}
+	wantClause, _ := json.Marshal(ExclusionClause(q.Excluded[1]))
+	gotClause, _ := json.Marshal(clause)
+	if string(gotClause) != string(wantClause) {
+		t.Errorf("custom filter value = %s, want %s", gotClause, wantClause)
+	}
+	phrase := field(t, field(t, list[2], "query", "bool", "filter").([]interface{})[1], "match_phrase", "msg")
+	if phrase != value {
+		t.Errorf("custom filter query phrase = %q, want %q", phrase, value)
+	}
+}
+
+func TestRenderKibanaEscapesValues(t *testing.T) {
+	for _, value := range hostileValues {
+		t.Run(value, func(t *testing.T) {
+			q := hostileQuery(value)
+			rendered, err := RenderKibana(q)
+			if err != nil {
+				t.Fatalf("RenderKibana() error = %v", err)
+			}
+			state := parseURLState(t, rendered)
+			if index := field(t, state["_a"], "index"); index != q.Index {
+				t.Errorf("index = %q, want %q", index, q.Index)
+			}
+			if from := field(t, state["_g"], "time", "from"); from != FormatTime(queryFrom) {
+				t.Errorf("time.from = %q, want %q", from, FormatTime(queryFrom))
+			}
+			assertKibanaState(t, value, q, field(t, state["_a"], "query"), field(t, state["_a"], "filters"))
+		})
+	}
+}
+
+func TestRenderOpenSearchEscapesValues(t *testing.T) {
+	for _, value := range hostileValues {
+		t.Run(value, func(t *testing.T) {
+			q := hostileQuery(value)
+			rendered, err := RenderOpenSearch(q)
+			if err != nil {
+				t.Fatalf("RenderOpenSearch() error = %v", err)
+			}
+			state := parseURLState(t, rendered)
+			if index := field(t, state["_a"], "metadata", "indexPattern"); index != q.Index {
+				t.Errorf("indexPattern = %q, want %q", index, q.Index)
+			}
+			assertKibanaState(t, value, q, field(t, state["_q"], "query"), field(t, state["_q"], "filters"))
+		})
+	}
+}
+
+func TestRenderElasticsearchEscapesValues(t *testing.T) {
+	for _, value := range hostileValues {
+		t.Run(value, func(t *testing.T) {
+			rendered, err := RenderElasticsearch(hostileQuery(value))
+			if err != nil {
+				t.Fatalf("RenderElasticsearch() error = %v", err)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal([]byte(rendered), &body); err != nil {
+				t.Fatalf("RenderElasticsearch() = %s, not JSON: %v", rendered, err)
+			}
+			should := field(t, body, "query", "bool", "should").([]interface{})
+			if got := field(t, should[0], "term", "podName.keyword"); got != value {
+				t.Errorf("pod term = %q, want %q", got, value)
+			}
+			if got := field(t, should[2], "multi_match", "query"); got != value {
+				t.Errorf("value term = %q, want %q", got, value)
+			}
+			mustNot := field(t, body, "query", "bool", "must_not").([]interface{})
+			if got := field(t, mustNot[0], "match_phrase", "msg"); got != value {
+				t.Errorf("excluded phrase = %q, want %q", got, value)
+			}
+		})
+	}
+}
+
+// lokiPart matches the stream selector and the filters RenderLoki writes.
+var lokiPart = regexp.MustCompile(`^(?:\{pod=~("(?:[^"\\]|\\.)*")\}|\|~ ("(?:[^"\\]|\\.)*")|!= ("(?:[^"\\]|\\.)*")|!~ ("(?:[^"\\]|\\.)*")|\| json|\| component != ("(?:[^"\\]|\\.)*") or msg !~ ("(?:[^"\\]|\\.)*"))`)
+
+// lokiStrings returns the strings of each part of logQL, by the group of
+// lokiPart they were found in.
+func lokiStrings(t *testing.T, logQL string) map[int][]string {
+	t.Helper()
+	strs := map[int][]string{}
+	for rest := logQL; rest != ""; rest = strings.TrimLeft(rest, " ") {
+		m := lokiPart.FindStringSubmatch(rest)
+		if m == nil {
+			t.Fatalf("LogQL %q has unexpected syntax at %q", logQL, rest)
+		}
+		for group := 1; group < len(m); group++ {
+			if m[group] == "" {
+				continue
+			}
+			value, err := strconv.Unquote(m[group])
+			if err != nil {
+				t.Fatalf("LogQL string %s: %v", m[group], err)
+			}
+			strs[group] = append(strs[group], value)
+		}
+		rest = rest[len(m[0]):]
+	}
+	return strs
+}
+
+func TestRenderLokiEscapesValues(t *testing.T) {
+	for _, value := range hostileValues {
+		t.Run(value, func(t *testing.T) {
+			rendered, err := RenderLoki(hostileQuery(value))
+			if err != nil {
+				t.Fatalf("RenderLoki() error = %v", err)
+			}
+			strs := lokiStrings(t, rendered)
+
+			// the selector matches the pods of the terms and nothing else
+			pods := regexp.MustCompile("^(?:" + strs[1][0] + ")$")
+			for name, want := range map[string]bool{value: true, value + "-virt-x": true, "x" + value: false, value + "x": false} {
+				if got := pods.MatchString(name); got != want {
+					t.Errorf("pod selector %q matches %q = %v, want %v", strs[1][0], name, got, want)
+				}
+			}
+			// every raw form of the phrase is filtered out
+			if got, want := strs[3], rawPhrases(value); !reflect.DeepEqual(got, want) {
+				t.Errorf("line filters = %q, want %q", got, want)
+			}
+			if strs[5][0] != "virt-handler" || !regexp.MustCompile(strs[6][0]).MatchString("a "+value+" b") {
+				t.Errorf("component filter = %q, %q, want virt-handler and a regex matching %q", strs[5], strs[6], value)
+			}
+		})
+	}
+
+	// a query without pods filters the lines on its values
+	rendered, err := RenderLoki(Query{Terms: []Term{{Value: hostileValues[3]}}})
+	if err != nil {
+		t.Fatalf("RenderLoki() error = %v", err)
+	}
+	strs := lokiStrings(t, rendered)
+	if len(strs[2]) != 1 || !regexp.MustCompile(strs[2][0]).MatchString("a "+hostileValues[3]+" b") || regexp.MustCompile(strs[2][0]).MatchString("vm-a") {
+		t.Errorf("line filter = %q, want one matching %q literally", strs[2], hostileValues[3])
+	}
+}
+
+// logLine is a JSON log line with msg, written at second past queryFrom by
+// component.
+func logLine(second int, component string, msg string) string {
+	raw, _ := json.Marshal(msg)
+	return fmt.Sprintf(`%s {"component":"%s","msg":%s}`, queryFrom.Add(time.Duration(second)*time.Second).Format(time.RFC3339), component, raw)
+}
+
+func writeLog(t *testing.T, root string, pod string, container string, lines ...string) {
+	t.Helper()
+	dir := filepath.Join(root, "namespaces", "default", "pods", pod, container, container, "logs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "current.log"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderGrepEscapesValues(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the command with")
+	}
+	for _, value := range hostileValues {
+		t.Run(value, func(t *testing.T) {
+			root := t.TempDir()
+			// names only the wildcards of a broken pattern would match
+			writeLog(t, root, value+"-other", "compute", logLine(1, "virt-launcher", "other pod"))
+			writeLog(t, root, "x"+value[1:], "compute", logLine(1, "virt-launcher", "similar pod"))
+			writeLog(t, root, value, "compute",
+				logLine(2, "virt-launcher", "kept"),
+				logLine(3, "virt-launcher", "dropped: "+value),
+				logLine(7200, "virt-launcher", "after the query"))
+			writeLog(t, root, "virt-handler-abcde", value,
+				logLine(4, "virt-handler", "container kept"),
+				logLine(5, "virt-handler", "handler "+value))
+			writeLog(t, root, "unrelated", "compute",
+				logLine(6, "virt-launcher", "mentions "+value+" in passing"),
+				logLine(8, "virt-launcher", "mentions nothing"))
+
+			command, err := RenderGrep(hostileQuery(value))
+			if err != nil {
+				t.Fatalf("RenderGrep() error = %v", err)
+			}
+			cmd := exec.Command("sh", "-c", command)
+			cmd.Dir = root
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("%s failed: %v: %s", command, err, out)
+			}
+			var msgs []string
+			for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+				var doc struct {
+					Msg string `json:"msg"`
+				}
+				if i := strings.Index(line, "{"); i < 0 || json.Unmarshal([]byte(line[i:]), &doc) != nil {
+					t.Fatalf("%s printed %q", command, line)
+				}
+				msgs = append(msgs, doc.Msg)
+			}
+			sort.Strings(msgs)
+			want := []string{"container kept", "kept"}
+			if !reflect.DeepEqual(msgs, want) {
+				t.Errorf("%s printed %q, want %q", command, msgs, want)
+			}
+		})
+	}
+}
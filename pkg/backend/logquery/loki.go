@@ -0,0 +1,94 @@
+package logquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"logsviewer/pkg/backend/noise"
+)
+
+// RenderLoki renders a LogQL query for logs shipped with the pod and container
+// labels of the Promtail Kubernetes configuration.
+//
+// LogQL can not OR a stream selector with a line filter, so the query selects
+// the pods of the terms: a container term selects the pods of the deployment of
+// the same name, as with virt-controller and virt-api. Terms without a field
+// are only used when there is no pod to select, and term windows are left to
+// the time range of the query.
+func RenderLoki(q Query) (string, error) {
+	var pods, values []string
+	for _, term := range q.Terms {
+		switch term.Field {
+		case FieldPodName:
+			pods = append(pods, regexp.QuoteMeta(term.Value))
+		case FieldContainerName:
+			pods = append(pods, regexp.QuoteMeta(term.Value)+"-.*")
+		default:
+			values = append(values, regexp.QuoteMeta(term.Value))
+		}
+	}
+
+	var logQL strings.Builder
+	if len(pods) > 0 {
+		logQL.WriteString(`{pod=~` + strconv.Quote(strings.Join(pods, "|")) + `}`)
+	} else {
+		logQL.WriteString(`{pod=~".+"}`)
+		if len(values) > 0 {
+			logQL.WriteString(` |~ ` + strconv.Quote(strings.Join(values, "|")))
+		}
+	}
+	// rules of a single component need the component field of the JSON lines
+	var scoped []string
+	for _, rule := range q.Excluded {
+		switch {
+		case rule.Component != "":
+			scoped = append(scoped, fmt.Sprintf("component != %s or msg !~ %s", strconv.Quote(rule.Component), strconv.Quote("(?s).*("+ruleRegex(rule)+").*")))
+		case rule.Phrase != "":
+			for _, phrase := range rawPhrases(rule.Phrase) {
+				logQL.WriteString(` != ` + strconv.Quote(phrase))
+			}
+		default:
+			logQL.WriteString(` !~ ` + strconv.Quote(rule.Regex))
+		}
+	}
+	if len(scoped) > 0 {
+		logQL.WriteString(" | json")
+		for _, filter := range scoped {
+			logQL.WriteString(" | " + filter)
+		}
+	}
+	return logQL.String(), nil
+}
+
+// ruleRegex is the regular expression matching the message of a noise rule.
+func ruleRegex(rule noise.Rule) string {
+	if rule.Phrase != "" {
+		return regexp.QuoteMeta(rule.Phrase)
+	}
+	return rule.Regex
+}
+
+// rawPhrases are the forms a phrase takes in a raw log line: as is in a plain
+// text line, and escaped in the msg string of a JSON line, with or without
+// the HTML characters escaped.
+func rawPhrases(phrase string) []string {
+	phrases := []string{phrase}
+	for _, escapeHTML := range []bool{false, true} {
+		var encoded bytes.Buffer
+		enc := json.NewEncoder(&encoded)
+		enc.SetEscapeHTML(escapeHTML)
+		if err := enc.Encode(phrase); err != nil {
+			continue
+		}
+		escaped := strings.TrimSuffix(encoded.String(), "\n")
+		escaped = escaped[1 : len(escaped)-1]
+		if escaped != phrases[len(phrases)-1] {
+			phrases = append(phrases, escaped)
+		}
+	}
+	return phrases
+}
@@ -3,21 +3,27 @@ package backend
 import (
     "bytes"
     "path/filepath"
-    "archive/tar"
-    "compress/gzip"
-    "io"
     "os"
     "strings"
     "fmt"
+    "io"
     "io/ioutil"
     "encoding/json"
     "sync"
 
+	appsv1 "k8s.io/api/apps/v1"
 	k8sv1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	kubevirtv1 "kubevirt.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
 
     "logsviewer/pkg/backend/log"
+    "logsviewer/pkg/backend/archive"
+    "logsviewer/pkg/backend/config"
     "logsviewer/pkg/backend/db"
+    "logsviewer/pkg/backend/ingest"
+    "logsviewer/pkg/backend/resources"
     "sigs.k8s.io/yaml"
     yamlv3 "gopkg.in/yaml.v3"
 )
@@ -56,126 +62,81 @@ type EnrichmentData struct {
 
 type logsHandler struct {
     handlerLock sync.Mutex
-    stopCh      chan struct{}
     objectStore *db.ObjectStore
     lookupData  map[string]EnrichmentData
+    caseID      string
+    // root is the directory the must-gather of the case is extracted to
+    root        string
+    config      config.Config
 }
 
-func NewLogsHandler() *logsHandler {
+func NewLogsHandler(cfg config.Config, store db.Store, caseID string) *logsHandler {
     lookupData := make(map[string]EnrichmentData)
-    stopCh := make(chan struct{}, 1)
-    objStore := db.NewObjectStore()
-
-    go objStore.Run(1, stopCh)
+    objStore := db.NewObjectStore(store, caseID)
 
     return &logsHandler{
         lookupData: lookupData,
         objectStore: objStore,
-        stopCh: stopCh,
+        caseID: caseID,
+        root: cfg.CaseDir(caseID),
+        config: cfg,
     }
 }
 
-func handleTarGz(srcFile string, targetPath string) error {
-    if err := unTarGz(srcFile, targetPath); err != nil {
+// handleArchive extracts an uploaded must-gather in any supported archive
+// format and removes the uploaded file.
+func handleArchive(srcFile string, targetPath string) error {
+    if err := extractArchive(srcFile, targetPath); err != nil {
         return err
     }    
     // delete source file
     if err := os.Remove(srcFile); err != nil {
-        log.Log.Fatalln("failed to delete file ", srcFile, " - ", err)
+        log.Log.Println("failed to delete file ", srcFile, " - ", err)
     }
     log.Log.Println("removed file: ", srcFile)
     return nil
 }
 
+// mustGatherDirs are the must-gather directories the service reads.
+var mustGatherDirs = map[string]bool{
+    "namespaces":               true,
+    "cluster-scoped-resources": true,
+}
 
-func unTarGz(srcFile string, targetPath string) error {
-    var namespacePrefixPath []string
-
-    gzipStream, err := os.Open(srcFile)
-    defer gzipStream.Close()
-
-    if err != nil {
-        log.Log.Fatalln("failed to open file ", srcFile, " - ", err)
-	return err
+// mustGatherRewrite keeps only the namespaces and cluster-scoped-resources
+// directories of a must-gather and strips whatever image-specific prefix leads
+// to them, e.g.
+// must-gather.local.1234/quay-io-cnv-must-gather/namespaces/... -> namespaces/...
+func mustGatherRewrite(name string) (string, bool) {
+    parts := strings.Split(name, "/")
+    for i, part := range parts {
+        if mustGatherDirs[part] && i < len(parts)-1 {
+            return strings.Join(parts[i:], "/"), true
+        }
     }
+    // skip everything else
+    return "", false
+}
 
-    uncompressedStream, err := gzip.NewReader(gzipStream)
+// extractArchive unpacks a must-gather archive, or copies an already
+// extracted must-gather directory, into targetPath. Nested archives are
+// unpacked recursively.
+func extractArchive(src string, targetPath string) error {
+    extractor, err := archive.NewExtractor(targetPath, archive.DefaultLimits, mustGatherRewrite)
     if err != nil {
-        log.Log.Fatalln("failed create gzip stream  - ", err)
-	return err
+        return err
     }
-
-    tarReader := tar.NewReader(uncompressedStream)
-
-    for true {
-        header, err := tarReader.Next()
-
-        if err == io.EOF {
-            break
-        }
-
-        if err != nil {
-            log.Log.Fatalln("failed to get next file in tar  - ", err)
-	    return err
-        }
-
-	// extract only the namespaces dir
-	if !strings.Contains(header.Name, "namespaces/") {
-		continue
-	}
-	
-    if len(namespacePrefixPath) == 0 {
-
-        log.Log.Println("Header name: ", header.Name)
-	    // find path to the namespaces directory	
-	    sp := strings.Split(header.Name, "/")
-	    for _, ps := range sp {
-	        if ps == "namespaces" {
-	            break
-	        }
-            namespacePrefixPath = append(namespacePrefixPath, ps)
-            log.Log.Println("current pathToNamespacesDir: ", strings.Join(namespacePrefixPath[:], "/"))
-	    }
-	}
-    pathToNamespacesDir := strings.Join(namespacePrefixPath[:], "/")
-	workingHeaderName := strings.TrimPrefix(header.Name, pathToNamespacesDir)
-	newTarget := filepath.Join(targetPath, workingHeaderName)
-
-	switch header.Typeflag {
-        case tar.TypeDir:
-            if err := os.MkdirAll(newTarget, 0755); err != nil {
-            	log.Log.Fatalln("failed to create dir  - ", err)
-	        return err
-            }
-        case tar.TypeReg:
-            outFile, err := os.Create(newTarget)
-
-	    if err != nil {
-            	log.Log.Fatalln("failed create target ", newTarget, " - ", err)
-	        return err
-            }
-            if _, err := io.Copy(outFile, tarReader); err != nil {
-            	log.Log.Fatalln("failed to copy from src to target ", newTarget, " - ", err)
-	        return err
-            }
-	    outFile.Close()
-
-        default:
-            log.Log.Fatalf(
-                "uknown header type: %s in %s",
-                header.Typeflag,
-                header.Name)
-	        return err
-        }
-
+    if err := extractor.ExtractFile(src); err != nil {
+        log.Log.Println("failed to extract ", src, " - ", err)
+        return err
     }
-    log.Log.Println("Extracted file: ", srcFile)
+    log.Log.Println("Extracted file: ", src)
     return nil
 }
 
 func (l *logsHandler) loadExistingEnrichmentData() error {
     // read the existing enrichment data file
-    jsonFile, err := os.Open(ENRICHMENT_DATA_FILE)
+    jsonFile, err := os.Open(filepath.Join(l.root, l.config.EnrichmentDataFile))
     if err != nil {
         return err
     }
@@ -210,187 +171,680 @@ func (l *logsHandler) processEnrichmentData(pod *Pods) {
     return
 }
 
-func (l *logsHandler) storePodData(yamlFile []byte) error {
+func (l *logsHandler) storePodData(yamlFile []byte, source string) error {
     var pod k8sv1.Pod
 
     err := yaml.Unmarshal(yamlFile, &pod)
     if err != nil {
-      log.Log.Fatalln("failed to unmarshal yaml  - ", err)
+      log.Log.Println("failed to unmarshal yaml  - ", err)
+      l.objectStore.Fail("Pod", source, err)
       return err
     }
 
-    l.objectStore.Add(&pod)
+    l.objectStore.Add(&pod, source)
     return nil
 }
 
-func (l *logsHandler) storeVMIData(yamlFile []byte) error {
+func (l *logsHandler) storeVMIData(yamlFile []byte, source string) error {
     var vmi kubevirtv1.VirtualMachineInstance
 
     err := yaml.Unmarshal(yamlFile, &vmi)
     if err != nil {
-      log.Log.Fatalln("failed to unmarshal vmi yaml  - ", err)
+      log.Log.Println("failed to unmarshal vmi yaml  - ", err)
+      l.objectStore.Fail("VirtualMachineInstance", source, err)
       return err
     }
 
-    l.objectStore.Add(&vmi)
+    l.objectStore.Add(&vmi, source)
     return nil
 }
 
-func (l *logsHandler) storeVMIMData(yamlFile []byte) error {
+func (l *logsHandler) storeVMData(yamlFile []byte, source string) error {
+    var vm kubevirtv1.VirtualMachine
+
+    err := yaml.Unmarshal(yamlFile, &vm)
+    if err != nil {
+      log.Log.Println("failed to unmarshal vm yaml  - ", err)
+      l.objectStore.Fail("VirtualMachine", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&vm, source)
+    return nil
+}
+
+func (l *logsHandler) storeNodeData(jsonDoc []byte, source string) error {
+    var node k8sv1.Node
+
+    err := yaml.Unmarshal(jsonDoc, &node)
+    if err != nil {
+      log.Log.Println("failed to unmarshal node yaml  - ", err)
+      l.objectStore.Fail("Node", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&node, source)
+    return nil
+}
+
+func (l *logsHandler) storeEventData(jsonDoc []byte, source string) error {
+    var event k8sv1.Event
+
+    err := yaml.Unmarshal(jsonDoc, &event)
+    if err != nil {
+      log.Log.Println("failed to unmarshal event yaml  - ", err)
+      l.objectStore.Fail("Event", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&event, source)
+    return nil
+}
+
+func (l *logsHandler) storeVMIMData(yamlFile []byte, source string) error {
     var vmim kubevirtv1.VirtualMachineInstanceMigration
 
     err := yaml.Unmarshal(yamlFile, &vmim)
     if err != nil {
-      log.Log.Fatalln("failed to unmarshal vmi migration yaml  - ", err)
+      log.Log.Println("failed to unmarshal vmi migration yaml  - ", err)
+      l.objectStore.Fail("VirtualMachineInstanceMigration", source, err)
       return err
     }
 
-    l.objectStore.Add(&vmim)
+    l.objectStore.Add(&vmim, source)
     return nil
 }
 
-func (l *logsHandler) storeVMIMListData(yamlFile []byte) error {
+func (l *logsHandler) storeVMIMListData(yamlFile []byte, source string) (int, error) {
     var vmimList kubevirtv1.VirtualMachineInstanceMigrationList
 
     err := yaml.Unmarshal(yamlFile, &vmimList)
     if err != nil {
-      log.Log.Fatalln("failed to unmarshal vmi migration yaml  - ", err)
-      return err
+      log.Log.Println("failed to unmarshal vmi migration yaml  - ", err)
+      l.objectStore.Fail("VirtualMachineInstanceMigration", source, err)
+      return 0, err
     }
 
-    for _, vmim := range vmimList.Items {
-        l.objectStore.Add(&vmim)
+    for i := range vmimList.Items {
+        l.objectStore.Add(&vmimList.Items[i], source)
     }
-    return nil
+    return len(vmimList.Items), nil
 }
 
 
-func (l *logsHandler) processPodYAMLs() error {
+func (l *logsHandler) processPodYAMLs() (int, error) {
     var pod Pods
+    count := 0
     l.handlerLock.Lock()
     defer l.handlerLock.Unlock()
 
     l.loadExistingEnrichmentData()
 
-    //TODO: make path configurable
-    layouts, err := filepath.Glob("/space/namespaces/*/pods/*/*.yaml")
+    layouts, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/pods/*/*.yaml"))
     if err != nil {
-        return(err)
+        return count, err
     }
 
     for _, filename := range layouts {
           // read pod yaml
         yamlFile, err := ioutil.ReadFile(filename)
         if err != nil {
-          return err
+          return count, err
         }
         err = yaml.Unmarshal(yamlFile, &pod)
         if err != nil {
-          return err
+          l.objectStore.Fail("Pod", l.source(filename), err)
+          continue
         }
         l.processEnrichmentData(&pod)
-        l.storePodData(yamlFile)
+        if err := l.storePodData(yamlFile, l.source(filename)); err == nil {
+            count++
+        }
     }
 
     js1, _ := json.Marshal(l.lookupData)
-    _ = ioutil.WriteFile(ENRICHMENT_DATA_FILE, js1, 0644)
+    _ = ioutil.WriteFile(filepath.Join(l.root, l.config.EnrichmentDataFile), js1, 0644)
     
     log.Log.Println("finished writting lookupData")
-    return nil
+    return count, nil
 } 
 
-func (l *logsHandler) processCombinedVirtualMachineInstanceYAMLs(yamlFile []byte) error {
+func (l *logsHandler) processCombinedVirtualMachineInstanceYAMLs(yamlFile []byte, source string) int {
 
     dec := yamlv3.NewDecoder(bytes.NewReader(yamlFile))
+    count := 0
 
     for {   
         var vmi kubevirtv1.VirtualMachineInstance
-        if dec.Decode(&vmi) != nil  {
+        if err := dec.Decode(&vmi); err != nil  {
+            if err != io.EOF {
+                l.objectStore.Fail("VirtualMachineInstance", source, err)
+            }
             break
         }
-        l.objectStore.Add(&vmi)
+        l.objectStore.Add(&vmi, source)
+        count++
     }
-    return nil
+    return count
 }
 
-func (l *logsHandler) processVirtualMachineInstanceYAMLs() error {
+func (l *logsHandler) processVirtualMachineInstanceYAMLs() (int, error) {
     // different versions of the must-gather collect the VMI yamls differently
 
     l.handlerLock.Lock()
     defer l.handlerLock.Unlock()
+    count := 0
 
 
-    //TODO: make path configurable
-    layouts, err := filepath.Glob("/space/namespaces/*/kubevirt.io/virtualmachineinstances/*.yaml")
+    layouts, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/kubevirt.io/virtualmachineinstances/*.yaml"))
     if err != nil {
-        return(err)
+        return count, err
     }
 
     for _, filename := range layouts {
         yamlFile, err := ioutil.ReadFile(filename)
         if err != nil {
-          return err
+          return count, err
+        }
+        if err := l.storeVMIData(yamlFile, l.source(filename)); err == nil {
+            count++
         }
-        l.storeVMIData(yamlFile)
     }
 
     if len(layouts) == 0 {
         
-        combinedYamls, err := filepath.Glob("/space/namespaces/*/kubevirt.io/virtualmachineinstances.yaml")
+        combinedYamls, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/kubevirt.io/virtualmachineinstances.yaml"))
         if err != nil {
-            return(err)
+            return count, err
         }
         for _, filename := range combinedYamls {
             yamlFile, err := ioutil.ReadFile(filename)
             if err != nil {
-              return err
+              return count, err
             }
-            l.processCombinedVirtualMachineInstanceYAMLs(yamlFile)
+            count += l.processCombinedVirtualMachineInstanceYAMLs(yamlFile, l.source(filename))
         }
     }
 
 
     log.Log.Println("finished processing VMI YAMLs")
-    return nil
+    return count, nil
 } 
 
-func (l *logsHandler) processVirtualMachineInstanceMigrationsYAMLs() error {
+func (l *logsHandler) processVirtualMachineInstanceMigrationsYAMLs() (int, error) {
     // different versions of the must-gather collect the VMI yamls differently
 
     l.handlerLock.Lock()
     defer l.handlerLock.Unlock()
+    count := 0
 
 
-    //TODO: make path configurable
-    layouts, err := filepath.Glob("/space/namespaces/*/kubevirt.io/virtualmachineinstancemigrations/*.yaml")
+    layouts, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/kubevirt.io/virtualmachineinstancemigrations/*.yaml"))
     if err != nil {
-        return(err)
+        return count, err
     }
 
     for _, filename := range layouts {
         yamlFile, err := ioutil.ReadFile(filename)
         if err != nil {
-          return err
+          return count, err
+        }
+        if err := l.storeVMIMData(yamlFile, l.source(filename)); err == nil {
+            count++
         }
-        l.storeVMIMData(yamlFile)
     }
 
     if len(layouts) == 0 {
         
-        combinedYamls, err := filepath.Glob("/space/namespaces/*/kubevirt.io/virtualmachineinstancemigrations.yaml")
+        combinedYamls, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/kubevirt.io/virtualmachineinstancemigrations.yaml"))
         if err != nil {
-            return(err)
+            return count, err
         }
         for _, filename := range combinedYamls {
             yamlFile, err := ioutil.ReadFile(filename)
             if err != nil {
-              return err
+              return count, err
+            }
+            if listCount, err := l.storeVMIMListData(yamlFile, l.source(filename)); err == nil {
+                count += listCount
             }
-            l.storeVMIMListData(yamlFile)
         }
     }
 
 
     log.Log.Println("finished processing VMIM YAMLs")
-    return nil
+    return count, nil
 } 
+
+// decodeYAMLDocuments calls each with the JSON of every document of a, possibly
+// multi document, YAML file. Documents of kind List are expanded into their
+// items.
+func decodeYAMLDocuments(yamlFile []byte, each func(jsonDoc []byte) error) error {
+    dec := yamlv3.NewDecoder(bytes.NewReader(yamlFile))
+    for {
+        var doc map[string]interface{}
+        err := dec.Decode(&doc)
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if doc == nil {
+            continue
+        }
+        docs := []interface{}{doc}
+        if items, ok := doc["items"].([]interface{}); ok {
+            docs = items
+        }
+        for _, item := range docs {
+            jsonDoc, err := json.Marshal(item)
+            if err != nil {
+                return err
+            }
+            if err := each(jsonDoc); err != nil {
+                return err
+            }
+        }
+    }
+}
+
+func (l *logsHandler) processVirtualMachineYAMLs() (int, error) {
+    // like VMIs, VMs are collected either one per file or combined in one file
+    // per namespace
+
+    l.handlerLock.Lock()
+    defer l.handlerLock.Unlock()
+    count := 0
+
+    layouts, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/kubevirt.io/virtualmachines/*.yaml"))
+    if err != nil {
+        return count, err
+    }
+
+    for _, filename := range layouts {
+        yamlFile, err := ioutil.ReadFile(filename)
+        if err != nil {
+          return count, err
+        }
+        if err := l.storeVMData(yamlFile, l.source(filename)); err == nil {
+            count++
+        }
+    }
+
+    if len(layouts) == 0 {
+
+        combinedYamls, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/kubevirt.io/virtualmachines.yaml"))
+        if err != nil {
+            return count, err
+        }
+        for _, filename := range combinedYamls {
+            yamlFile, err := ioutil.ReadFile(filename)
+            if err != nil {
+              return count, err
+            }
+            err = decodeYAMLDocuments(yamlFile, func(jsonDoc []byte) error {
+                if err := l.storeVMData(jsonDoc, l.source(filename)); err == nil {
+                    count++
+                }
+                return nil
+            })
+            if err != nil {
+                l.objectStore.Fail("VirtualMachine", l.source(filename), err)
+            }
+        }
+    }
+
+    log.Log.Println("finished processing VM YAMLs")
+    return count, nil
+}
+
+func (l *logsHandler) processNodeYAMLs() (int, error) {
+    l.handlerLock.Lock()
+    defer l.handlerLock.Unlock()
+    count := 0
+
+    layouts, err := filepath.Glob(filepath.Join(l.root, "cluster-scoped-resources/core/nodes/*.yaml"))
+    if err != nil {
+        return count, err
+    }
+
+    for _, filename := range layouts {
+        yamlFile, err := ioutil.ReadFile(filename)
+        if err != nil {
+          return count, err
+        }
+        err = decodeYAMLDocuments(yamlFile, func(jsonDoc []byte) error {
+            if err := l.storeNodeData(jsonDoc, l.source(filename)); err == nil {
+                count++
+            }
+            return nil
+        })
+        if err != nil {
+            l.objectStore.Fail("Node", l.source(filename), err)
+        }
+    }
+
+    log.Log.Println("finished processing node YAMLs")
+    return count, nil
+}
+
+func (l *logsHandler) processEventYAMLs() (int, error) {
+    l.handlerLock.Lock()
+    defer l.handlerLock.Unlock()
+    count := 0
+
+    layouts, err := filepath.Glob(filepath.Join(l.root, "namespaces/*/core/events.yaml"))
+    if err != nil {
+        return count, err
+    }
+
+    for _, filename := range layouts {
+        yamlFile, err := ioutil.ReadFile(filename)
+        if err != nil {
+          return count, err
+        }
+        err = decodeYAMLDocuments(yamlFile, func(jsonDoc []byte) error {
+            if err := l.storeEventData(jsonDoc, l.source(filename)); err == nil {
+                count++
+            }
+            return nil
+        })
+        if err != nil {
+            l.objectStore.Fail("Event", l.source(filename), err)
+        }
+    }
+
+    log.Log.Println("finished processing event YAMLs")
+    return count, nil
+}
+
+func (l *logsHandler) storeDataVolumeData(jsonDoc []byte, source string) error {
+    var dv cdiv1.DataVolume
+
+    err := yaml.Unmarshal(jsonDoc, &dv)
+    if err != nil {
+      log.Log.Println("failed to unmarshal datavolume yaml  - ", err)
+      l.objectStore.Fail("DataVolume", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&dv, source)
+    return nil
+}
+
+func (l *logsHandler) storePVCData(jsonDoc []byte, source string) error {
+    var pvc k8sv1.PersistentVolumeClaim
+
+    err := yaml.Unmarshal(jsonDoc, &pvc)
+    if err != nil {
+      log.Log.Println("failed to unmarshal pvc yaml  - ", err)
+      l.objectStore.Fail("PersistentVolumeClaim", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&pvc, source)
+    return nil
+}
+
+func (l *logsHandler) storePVData(jsonDoc []byte, source string) error {
+    var pv k8sv1.PersistentVolume
+
+    err := yaml.Unmarshal(jsonDoc, &pv)
+    if err != nil {
+      log.Log.Println("failed to unmarshal pv yaml  - ", err)
+      l.objectStore.Fail("PersistentVolume", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&pv, source)
+    return nil
+}
+
+func (l *logsHandler) storeStorageClassData(jsonDoc []byte, source string) error {
+    var sc storagev1.StorageClass
+
+    err := yaml.Unmarshal(jsonDoc, &sc)
+    if err != nil {
+      log.Log.Println("failed to unmarshal storage class yaml  - ", err)
+      l.objectStore.Fail("StorageClass", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&sc, source)
+    return nil
+}
+
+// processYAMLFiles passes every object in the files matching patterns to
+// store, whether the files hold a single object, several documents or a list.
+func (l *logsHandler) processYAMLFiles(kind string, patterns []string, store func(jsonDoc []byte, source string) error) (int, error) {
+    count := 0
+    for _, pattern := range patterns {
+        layouts, err := filepath.Glob(filepath.Join(l.root, pattern))
+        if err != nil {
+            return count, err
+        }
+        for _, filename := range layouts {
+            yamlFile, err := ioutil.ReadFile(filename)
+            if err != nil {
+              return count, err
+            }
+            err = decodeYAMLDocuments(yamlFile, func(jsonDoc []byte) error {
+                if err := store(jsonDoc, l.source(filename)); err == nil {
+                    count++
+                }
+                return nil
+            })
+            if err != nil {
+                l.objectStore.Fail(kind, l.source(filename), err)
+            }
+        }
+    }
+    return count, nil
+}
+
+// processStorageYAMLs reads the objects behind the volumes of VMs: the CDI
+// DataVolumes, the claims, their PVs and the storage classes. Like VMs, they
+// are collected either one per file or combined in one file.
+func (l *logsHandler) processStorageYAMLs() (int, error) {
+    l.handlerLock.Lock()
+    defer l.handlerLock.Unlock()
+
+    kinds := []struct {
+        kind     string
+        patterns []string
+        store    func(jsonDoc []byte, source string) error
+    }{
+        {"StorageClass", []string{"cluster-scoped-resources/storage.k8s.io/storageclasses/*.yaml", "cluster-scoped-resources/storage.k8s.io/storageclasses.yaml"}, l.storeStorageClassData},
+        {"PersistentVolume", []string{"cluster-scoped-resources/core/persistentvolumes/*.yaml", "cluster-scoped-resources/core/persistentvolumes.yaml"}, l.storePVData},
+        {"PersistentVolumeClaim", []string{"namespaces/*/core/persistentvolumeclaims/*.yaml", "namespaces/*/core/persistentvolumeclaims.yaml"}, l.storePVCData},
+        {"DataVolume", []string{"namespaces/*/cdi.kubevirt.io/datavolumes/*.yaml", "namespaces/*/cdi.kubevirt.io/datavolumes.yaml"}, l.storeDataVolumeData},
+    }
+    count := 0
+    for _, k := range kinds {
+        kindCount, err := l.processYAMLFiles(k.kind, k.patterns, k.store)
+        count += kindCount
+        if err != nil {
+            return count, err
+        }
+    }
+
+    log.Log.Println("finished processing storage YAMLs")
+    return count, nil
+}
+
+// kubeVirtComponents are the deployments and daemonsets, of all those in the
+// must-gather, that processClusterYAMLs stores.
+var kubeVirtComponents = map[string]bool{
+    "virt-api":        true,
+    "virt-controller": true,
+    "virt-handler":    true,
+    "virt-operator":   true,
+}
+
+func (l *logsHandler) storeKubeVirtData(jsonDoc []byte, source string) error {
+    var kv kubevirtv1.KubeVirt
+
+    err := yaml.Unmarshal(jsonDoc, &kv)
+    if err != nil {
+      log.Log.Println("failed to unmarshal kubevirt yaml  - ", err)
+      l.objectStore.Fail("KubeVirt", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&kv, source)
+    return nil
+}
+
+func (l *logsHandler) storeHyperConvergedData(jsonDoc []byte, source string) error {
+    var hco unstructured.Unstructured
+
+    err := yaml.Unmarshal(jsonDoc, &hco.Object)
+    if err != nil {
+      log.Log.Println("failed to unmarshal hyperconverged yaml  - ", err)
+      l.objectStore.Fail("HyperConverged", source, err)
+      return err
+    }
+
+    l.objectStore.Add(&hco, source)
+    return nil
+}
+
+func (l *logsHandler) storeDeploymentData(jsonDoc []byte, source string) error {
+    var deployment appsv1.Deployment
+
+    err := yaml.Unmarshal(jsonDoc, &deployment)
+    if err != nil {
+      log.Log.Println("failed to unmarshal deployment yaml  - ", err)
+      l.objectStore.Fail("Deployment", source, err)
+      return err
+    }
+    if !kubeVirtComponents[deployment.Name] {
+        return fmt.Errorf("deployment %s is not a kubevirt component", deployment.Name)
+    }
+
+    l.objectStore.Add(&deployment, source)
+    return nil
+}
+
+func (l *logsHandler) storeDaemonSetData(jsonDoc []byte, source string) error {
+    var daemonSet appsv1.DaemonSet
+
+    err := yaml.Unmarshal(jsonDoc, &daemonSet)
+    if err != nil {
+      log.Log.Println("failed to unmarshal daemonset yaml  - ", err)
+      l.objectStore.Fail("DaemonSet", source, err)
+      return err
+    }
+    if !kubeVirtComponents[daemonSet.Name] {
+        return fmt.Errorf("daemonset %s is not a kubevirt component", daemonSet.Name)
+    }
+
+    l.objectStore.Add(&daemonSet, source)
+    return nil
+}
+
+// processClusterYAMLs reads how KubeVirt is deployed: the KubeVirt and
+// HyperConverged CRs and the deployments and daemonsets of the KubeVirt
+// components, skipping every other workload of their namespaces.
+func (l *logsHandler) processClusterYAMLs() (int, error) {
+    l.handlerLock.Lock()
+    defer l.handlerLock.Unlock()
+
+    kinds := []struct {
+        kind     string
+        patterns []string
+        store    func(jsonDoc []byte, source string) error
+    }{
+        {"KubeVirt", []string{"namespaces/*/kubevirt.io/kubevirts/*.yaml", "namespaces/*/kubevirt.io/kubevirts.yaml"}, l.storeKubeVirtData},
+        {"HyperConverged", []string{"namespaces/*/hco.kubevirt.io/hyperconvergeds/*.yaml", "namespaces/*/hco.kubevirt.io/hyperconvergeds.yaml"}, l.storeHyperConvergedData},
+        {"Deployment", []string{"namespaces/*/apps/deployments/*.yaml", "namespaces/*/apps/deployments.yaml"}, l.storeDeploymentData},
+        {"DaemonSet", []string{"namespaces/*/apps/daemonsets/*.yaml", "namespaces/*/apps/daemonsets.yaml"}, l.storeDaemonSetData},
+    }
+    count := 0
+    for _, k := range kinds {
+        kindCount, err := l.processYAMLFiles(k.kind, k.patterns, k.store)
+        count += kindCount
+        if err != nil {
+            return count, err
+        }
+    }
+
+    log.Log.Println("finished processing cluster YAMLs")
+    return count, nil
+}
+
+// processResourceYAMLs reads the objects of the kinds of registry, which have
+// no table of their own, skipping objects of other kinds found in their
+// files.
+func (l *logsHandler) processResourceYAMLs(registry *resources.Registry) (int, error) {
+    l.handlerLock.Lock()
+    defer l.handlerLock.Unlock()
+
+    count := 0
+    for _, kind := range registry.Kinds() {
+        kind := kind
+        kindCount, err := l.processYAMLFiles(kind.Name, kind.Patterns, func(jsonDoc []byte, source string) error {
+            var obj unstructured.Unstructured
+            if err := yaml.Unmarshal(jsonDoc, &obj.Object); err != nil {
+                log.Log.Println("failed to unmarshal ", kind.Name, " yaml  - ", err)
+                l.objectStore.Fail(kind.Name, source, err)
+                return err
+            }
+            if !kind.Matches(&obj) {
+                return fmt.Errorf("%s is not of kind %s", obj.GroupVersionKind(), kind.Name)
+            }
+            fields, err := kind.Extract(&obj)
+            if err != nil {
+                l.objectStore.Fail(kind.Name, source, err)
+                return err
+            }
+            l.objectStore.AddResource(kind.Name, &obj, fields, source)
+            return nil
+        })
+        count += kindCount
+        if err != nil {
+            return count, err
+        }
+    }
+
+    log.Log.Println("finished processing resource YAMLs")
+    return count, nil
+}
+
+// indexLogs streams the extracted container logs into Elasticsearch, joined
+// with the enrichment data collected by processPodYAMLs.
+func (l *logsHandler) indexLogs() (ingest.Stats, error) {
+    l.handlerLock.Lock()
+    defer l.handlerLock.Unlock()
+
+    enrichment := make(map[string]interface{}, len(l.lookupData))
+    for key, data := range l.lookupData {
+        enrichment[key] = data
+    }
+
+    indexer := ingest.NewElasticsearchIndexer(l.config.Elasticsearch.URL, l.config.CaseIndexPrefix(l.caseID))
+    stats, err := ingest.NewIngester(l.root, enrichment, indexer).Run()
+    if err != nil {
+        log.Log.Println("failed to index logs: ", err, " stats: ", stats)
+        return stats, err
+    }
+    log.Log.Println("finished indexing logs")
+    return stats, nil
+}
+
+// source is the path of a file of the must-gather, relative to its root, as
+// recorded with dead letters.
+func (l *logsHandler) source(filename string) string {
+    if rel, err := filepath.Rel(l.root, filename); err == nil {
+        return rel
+    }
+    return filename
+}
+
+// commitObjects stores every object collected by the process* functions at
+// once and returns how many of each kind were stored, and how many objects
+// became dead letters.
+func (l *logsHandler) commitObjects() (map[string]int, int, error) {
+    return l.objectStore.Commit()
+}
@@ -0,0 +1,159 @@
+package logstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"logsviewer/pkg/backend/ingest"
+	"logsviewer/pkg/backend/logquery"
+)
+
+// ElasticsearchStore searches the indices written by ingest.ElasticsearchIndexer.
+type ElasticsearchStore struct {
+	url          string
+	indexPattern string
+	client       *http.Client
+}
+
+func NewElasticsearchStore(url string, indexPattern string) *ElasticsearchStore {
+	return &ElasticsearchStore{
+		url:          strings.TrimSuffix(url, "/"),
+		indexPattern: indexPattern,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type searchResponse struct {
+	Hits struct {
+		Hits []struct {
+			Source ingest.Document `json:"_source"`
+			Sort   []interface{}   `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func (e *ElasticsearchStore) buildRequest(query Query) (map[string]interface{}, error) {
+	filter := []interface{}{}
+	timeRange := map[string]interface{}{}
+	if !query.From.IsZero() {
+		timeRange["gte"] = query.From.UTC().Format(time.RFC3339Nano)
+	}
+	if !query.To.IsZero() {
+		timeRange["lte"] = query.To.UTC().Format(time.RFC3339Nano)
+	}
+	if len(timeRange) > 0 {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"@timestamp": timeRange}})
+	}
+	if len(query.Levels) > 0 {
+		filter = append(filter, terms("level.keyword", query.Levels))
+	}
+
+	boolQuery := map[string]interface{}{"filter": filter}
+	if len(query.Exclude) > 0 {
+		mustNot := make([]interface{}, 0, len(query.Exclude))
+		for _, rule := range query.Exclude {
+			mustNot = append(mustNot, logquery.ExclusionClause(rule))
+		}
+		boolQuery["must_not"] = mustNot
+	}
+	if query.hasCorrelation() {
+		should := []interface{}{}
+		if len(query.PodNames) > 0 {
+			should = append(should, terms("podName.keyword", query.PodNames))
+		}
+		if len(query.Components) > 0 {
+			should = append(should,
+				terms("containerName.keyword", query.Components),
+				terms("component.keyword", query.Components))
+		}
+		for _, uid := range query.UIDs {
+			should = append(should, map[string]interface{}{
+				"multi_match": map[string]interface{}{"query": uid, "type": "phrase", "fields": []string{"*"}, "lenient": true},
+			})
+		}
+		boolQuery["should"] = should
+		boolQuery["minimum_should_match"] = 1
+	}
+
+	request := map[string]interface{}{
+		"size":  query.limit(),
+		"query": map[string]interface{}{"bool": boolQuery},
+		// path and line offset break ties between lines logged in the same instant
+		"sort": []interface{}{
+			map[string]string{"@timestamp": "asc"},
+			map[string]string{"log.file.path.keyword": "asc"},
+			map[string]string{"log.offset": "asc"},
+		},
+	}
+	if query.Cursor != "" {
+		position, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		request["search_after"] = position
+	}
+	return request, nil
+}
+
+func terms(field string, values []string) map[string]interface{} {
+	return map[string]interface{}{"terms": map[string]interface{}{field: values}}
+}
+
+func (e *ElasticsearchStore) Search(query Query) (Page, error) {
+	page := Page{Lines: []Line{}}
+	request, err := e.buildRequest(query)
+	if err != nil {
+		return page, err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return page, err
+	}
+
+	url := fmt.Sprintf("%s/%s/_search?ignore_unavailable=true&allow_no_indices=true", e.url, e.indexPattern)
+	httpRequest, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return page, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := e.client.Do(httpRequest)
+	if err != nil {
+		return page, err
+	}
+	defer response.Body.Close()
+
+	respBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return page, err
+	}
+	if response.StatusCode >= 300 {
+		return page, fmt.Errorf("log search failed with %s: %s", response.Status, string(respBody))
+	}
+
+	var result searchResponse
+	dec := json.NewDecoder(bytes.NewReader(respBody))
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil {
+		return page, fmt.Errorf("failed to decode search response: %v", err)
+	}
+
+	hits := result.Hits.Hits
+	for _, hit := range hits {
+		if ts, ok := hit.Source["@timestamp"].(string); ok {
+			if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				hit.Source["@timestamp"] = parsed
+			}
+		}
+		page.Lines = append(page.Lines, lineFromDocument(hit.Source))
+	}
+	if len(hits) == query.limit() {
+		page.NextCursor = encodeCursor(hits[len(hits)-1].Sort)
+	}
+	return page, nil
+}
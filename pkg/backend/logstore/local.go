@@ -0,0 +1,246 @@
+package logstore
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"logsviewer/pkg/backend/ingest"
+	"logsviewer/pkg/backend/log"
+)
+
+// maxLineSize is the longest line searched; container logs can carry long
+// JSON lines, e.g. full domain XML dumps.
+const maxLineSize = 4 * 1024 * 1024
+
+// LocalStore searches the container log files of an extracted must-gather
+// directly, so logs can be browsed without an Elasticsearch instance.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+type localLine struct {
+	line   Line
+	path   string
+	offset int
+}
+
+// position mirrors the Elasticsearch sort: timestamp, file path, line offset.
+func (l localLine) position() []interface{} {
+	return []interface{}{l.line.Timestamp.UnixNano(), l.path, l.offset}
+}
+
+// before reports whether l sorts before other.
+func (l localLine) before(other localLine) bool {
+	if !l.line.Timestamp.Equal(other.line.Timestamp) {
+		return l.line.Timestamp.Before(other.line.Timestamp)
+	}
+	if l.path != other.path {
+		return l.path < other.path
+	}
+	return l.offset < other.offset
+}
+
+func (l localLine) after(position []interface{}) (bool, error) {
+	if len(position) != 3 {
+		return false, fmt.Errorf("invalid cursor")
+	}
+	tsNumber, ok1 := position[0].(json.Number)
+	path, ok2 := position[1].(string)
+	offsetNumber, ok3 := position[2].(json.Number)
+	if !ok1 || !ok2 || !ok3 {
+		return false, fmt.Errorf("invalid cursor")
+	}
+	ts, err1 := tsNumber.Int64()
+	offset, err2 := offsetNumber.Int64()
+	if err1 != nil || err2 != nil {
+		return false, fmt.Errorf("invalid cursor")
+	}
+	if current := l.line.Timestamp.UnixNano(); current != ts {
+		return current > ts, nil
+	}
+	if l.path != path {
+		return l.path > path, nil
+	}
+	return int64(l.offset) > offset, nil
+}
+
+func (s *LocalStore) Search(query Query) (Page, error) {
+	page := Page{Lines: []Line{}}
+	var position []interface{}
+	if query.Cursor != "" {
+		var err error
+		if position, err = decodeCursor(query.Cursor); err != nil {
+			return page, err
+		}
+	}
+
+	files, err := ingest.LogFiles(s.root)
+	if err != nil {
+		return page, err
+	}
+
+	// one more line than the limit tells whether there is a next page
+	limit := query.limit()
+	matches := &candidates{limit: limit + 1}
+	for _, path := range files {
+		fields, err := ingest.ParsePath(path)
+		if err != nil {
+			continue
+		}
+		if err := s.searchFile(path, fields, query, position, matches); err != nil {
+			return page, err
+		}
+	}
+
+	lines := matches.sorted()
+	if len(lines) > limit {
+		lines = lines[:limit]
+		page.NextCursor = encodeCursor(lines[limit-1].position())
+	}
+	for _, match := range lines {
+		page.Lines = append(page.Lines, match.line)
+	}
+	return page, nil
+}
+
+// searchFile adds the lines of path that match query and sort after position
+// to matches. A line too long to read ends the search of the file, the lines
+// before it are kept.
+func (s *LocalStore) searchFile(path string, fields ingest.PathFields, query Query, position []interface{}, matches *candidates) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	offset := 0
+	for scanner.Scan() {
+		offset++
+		raw := scanner.Text()
+		doc, err := ingest.ParseLine(raw)
+		if err != nil {
+			continue
+		}
+		ingest.Annotate(doc, path, offset, fields)
+		line := lineFromDocument(doc)
+		if !matchLine(query, line, raw) {
+			continue
+		}
+		candidate := localLine{line: line, path: path, offset: offset}
+		if position != nil {
+			after, err := candidate.after(position)
+			if err != nil {
+				return err
+			}
+			if !after {
+				continue
+			}
+		}
+		matches.add(candidate)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			log.Log.Println("skipping the rest of ", path, ": line ", offset+1, " is longer than ", maxLineSize, " bytes")
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// candidates keeps the first limit lines, in sort order, of the lines added
+// to it. They are kept in a max-heap, so the line that sorts last is the one
+// dropped when a line that sorts before it is added.
+type candidates struct {
+	lines []localLine
+	limit int
+}
+
+func (c *candidates) Len() int           { return len(c.lines) }
+func (c *candidates) Less(i, j int) bool { return c.lines[j].before(c.lines[i]) }
+func (c *candidates) Swap(i, j int)      { c.lines[i], c.lines[j] = c.lines[j], c.lines[i] }
+
+func (c *candidates) Push(x interface{}) {
+	c.lines = append(c.lines, x.(localLine))
+}
+
+func (c *candidates) Pop() interface{} {
+	last := c.lines[len(c.lines)-1]
+	c.lines = c.lines[:len(c.lines)-1]
+	return last
+}
+
+func (c *candidates) add(line localLine) {
+	if len(c.lines) < c.limit {
+		heap.Push(c, line)
+		return
+	}
+	if line.before(c.lines[0]) {
+		c.lines[0] = line
+		heap.Fix(c, 0)
+	}
+}
+
+// sorted returns the lines in sort order.
+func (c *candidates) sorted() []localLine {
+	sort.Slice(c.lines, func(i, j int) bool {
+		return c.lines[i].before(c.lines[j])
+	})
+	return c.lines
+}
+
+func matchLine(query Query, line Line, raw string) bool {
+	if !query.From.IsZero() && line.Timestamp.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && line.Timestamp.After(query.To) {
+		return false
+	}
+	if len(query.Levels) > 0 && !contains(query.Levels, line.Level) {
+		return false
+	}
+	for _, rule := range query.Exclude {
+		if rule.Matches(line.Component, line.Message) {
+			return false
+		}
+	}
+	if !query.hasCorrelation() {
+		return true
+	}
+	if contains(query.PodNames, line.PodName) {
+		return true
+	}
+	if contains(query.Components, line.ContainerName) || contains(query.Components, line.Component) {
+		return true
+	}
+	for _, uid := range query.UIDs {
+		if strings.Contains(raw, uid) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
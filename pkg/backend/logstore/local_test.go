@@ -0,0 +1,180 @@
+package logstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"logsviewer/pkg/backend/noise"
+)
+
+// writePodLog writes lines as the current log of the compute container of pod
+// under root.
+func writePodLog(t *testing.T, root string, pod string, lines ...string) {
+	t.Helper()
+	logDir := filepath.Join(root, "namespaces", "default", "pods", pod, "compute", "compute", "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "current.log"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// logLine is a JSON log line written at second of 2022-10-01T12:00:00Z.
+func logLine(second int, msg string) string {
+	return fmt.Sprintf(`{"component":"virt-launcher","level":"info","msg":%q,"timestamp":"%s"}`,
+		msg, time.Date(2022, 10, 1, 12, 0, second, 0, time.UTC).Format(time.RFC3339))
+}
+
+func messages(page Page) []string {
+	msgs := []string{}
+	for _, line := range page.Lines {
+		msgs = append(msgs, line.Message)
+	}
+	return msgs
+}
+
+func TestLocalSearchReturnsTheFirstLinesInOrder(t *testing.T) {
+	root := t.TempDir()
+	// both files are out of order, and vm1 and vm2 share the second 3
+	writePodLog(t, root, "virt-launcher-vm1", logLine(3, "vm1 3"), logLine(1, "vm1 1"), logLine(5, "vm1 5"))
+	writePodLog(t, root, "virt-launcher-vm2", logLine(4, "vm2 4"), logLine(3, "vm2 3"), logLine(0, "vm2 0"))
+
+	page, err := NewLocalStore(root).Search(Query{Limit: 4})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	want := []string{"vm2 0", "vm1 1", "vm1 3", "vm2 3"}
+	if got := messages(page); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+	if page.NextCursor == "" {
+		t.Errorf("Search() has no next cursor, want one for the 2 lines left")
+	}
+
+	page, err = NewLocalStore(root).Search(Query{Limit: 6})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(page.Lines) != 6 || page.NextCursor != "" {
+		t.Errorf("Search() = %d lines, cursor %q, want all 6 lines and no cursor", len(page.Lines), page.NextCursor)
+	}
+}
+
+func TestLocalSearchSkipsFilesWithOverlongLines(t *testing.T) {
+	root := t.TempDir()
+	writePodLog(t, root, "virt-launcher-vm1", logLine(0, "vm1 0"), strings.Repeat("x", maxLineSize+1), logLine(2, "vm1 2"))
+	writePodLog(t, root, "virt-launcher-vm2", logLine(1, "vm2 1"))
+
+	page, err := NewLocalStore(root).Search(Query{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	// the lines before the long one are kept, the file is not read past it
+	want := []string{"vm1 0", "vm2 1"}
+	if got := messages(page); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+}
+
+func TestLocalSearchPagesPastTheCursor(t *testing.T) {
+	root := t.TempDir()
+	// lines of the same second sort by path, then by line
+	writePodLog(t, root, "virt-launcher-vm1", logLine(0, "vm1 0"), logLine(2, "vm1 2a"), logLine(2, "vm1 2b"), logLine(4, "vm1 4"))
+	writePodLog(t, root, "virt-launcher-vm2", logLine(1, "vm2 1"), logLine(2, "vm2 2"), logLine(3, "vm2 3"))
+	want := []string{"vm1 0", "vm2 1", "vm1 2a", "vm1 2b", "vm2 2", "vm2 3", "vm1 4"}
+
+	store := NewLocalStore(root)
+	for _, limit := range []int{1, 2, 3, len(want)} {
+		var got []string
+		query := Query{Limit: limit}
+		for pages := 0; ; pages++ {
+			if pages > len(want) {
+				t.Fatalf("limit %d: Search() did not stop paging", limit)
+			}
+			page, err := store.Search(query)
+			if err != nil {
+				t.Fatalf("limit %d: Search() error = %v", limit, err)
+			}
+			if len(page.Lines) > limit {
+				t.Errorf("limit %d: Search() returned %d lines", limit, len(page.Lines))
+			}
+			got = append(got, messages(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("limit %d: pages = %q, want %q", limit, got, want)
+		}
+	}
+
+	for _, cursor := range []string{"not base64!", encodeCursor([]interface{}{1, "path"}), encodeCursor([]interface{}{"1", "path", 1})} {
+		if _, err := store.Search(Query{Cursor: cursor}); err == nil {
+			t.Errorf("Search() with the cursor %q did not fail", cursor)
+		}
+	}
+}
+
+func TestLocalSearchFiltersLines(t *testing.T) {
+	root := t.TempDir()
+	line := func(second int, component string, level string, msg string) string {
+		return fmt.Sprintf(`{"component":%q,"level":%q,"msg":%q,"timestamp":"%s"}`,
+			component, level, msg, time.Date(2022, 10, 1, 12, 0, second, 0, time.UTC).Format(time.RFC3339))
+	}
+	writePodLog(t, root, "virt-launcher-vm1",
+		line(0, "virt-launcher", "info", "vm1 started"),
+		line(1, "virt-launcher", "error", "vm1 certificate retrieved."),
+		line(2, "virt-launcher", "error", "vm1 guest agent disconnected"))
+	writePodLog(t, root, "virt-handler-abcde",
+		line(3, "virt-handler", "info", "processing vmi 1111-aaaa"),
+		line(4, "virt-handler", "error", "handler guest agent disconnected"),
+		line(5, "virt-handler", "info", "unrelated"))
+
+	// the rule set compiles the regular expressions
+	rules := &noise.Set{}
+	err := rules.Replace([]noise.Rule{
+		{ID: "certificate", Phrase: "certificate retrieved."},
+		{ID: "agent", Component: "virt-handler", Regex: "guest agent .*connected"},
+	})
+	if err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	exclude := rules.Rules()
+
+	for _, tc := range []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"everything", Query{}, []string{
+			"vm1 started", "vm1 certificate retrieved.", "vm1 guest agent disconnected",
+			"processing vmi 1111-aaaa", "handler guest agent disconnected", "unrelated"}},
+		{"noise of every component and of virt-handler", Query{Exclude: exclude}, []string{
+			"vm1 started", "vm1 guest agent disconnected", "processing vmi 1111-aaaa", "unrelated"}},
+		{"pod or uid", Query{PodNames: []string{"virt-launcher-vm1"}, UIDs: []string{"1111-aaaa"}, Exclude: exclude}, []string{
+			"vm1 started", "vm1 guest agent disconnected", "processing vmi 1111-aaaa"}},
+		{"component", Query{Components: []string{"virt-handler"}}, []string{
+			"processing vmi 1111-aaaa", "handler guest agent disconnected", "unrelated"}},
+		{"levels", Query{Levels: []string{"error"}, Exclude: exclude}, []string{"vm1 guest agent disconnected"}},
+		{"time range", Query{
+			From: time.Date(2022, 10, 1, 12, 0, 1, 0, time.UTC),
+			To:   time.Date(2022, 10, 1, 12, 0, 3, 0, time.UTC),
+		}, []string{"vm1 certificate retrieved.", "vm1 guest agent disconnected", "processing vmi 1111-aaaa"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := NewLocalStore(root).Search(tc.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if got := messages(page); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("Search() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
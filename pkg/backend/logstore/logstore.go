@@ -0,0 +1,132 @@
+package logstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"logsviewer/pkg/backend/ingest"
+	"logsviewer/pkg/backend/noise"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Query selects log lines by the same correlation inputs used for the
+// generated Kibana queries. A line matches when it belongs to one of PodNames,
+// was written by one of Components, or mentions one of UIDs; when all three
+// are empty every line matches. Levels and the time window further narrow it.
+type Query struct {
+	PodNames   []string
+	UIDs       []string
+	Components []string
+	Levels     []string
+	From       time.Time
+	To         time.Time
+	// Exclude drops the lines matching any of the noise rules.
+	Exclude []noise.Rule
+	// Cursor is the NextCursor of the previous page, empty for the first page.
+	Cursor string
+	Limit  int
+}
+
+// Line is a single log line returned by a LogStore.
+type Line struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	Namespace     string                 `json:"namespace"`
+	PodName       string                 `json:"podName"`
+	ContainerName string                 `json:"containerName"`
+	Component     string                 `json:"component,omitempty"`
+	Level         string                 `json:"level,omitempty"`
+	Message       string                 `json:"msg"`
+	Fields        map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Page is one page of results. NextCursor is empty on the last page.
+type Page struct {
+	Lines      []Line `json:"data"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// LogStore searches the log lines of an imported must-gather.
+type LogStore interface {
+	Search(query Query) (Page, error)
+}
+
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+func (q Query) hasCorrelation() bool {
+	return len(q.PodNames) > 0 || len(q.UIDs) > 0 || len(q.Components) > 0
+}
+
+// encodeCursor and decodeCursor keep the sort position of the last returned
+// line opaque to clients.
+func encodeCursor(position []interface{}) string {
+	raw, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	var position []interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&position); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	return position, nil
+}
+
+var lineFields = map[string]bool{
+	"@timestamp":    true,
+	"namespace":     true,
+	"podName":       true,
+	"containerName": true,
+	"component":     true,
+	"level":         true,
+	"msg":           true,
+}
+
+func lineFromDocument(doc ingest.Document) Line {
+	line := Line{
+		Timestamp:     doc.Timestamp(),
+		Namespace:     stringField(doc, "namespace"),
+		PodName:       stringField(doc, "podName"),
+		ContainerName: stringField(doc, "containerName"),
+		Component:     stringField(doc, "component"),
+		Level:         stringField(doc, "level"),
+		Message:       stringField(doc, "msg"),
+		Fields:        map[string]interface{}{},
+	}
+	if line.Message == "" {
+		line.Message = stringField(doc, "message")
+	}
+	for key, value := range doc {
+		if !lineFields[key] && key != "message" {
+			line.Fields[key] = value
+		}
+	}
+	return line
+}
+
+func stringField(doc ingest.Document, field string) string {
+	if value, ok := doc[field].(string); ok {
+		return value
+	}
+	return ""
+}
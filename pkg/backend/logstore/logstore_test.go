@@ -0,0 +1,37 @@
+package logstore
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	position := []interface{}{int64(1664625600123456789), "namespaces/default/pods/virt-launcher-vm1/compute/compute/logs/current.log", 42}
+	cursor := encodeCursor(position)
+	got, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("decodeCursor(%q) error = %v", cursor, err)
+	}
+	// the numbers are kept exact, nanoseconds do not fit in a float64
+	want := []interface{}{json.Number("1664625600123456789"), position[1], json.Number("42")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeCursor(%q) = %#v, want %#v", cursor, got, want)
+	}
+}
+
+func TestDecodeCursorRejectsMalformedCursors(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "WzE", "e30"} {
+		if position, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) = %v, want an error", cursor, position)
+		}
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	for limit, want := range map[int]int{-1: DefaultLimit, 0: DefaultLimit, 10: 10, MaxLimit + 1: MaxLimit} {
+		if got := (Query{Limit: limit}).limit(); got != want {
+			t.Errorf("Query{Limit: %d}.limit() = %d, want %d", limit, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/log"
+	"logsviewer/pkg/backend/noise"
+)
+
+// loadNoiseRules reads the rule file of the configuration, keeping the built-in
+// rules when it can not be read.
+func (s *server) loadNoiseRules() {
+	rules, err := noise.Load(s.config.NoiseRulesFile)
+	if err != nil {
+		log.Log.Println("failed to load the noise rules, using the built-in ones: ", err)
+		return
+	}
+	s.noiseRules = rules
+}
+
+// caseNoiseRules returns the noise rules in effect for the KubeVirt version of
+// the case dbInst is scoped to.
+func (s *server) caseNoiseRules(dbInst db.Store) []noise.Rule {
+	version, err := dbInst.GetKubeVirtVersion()
+	if err != nil {
+		log.Log.Println("failed to get the kubevirt version", err)
+	}
+	return s.noiseRules.For(version)
+}
+
+func writeNoiseRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, noise.ErrRuleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, noise.ErrRuleExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, noise.ErrInvalidRule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Log.Println("failed to update the noise rules", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// readYAMLBody decodes a JSON or YAML request body.
+func readYAMLBody(r *http.Request, into interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(body, into); err != nil {
+		return fmt.Errorf("%w: %v", noise.ErrInvalidRule, err)
+	}
+	return nil
+}
+
+// noiseRulesHandler serves /api/noise-rules: GET lists the rules, PUT
+// replaces them all with a rule file and POST adds a single rule.
+func (s *server) noiseRulesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Log.Println("Noise Rules Endpoint Hit: ", r.Method)
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, map[string]interface{}{
+			"rules": s.noiseRules.Rules(),
+		})
+	case http.MethodPut:
+		file := struct {
+			Rules []noise.Rule `json:"rules"`
+		}{}
+		if err := readYAMLBody(r, &file); err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		if err := s.noiseRules.Replace(file.Rules); err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"rules": s.noiseRules.Rules(),
+		})
+	case http.MethodPost:
+		rule := noise.Rule{}
+		if err := readYAMLBody(r, &rule); err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		rule, err := s.noiseRules.Add(rule)
+		if err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		writeJSON(w, rule)
+	default:
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// noiseRuleHandler serves GET, PUT and DELETE on /api/noise-rules/<id>.
+func (s *server) noiseRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/noise-rules/")
+	log.Log.Println("Noise Rule Endpoint Hit: ", r.Method, id)
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := s.noiseRules.Get(id)
+		if err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		writeJSON(w, rule)
+	case http.MethodPut:
+		rule := noise.Rule{}
+		if err := readYAMLBody(r, &rule); err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		rule.ID = id
+		if err := s.noiseRules.Put(rule); err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		writeJSON(w, rule)
+	case http.MethodDelete:
+		if err := s.noiseRules.Delete(id); err != nil {
+			writeNoiseRuleError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,268 @@
+// Package noise keeps the rules for known-benign log messages, which are left
+// out of the generated log queries and of the log search.
+package noise
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrRuleNotFound = errors.New("noise rule not found")
+	ErrRuleExists   = errors.New("noise rule already exists")
+	ErrInvalidRule  = errors.New("invalid noise rule")
+)
+
+// Rule excludes the log messages containing Phrase, or matching Regex. It can
+// be limited to the lines of a single component and to some KubeVirt versions.
+type Rule struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	// Component is the "component" field of the line, e.g. virt-handler.
+	// Empty applies the rule to every component.
+	Component string `json:"component,omitempty"`
+	// Versions are KubeVirt version prefixes, e.g. "v0.58" for every v0.58.z
+	// release. Empty applies the rule to every version.
+	Versions []string `json:"versions,omitempty"`
+	Phrase   string   `json:"phrase,omitempty"`
+	// Regex is a Go regular expression matched anywhere in the message.
+	Regex string `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (r *Rule) validate() error {
+	if (r.Phrase == "") == (r.Regex == "") {
+		return fmt.Errorf("%w %q: exactly one of phrase and regex is required", ErrInvalidRule, r.ID)
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("%w %q: %v", ErrInvalidRule, r.ID, err)
+		}
+		r.re = re
+	}
+	return nil
+}
+
+// AppliesTo reports whether the rule is in effect for a KubeVirt version. Only
+// the rules for every version apply when the version is unknown.
+func (r Rule) AppliesTo(version string) bool {
+	if len(r.Versions) == 0 {
+		return true
+	}
+	for _, prefix := range r.Versions {
+		if version != "" && strings.HasPrefix(version, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether a message logged by component is noise.
+func (r Rule) Matches(component string, message string) bool {
+	if r.Component != "" && r.Component != component {
+		return false
+	}
+	if r.Phrase != "" {
+		return strings.Contains(message, r.Phrase)
+	}
+	return r.re != nil && r.re.MatchString(message)
+}
+
+type ruleFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// DefaultRules are used until a rule file is saved.
+func DefaultRules() []Rule {
+	return []Rule{{
+		ID:          "virt-handler-client-certificate",
+		Description: "virt-handler logs this for every client certificate refresh",
+		Phrase:      "certificate with common name 'kubevirt.io:system:client:virt-handler' retrieved.",
+	}}
+}
+
+// Set is the rule set of the service, kept in a YAML file:
+//
+//	rules:
+//	- id: virt-handler-client-certificate
+//	  component: virt-handler
+//	  versions: ["v0.58"]
+//	  phrase: certificate with common name 'kubevirt.io:system:client:virt-handler' retrieved.
+type Set struct {
+	path  string
+	lock  sync.RWMutex
+	rules []Rule
+}
+
+// Load reads the rules in path. A missing file leaves the DefaultRules in
+// place, and the file is written on the first change.
+func Load(path string) (*Set, error) {
+	s := &Set{path: path}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.rules = DefaultRules()
+		return s, s.prepare(s.rules)
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := ruleFile{}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse noise rules %s: %v", path, err)
+	}
+	if err := s.prepare(file.Rules); err != nil {
+		return nil, err
+	}
+	s.rules = file.Rules
+	return s, nil
+}
+
+// NewDefaultSet returns a set of the DefaultRules that is not saved anywhere.
+func NewDefaultSet() *Set {
+	s := &Set{rules: DefaultRules()}
+	s.prepare(s.rules)
+	return s
+}
+
+func (s *Set) prepare(rules []Rule) error {
+	seen := map[string]bool{}
+	for i := range rules {
+		if rules[i].ID == "" {
+			rules[i].ID = string(uuid.NewUUID())
+		}
+		if seen[rules[i].ID] {
+			return fmt.Errorf("%w: %s", ErrRuleExists, rules[i].ID)
+		}
+		seen[rules[i].ID] = true
+		if err := rules[i].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Set) save(rules []Rule) error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := yaml.Marshal(ruleFile{Rules: rules})
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// update validates and saves the rules returned by change before they replace
+// the current ones.
+func (s *Set) update(change func(rules []Rule) ([]Rule, error)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rules, err := change(s.List())
+	if err != nil {
+		return err
+	}
+	if err := s.prepare(rules); err != nil {
+		return err
+	}
+	if err := s.save(rules); err != nil {
+		return err
+	}
+	s.rules = rules
+	return nil
+}
+
+// List returns a copy of the rules, sorted by ID.
+func (s *Set) List() []Rule {
+	rules := append([]Rule{}, s.rules...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// Rules returns the rules, safe for concurrent use with the changes.
+func (s *Set) Rules() []Rule {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.List()
+}
+
+// For returns the rules in effect for a KubeVirt version.
+func (s *Set) For(version string) []Rule {
+	var rules []Rule
+	for _, rule := range s.Rules() {
+		if rule.AppliesTo(version) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (s *Set) Get(id string) (Rule, error) {
+	for _, rule := range s.Rules() {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+	return Rule{}, fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+}
+
+// Replace swaps all the rules at once.
+func (s *Set) Replace(rules []Rule) error {
+	return s.update(func([]Rule) ([]Rule, error) {
+		return rules, nil
+	})
+}
+
+// Add adds a rule, generating its ID when it has none.
+func (s *Set) Add(rule Rule) (Rule, error) {
+	if rule.ID == "" {
+		rule.ID = string(uuid.NewUUID())
+	}
+	err := s.update(func(rules []Rule) ([]Rule, error) {
+		for _, existing := range rules {
+			if existing.ID == rule.ID {
+				return nil, fmt.Errorf("%w: %s", ErrRuleExists, rule.ID)
+			}
+		}
+		return append(rules, rule), nil
+	})
+	return rule, err
+}
+
+// Put replaces the rule with the ID of rule.
+func (s *Set) Put(rule Rule) error {
+	return s.update(func(rules []Rule) ([]Rule, error) {
+		for i := range rules {
+			if rules[i].ID == rule.ID {
+				rules[i] = rule
+				return rules, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, rule.ID)
+	})
+}
+
+func (s *Set) Delete(id string) error {
+	return s.update(func(rules []Rule) ([]Rule, error) {
+		for i := range rules {
+			if rules[i].ID == id {
+				return append(rules[:i], rules[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+	})
+}
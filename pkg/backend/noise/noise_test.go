@@ -0,0 +1,203 @@
+package noise
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "noise-rules.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func ids(rules []Rule) []string {
+	ids := []string{}
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+	return ids
+}
+
+func TestLoad(t *testing.T) {
+	s, err := Load(writeRules(t, `
+rules:
+- id: handler-certificate
+  description: certificate refresh
+  component: virt-handler
+  versions: ["v0.58", "v0.59"]
+  phrase: certificate with common name 'kubevirt.io:system:client:virt-handler' retrieved.
+- id: reconcile
+  regex: "reconcil(ed|ing) [0-9]+ objects"
+- phrase: no id
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	rules := s.Rules()
+	if len(rules) != 3 {
+		t.Fatalf("Load() read %d rules, want 3", len(rules))
+	}
+	handler, err := s.Get("handler-certificate")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	want := Rule{
+		ID:          "handler-certificate",
+		Description: "certificate refresh",
+		Component:   "virt-handler",
+		Versions:    []string{"v0.58", "v0.59"},
+		Phrase:      "certificate with common name 'kubevirt.io:system:client:virt-handler' retrieved.",
+	}
+	if !reflect.DeepEqual(handler, want) {
+		t.Errorf("Get() = %+v, want %+v", handler, want)
+	}
+	// rules without an ID get a generated one
+	for _, rule := range rules {
+		if rule.ID == "" {
+			t.Errorf("rule %+v has no ID", rule)
+		}
+	}
+}
+
+func TestLoadMissingFileUsesTheDefaultRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "noise-rules.yaml")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, want := ids(s.Rules()), ids(DefaultRules()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, want the default rules %v", got, want)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Load() wrote the rule file before a change: %v", err)
+	}
+}
+
+func TestLoadRejectsInvalidRules(t *testing.T) {
+	for name, content := range map[string]string{
+		"malformed yaml":     "rules: [",
+		"invalid regex":      "rules:\n- id: broken\n  regex: \"(unclosed\"\n",
+		"phrase and regex":   "rules:\n- id: both\n  phrase: a\n  regex: b\n",
+		"no phrase or regex": "rules:\n- id: empty\n",
+		"duplicate id":       "rules:\n- id: twice\n  phrase: a\n- id: twice\n  phrase: b\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if s, err := Load(writeRules(t, content)); err == nil {
+				t.Errorf("Load() = %v, want an error", ids(s.Rules()))
+			}
+		})
+	}
+
+	_, err := Load(writeRules(t, "rules:\n- id: broken\n  regex: \"[a-\"\n"))
+	if !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Load() error = %v, want ErrInvalidRule", err)
+	}
+	_, err = Load(writeRules(t, "rules:\n- id: twice\n  phrase: a\n- id: twice\n  phrase: b\n"))
+	if !errors.Is(err, ErrRuleExists) {
+		t.Errorf("Load() error = %v, want ErrRuleExists", err)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	phrase := Rule{ID: "phrase", Phrase: "reconciled (1)"}
+	scoped := Rule{ID: "scoped", Component: "virt-handler", Regex: `^Processing event [a-z]+/vm\d+$`}
+	for _, rule := range []*Rule{&phrase, &scoped} {
+		if err := rule.validate(); err != nil {
+			t.Fatalf("validate() error = %v", err)
+		}
+	}
+	for _, tc := range []struct {
+		rule      Rule
+		component string
+		message   string
+		want      bool
+	}{
+		{phrase, "virt-handler", "object reconciled (1) times", true},
+		{phrase, "", "reconciled (1)", true},
+		{phrase, "virt-handler", "object reconciled 1 times", false},
+		{scoped, "virt-handler", "Processing event default/vm1", true},
+		{scoped, "virt-launcher", "Processing event default/vm1", false},
+		{scoped, "", "Processing event default/vm1", false},
+		{scoped, "virt-handler", "Processing event default/vm1 failed", false},
+	} {
+		if got := tc.rule.Matches(tc.component, tc.message); got != tc.want {
+			t.Errorf("%s.Matches(%q, %q) = %v, want %v", tc.rule.ID, tc.component, tc.message, got, tc.want)
+		}
+	}
+}
+
+func TestSetForVersion(t *testing.T) {
+	s := &Set{}
+	err := s.Replace([]Rule{
+		{ID: "every-version", Phrase: "a"},
+		{ID: "v0.58", Versions: []string{"v0.58"}, Phrase: "b"},
+		{ID: "v0.58-and-v1", Versions: []string{"v0.58", "v1."}, Phrase: "c"},
+	})
+	if err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	for version, want := range map[string][]string{
+		"v0.58.1":  {"every-version", "v0.58", "v0.58-and-v1"},
+		"v0.59.0":  {"every-version"},
+		"v1.0.0":   {"every-version", "v0.58-and-v1"},
+		"v10.58.0": {"every-version"},
+		"":         {"every-version"},
+	} {
+		if got := ids(s.For(version)); !reflect.DeepEqual(got, want) {
+			t.Errorf("For(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestSetChangesAreSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "noise-rules.yaml")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	added, err := s.Add(Rule{Component: "virt-launcher", Regex: "guest agent.*disconnected"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if added.ID == "" {
+		t.Errorf("Add() did not generate an ID")
+	}
+	if _, err := s.Add(Rule{ID: added.ID, Phrase: "again"}); !errors.Is(err, ErrRuleExists) {
+		t.Errorf("Add() of an existing ID error = %v, want ErrRuleExists", err)
+	}
+	if err := s.Put(Rule{ID: "missing", Phrase: "a"}); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Put() of a missing ID error = %v, want ErrRuleNotFound", err)
+	}
+	if err := s.Put(Rule{ID: added.ID, Regex: "(unclosed"}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Put() of an invalid regex error = %v, want ErrInvalidRule", err)
+	}
+	if err := s.Put(Rule{ID: added.ID, Component: "virt-launcher", Versions: []string{"v0.58"}, Phrase: "disconnected"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := s.Delete(DefaultRules()[0].ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := s.Delete(DefaultRules()[0].ID); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Delete() again error = %v, want ErrRuleNotFound", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of the saved rules error = %v", err)
+	}
+	want := []Rule{{ID: added.ID, Component: "virt-launcher", Versions: []string{"v0.58"}, Phrase: "disconnected"}}
+	if got := reloaded.Rules(); !reflect.DeepEqual(got, want) {
+		t.Errorf("saved rules = %+v, want %+v", got, want)
+	}
+	// the reloaded rule is prepared for matching
+	if !reloaded.Rules()[0].Matches("virt-launcher", "agent disconnected") {
+		t.Errorf("the saved rule does not match its phrase")
+	}
+}
@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"logsviewer/pkg/backend/config"
+	"logsviewer/pkg/backend/noise"
+)
+
+// newNoiseServer serves the noise rule routes of a server keeping its rules
+// in path.
+func newNoiseServer(t *testing.T, path string) *httptest.Server {
+	t.Helper()
+	s := &server{
+		config:     config.Config{NoiseRulesFile: path},
+		noiseRules: noise.NewDefaultSet(),
+	}
+	s.loadNoiseRules()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/noise-rules", s.noiseRulesHandler)
+	mux.HandleFunc("/api/noise-rules/", s.noiseRuleHandler)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do sends body to the path of ts and decodes the JSON response into into,
+// when it is not nil.
+func do(t *testing.T, ts *httptest.Server, method string, path string, body string, into interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if into != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// listRules returns the rules served by ts.
+func listRules(t *testing.T, ts *httptest.Server) []noise.Rule {
+	t.Helper()
+	list := struct {
+		Rules []noise.Rule `json:"rules"`
+	}{}
+	if status := do(t, ts, http.MethodGet, "/api/noise-rules", "", &list); status != http.StatusOK {
+		t.Fatalf("GET /api/noise-rules = %d", status)
+	}
+	return list.Rules
+}
+
+func TestNoiseRulesAPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "noise-rules.yaml")
+	ts := newNoiseServer(t, path)
+
+	if got := listRules(t, ts); !reflect.DeepEqual(got, noise.DefaultRules()) {
+		t.Errorf("GET /api/noise-rules = %+v, want the default rules", got)
+	}
+
+	// POST takes JSON and YAML rules
+	added := noise.Rule{}
+	if status := do(t, ts, http.MethodPost, "/api/noise-rules", "component: virt-launcher\nregex: guest agent.*disconnected\n", &added); status != http.StatusOK {
+		t.Fatalf("POST /api/noise-rules = %d", status)
+	}
+	if added.ID == "" || added.Regex != "guest agent.*disconnected" {
+		t.Errorf("POST /api/noise-rules = %+v, want the rule with a generated ID", added)
+	}
+	if status := do(t, ts, http.MethodPost, "/api/noise-rules", `{"id":"reconcile","phrase":"reconciled"}`, nil); status != http.StatusOK {
+		t.Fatalf("POST /api/noise-rules = %d", status)
+	}
+
+	got := noise.Rule{}
+	if status := do(t, ts, http.MethodGet, "/api/noise-rules/"+added.ID, "", &got); status != http.StatusOK || !reflect.DeepEqual(got, added) {
+		t.Errorf("GET the added rule = %d %+v, want %+v", status, got, added)
+	}
+	if status := do(t, ts, http.MethodPut, "/api/noise-rules/"+added.ID, `{"component":"virt-launcher","versions":["v0.58"],"phrase":"disconnected"}`, nil); status != http.StatusOK {
+		t.Fatalf("PUT the added rule = %d", status)
+	}
+	if status := do(t, ts, http.MethodDelete, "/api/noise-rules/"+noise.DefaultRules()[0].ID, "", nil); status != http.StatusNoContent {
+		t.Errorf("DELETE the default rule = %d, want %d", status, http.StatusNoContent)
+	}
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/api/noise-rules/missing", "", http.StatusNotFound},
+		{http.MethodPut, "/api/noise-rules/missing", `{"phrase":"a"}`, http.StatusNotFound},
+		{http.MethodDelete, "/api/noise-rules/missing", "", http.StatusNotFound},
+		{http.MethodPost, "/api/noise-rules", `{"id":"reconcile","phrase":"again"}`, http.StatusConflict},
+		{http.MethodPost, "/api/noise-rules", `{"id":"broken","regex":"(unclosed"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/noise-rules", `{"id":"both","phrase":"a","regex":"b"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/noise-rules", `{"id":"typo","phrases":"a"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/noise-rules/reconcile", `{"regex":"[a-"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/noise-rules", "rules:\n- id: twice\n  phrase: a\n- id: twice\n  phrase: b\n", http.StatusConflict},
+		{http.MethodPatch, "/api/noise-rules", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/noise-rules/reconcile", "", http.StatusMethodNotAllowed},
+	} {
+		if status := do(t, ts, tc.method, tc.path, tc.body, nil); status != tc.want {
+			t.Errorf("%s %s %s = %d, want %d", tc.method, tc.path, tc.body, status, tc.want)
+		}
+	}
+
+	// the rejected changes were not saved, the others survive a restart
+	want := []noise.Rule{
+		{ID: added.ID, Component: "virt-launcher", Versions: []string{"v0.58"}, Phrase: "disconnected"},
+		{ID: "reconcile", Phrase: "reconciled"},
+	}
+	if added.ID > "reconcile" {
+		want[0], want[1] = want[1], want[0]
+	}
+	if got := listRules(t, ts); !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /api/noise-rules = %+v, want %+v", got, want)
+	}
+	if got := listRules(t, newNoiseServer(t, path)); !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /api/noise-rules after a restart = %+v, want %+v", got, want)
+	}
+
+	// PUT replaces every rule
+	file := "rules:\n- id: only\n  component: virt-handler\n  regex: \"^Processing\"\n"
+	if status := do(t, ts, http.MethodPut, "/api/noise-rules", file, nil); status != http.StatusOK {
+		t.Fatalf("PUT /api/noise-rules = %d", status)
+	}
+	want = []noise.Rule{{ID: "only", Component: "virt-handler", Regex: "^Processing"}}
+	if got := listRules(t, newNoiseServer(t, path)); !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /api/noise-rules after a restart = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/log"
+)
+
+// objectHandler serves the per-object routes under /api/objects/<uid>/.
+func (s *server) objectHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/objects/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	uid, resource := parts[0], parts[1]
+
+	switch resource {
+	case "events":
+		s.getObjectEvents(w, r, uid)
+	case "related":
+		s.getRelatedObjects(w, r, uid)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// getObjectEvents lists the Kubernetes events of an object. It takes the list
+// parameters, e.g. reason and type filters, and adds a per reason summary.
+func (s *server) getObjectEvents(w http.ResponseWriter, r *http.Request, uid string) {
+	log.Log.Println("Get Object Events Endpoint Hit: ", uid, r.URL.Query())
+	listOpts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbInst, _, err := s.openCaseStore(r)
+	if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := dbInst.GetObjectEvents(uid, listOpts)
+	if errors.Is(err, db.ErrInvalidListOption) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to get events", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, data)
+}
+
+// getRelatedObjects returns the objects related to an object through owner
+// references, launcher pods, migrations, node placement and volumes, up to
+// ?depth= relations away, 1 by default.
+func (s *server) getRelatedObjects(w http.ResponseWriter, r *http.Request, uid string) {
+	log.Log.Println("Get Related Objects Endpoint Hit: ", uid, r.URL.Query())
+	depth := 1
+	if value := r.URL.Query().Get("depth"); value != "" {
+		var err error
+		if depth, err = strconv.Atoi(value); err != nil || depth < 1 || depth > db.MaxRelationDepth {
+			http.Error(w, "invalid depth parameter: "+value+", it must be between 1 and "+strconv.Itoa(db.MaxRelationDepth), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dbInst, _, err := s.openCaseStore(r)
+	if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	related, err := dbInst.GetRelatedObjects(uid, depth)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to get related objects", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, related)
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/log"
+)
+
+// getResourceKinds lists the kinds read generically, with the columns
+// extracted from their objects.
+func (s *server) getResourceKinds(w http.ResponseWriter, r *http.Request) {
+	log.Log.Println("Get Resource Kinds Endpoint Hit: ", r.URL.Query())
+	writeJSON(w, map[string]interface{}{"data": s.resources.Kinds()})
+}
+
+// resourceHandler serves /api/resources/<kind>, the list of the objects of a
+// kind read generically, and /api/resources/<kind>/<uid>, a single object.
+func (s *server) resourceHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/resources/"), "/"), "/")
+	kind, ok := s.resources.Get(parts[0])
+	if !ok || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 1 {
+		s.listHandler(kind.Name, func(dbInst db.Store, opts db.ListOptions) (map[string]interface{}, error) {
+			return dbInst.GetResources(kind.Name, kind.ColumnNames(), opts)
+		})(w, r)
+		return
+	}
+
+	uid := parts[1]
+	log.Log.Println("Get Resource Endpoint Hit: ", kind.Name, " ", uid, r.URL.Query())
+	dbInst, _, err := s.openCaseStore(r)
+	if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resource, err := dbInst.GetResource(kind.Name, uid)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to get ", kind.Name, " - ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, resource)
+}
@@ -0,0 +1,223 @@
+// Package resources keeps the registry of the kinds of objects read from a
+// must-gather generically, without a table of their own: every object is
+// stored as is, together with the columns the registry extracts from it with
+// JSONPath, and listed through /api/resources/<name>.
+package resources
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+var ErrInvalidKind = errors.New("invalid resource kind")
+
+// identifier is what names of kinds and columns must look like, as they end
+// up in URLs and SQL statements.
+var identifier = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// reservedColumns are the columns every stored object has.
+var reservedColumns = map[string]bool{
+	"caseId":       true,
+	"kind":         true,
+	"uuid":         true,
+	"name":         true,
+	"namespace":    true,
+	"creationTime": true,
+	"fields":       true,
+	"content":      true,
+}
+
+// Column is a value extracted from every object of a kind, filterable and
+// sortable like the columns of the other lists.
+type Column struct {
+	Name string `json:"name"`
+	// JSONPath is a kubectl JSONPath template, e.g. {.status.phase}. Missing
+	// fields extract an empty value.
+	JSONPath string `json:"jsonPath"`
+}
+
+// Kind is a kind of object to read from a must-gather, e.g.
+//
+//	name: migrationpolicies
+//	group: migrations.kubevirt.io
+//	kind: MigrationPolicy
+//	patterns:
+//	- cluster-scoped-resources/migrations.kubevirt.io/migrationpolicies/*.yaml
+//	- cluster-scoped-resources/migrations.kubevirt.io/migrationpolicies.yaml
+//	columns:
+//	- name: allowPostCopy
+//	  jsonPath: "{.spec.allowPostCopy}"
+type Kind struct {
+	// Name is the kind in /api/resources/<name>, by convention its plural.
+	Name  string `json:"name"`
+	Group string `json:"group"`
+	// Version limits the kind to one version of its group, empty accepts
+	// every version.
+	Version string `json:"version,omitempty"`
+	Kind    string `json:"kind"`
+	// Patterns are globs relative to the root of the must-gather, matching
+	// files of one object, of several documents or of a list.
+	Patterns []string `json:"patterns"`
+	Columns  []Column `json:"columns,omitempty"`
+}
+
+func (k Kind) validate() error {
+	if !identifier.MatchString(k.Name) {
+		return fmt.Errorf("%w %q: the name must be a plain identifier", ErrInvalidKind, k.Name)
+	}
+	if k.Kind == "" || len(k.Patterns) == 0 {
+		return fmt.Errorf("%w %q: kind and patterns are required", ErrInvalidKind, k.Name)
+	}
+	seen := map[string]bool{}
+	for _, column := range k.Columns {
+		if !identifier.MatchString(column.Name) || reservedColumns[column.Name] || seen[column.Name] {
+			return fmt.Errorf("%w %q: column %q must be a plain identifier, unique and not one of the common columns", ErrInvalidKind, k.Name, column.Name)
+		}
+		seen[column.Name] = true
+		if err := jsonpath.New(column.Name).Parse(column.JSONPath); err != nil {
+			return fmt.Errorf("%w %q: column %q: %v", ErrInvalidKind, k.Name, column.Name, err)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether obj is of the kind.
+func (k Kind) Matches(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == k.Group && gvk.Kind == k.Kind && (k.Version == "" || gvk.Version == k.Version)
+}
+
+// ColumnNames returns the names of the extracted columns, in order.
+func (k Kind) ColumnNames() []string {
+	names := make([]string, 0, len(k.Columns))
+	for _, column := range k.Columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+// Extract returns the columns of obj, as rendered by their JSONPath.
+func (k Kind) Extract(obj *unstructured.Unstructured) (map[string]string, error) {
+	values := map[string]string{}
+	for _, column := range k.Columns {
+		// the templates were parsed by validate, but a parsed JSONPath
+		// can't be shared between imports
+		jp := jsonpath.New(column.Name).AllowMissingKeys(true)
+		if err := jp.Parse(column.JSONPath); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := jp.Execute(&buf, obj.Object); err != nil {
+			return nil, fmt.Errorf("column %s: %v", column.Name, err)
+		}
+		values[column.Name] = buf.String()
+	}
+	return values, nil
+}
+
+// Registry is the set of kinds read generically, by name.
+type Registry struct {
+	kinds map[string]Kind
+}
+
+// NewRegistry returns the built-in kinds together with kinds, which replace
+// built-in kinds of the same name.
+func NewRegistry(kinds []Kind) (*Registry, error) {
+	r := &Registry{kinds: map[string]Kind{}}
+	for _, kind := range DefaultKinds() {
+		r.kinds[kind.Name] = kind
+	}
+	seen := map[string]bool{}
+	for _, kind := range kinds {
+		if err := kind.validate(); err != nil {
+			return nil, err
+		}
+		if seen[kind.Name] {
+			return nil, fmt.Errorf("%w %q: defined twice", ErrInvalidKind, kind.Name)
+		}
+		seen[kind.Name] = true
+		r.kinds[kind.Name] = kind
+	}
+	return r, nil
+}
+
+// Get returns the kind of a name.
+func (r *Registry) Get(name string) (Kind, bool) {
+	kind, ok := r.kinds[name]
+	return kind, ok
+}
+
+// Kinds returns every kind, sorted by name.
+func (r *Registry) Kinds() []Kind {
+	kinds := make([]Kind, 0, len(r.kinds))
+	for _, kind := range r.kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].Name < kinds[j].Name })
+	return kinds
+}
+
+// DefaultKinds are the KubeVirt related kinds of a must-gather that have no
+// table of their own.
+func DefaultKinds() []Kind {
+	return []Kind{
+		{
+			Name:  "virtualmachinesnapshots",
+			Group: "snapshot.kubevirt.io",
+			Kind:  "VirtualMachineSnapshot",
+			Patterns: []string{
+				"namespaces/*/snapshot.kubevirt.io/virtualmachinesnapshots/*.yaml",
+				"namespaces/*/snapshot.kubevirt.io/virtualmachinesnapshots.yaml",
+			},
+			Columns: []Column{
+				{Name: "vmName", JSONPath: "{.spec.source.name}"},
+				{Name: "phase", JSONPath: "{.status.phase}"},
+				{Name: "readyToUse", JSONPath: "{.status.readyToUse}"},
+			},
+		},
+		{
+			Name:  "virtualmachinerestores",
+			Group: "snapshot.kubevirt.io",
+			Kind:  "VirtualMachineRestore",
+			Patterns: []string{
+				"namespaces/*/snapshot.kubevirt.io/virtualmachinerestores/*.yaml",
+				"namespaces/*/snapshot.kubevirt.io/virtualmachinerestores.yaml",
+			},
+			Columns: []Column{
+				{Name: "vmName", JSONPath: "{.spec.target.name}"},
+				{Name: "snapshotName", JSONPath: "{.spec.virtualMachineSnapshotName}"},
+				{Name: "complete", JSONPath: "{.status.complete}"},
+			},
+		},
+		{
+			Name:  "migrationpolicies",
+			Group: "migrations.kubevirt.io",
+			Kind:  "MigrationPolicy",
+			Patterns: []string{
+				"cluster-scoped-resources/migrations.kubevirt.io/migrationpolicies/*.yaml",
+				"cluster-scoped-resources/migrations.kubevirt.io/migrationpolicies.yaml",
+			},
+			Columns: []Column{
+				{Name: "allowAutoConverge", JSONPath: "{.spec.allowAutoConverge}"},
+				{Name: "allowPostCopy", JSONPath: "{.spec.allowPostCopy}"},
+				{Name: "bandwidthPerMigration", JSONPath: "{.spec.bandwidthPerMigration}"},
+				{Name: "completionTimeoutPerGiB", JSONPath: "{.spec.completionTimeoutPerGiB}"},
+			},
+		},
+		{
+			Name:  "networkattachmentdefinitions",
+			Group: "k8s.cni.cncf.io",
+			Kind:  "NetworkAttachmentDefinition",
+			Patterns: []string{
+				"namespaces/*/k8s.cni.cncf.io/network-attachment-definitions/*.yaml",
+				"namespaces/*/k8s.cni.cncf.io/network-attachment-definitions.yaml",
+			},
+		},
+	}
+}
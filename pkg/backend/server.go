@@ -1,6 +1,7 @@
 package backend
 
 import (
+    "context"
     "fmt"
     "net/http"
     "io"
@@ -11,18 +12,25 @@ import (
     "encoding/json"
     "io/ioutil"
     "strconv"
-    //"strings"
+    "strings"
+    "path/filepath"
+    "net/url"
+    "sync"
+    "time"
 
     "logsviewer/pkg/backend/log"
+    "logsviewer/pkg/backend/archive"
+    "logsviewer/pkg/backend/config"
     "logsviewer/pkg/backend/db"
+    "logsviewer/pkg/backend/jobs"
+    "logsviewer/pkg/backend/logstore"
+    "logsviewer/pkg/backend/logquery"
+    "logsviewer/pkg/backend/noise"
+    "logsviewer/pkg/backend/resources"
 
     "github.com/gorilla/websocket"
 )
 
-const (
-    ENRICHMENT_DATA_FILE = "/space/result.json"
-)
-
 // We'll need to define an Upgrader
 // this will require a Read and Write buffer size
 var upgrader = websocket.Upgrader{
@@ -36,31 +44,22 @@ var upgrader = websocket.Upgrader{
     CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-// define a reader which will listen for
-// new messages being sent to our WebSocket
-// endpoint
-func reader(conn *websocket.Conn) {
+// drainMessages reads, and discards, client messages until the connection is
+// closed; reading is required to notice the close.
+func drainMessages(conn *websocket.Conn, done chan struct{}) {
+    defer close(done)
     for {
-    // read in a message
-        messageType, p, err := conn.ReadMessage()
-        if err != nil {
-            log.Log.Println(err)
-            return
-        }
-    // print out that message for clarity
-        fmt.Println(string(p))
-
-        if err := conn.WriteMessage(messageType, p); err != nil {
+        if _, _, err := conn.ReadMessage(); err != nil {
             log.Log.Println(err)
             return
         }
-
     }
 }
 
 
-// define our WebSocket endpoint
-func serveWs(w http.ResponseWriter, r *http.Request) {
+// define our WebSocket endpoint, it streams import job events to the
+// browser; ?job=<id> limits the stream to a single job
+func (s *server) serveWs(w http.ResponseWriter, r *http.Request) {
     fmt.Println(r.Host)
 
   // upgrade this connection to a WebSocket
@@ -68,45 +67,122 @@ func serveWs(w http.ResponseWriter, r *http.Request) {
     ws, err := upgrader.Upgrade(w, r, nil)
     if err != nil {
         log.Log.Println(err)
-  }
-  // listen indefinitely for new messages coming
-  // through on our WebSocket connection
-    reader(ws)
-}
-
-func getPods(w http.ResponseWriter, r *http.Request) {
-    log.Log.Println("Get Pods Endpoint Hit: ", r.URL.Query())
-	params := map[string]interface{}{}
-	for k, v := range r.URL.Query() {
-            params[k] = v[0]
+        return
+    }
+    defer ws.Close()
+
+    jobID := r.URL.Query().Get("job")
+    events, unsubscribe := s.importJobs.Subscribe()
+    defer unsubscribe()
+
+    // a late subscriber first gets the current state of its job
+    if jobID != "" {
+        if job, ok := s.importJobs.Get(jobID); ok {
+            if err := ws.WriteJSON(jobs.Event{JobID: job.ID, State: job.State, Job: job}); err != nil {
+                log.Log.Println(err)
+                return
+            }
+        }
     }
 
-	currentPage := 1
+    done := make(chan struct{})
+    go drainMessages(ws, done)
+    for {
+        select {
+        case <-done:
+            return
+        case event, ok := <-events:
+            if !ok {
+                return
+            }
+            if jobID != "" && event.JobID != jobID {
+                continue
+            }
+            if err := ws.WriteJSON(event); err != nil {
+                log.Log.Println(err)
+                return
+            }
+        }
+    }
+}
 
-    page, err   := strconv.Atoi(fmt.Sprint(params["page"]))
-    if err == nil {
-        if page >= 1 {
-            currentPage = page
+// parseListOptions reads the paging, sorting, search and filter parameters
+// shared by the list endpoints:
+//   page, per_page         - paging; per_page is unlimited when omitted
+//   sort_by, sort_order    - a column name and "asc" (default) or "desc"
+//   search                 - substring match on the object name
+//   from, to               - RFC3339 bounds on the creation time
+//   case                   - the case to list, see openCaseStore
+// Any other parameter is an exact-match filter on the column of that name.
+func parseListOptions(values url.Values) (db.ListOptions, error) {
+    opts := db.DefaultListOptions()
+    opts.Filters = map[string]string{}
+
+    for key := range values {
+        value := values.Get(key)
+        switch key {
+        case "page":
+            if page, err := strconv.Atoi(value); err == nil && page >= 1 {
+                opts.Page = page
+            }
+        case "per_page":
+            if perPage, err := strconv.Atoi(value); err == nil && perPage >= 1 {
+                opts.PerPage = perPage
+            }
+        case "sort_by":
+            opts.SortBy = value
+        case "sort_order":
+            switch strings.ToLower(value) {
+            case "", "asc":
+            case "desc":
+                opts.SortDesc = true
+            default:
+                return opts, fmt.Errorf("invalid sort_order %q", value)
+            }
+        case "search":
+            opts.Search = value
+        case "case":
+        case "from", "to":
+            t, err := time.Parse(time.RFC3339, value)
+            if err != nil {
+                return opts, fmt.Errorf("invalid %s: %v", key, err)
+            }
+            if key == "from" {
+                opts.CreatedAfter = t
+            } else {
+                opts.CreatedBefore = t
+            }
+        default:
+            opts.Filters[key] = value
         }
     }
+    return opts, nil
+}
 
-    pageSize := -1
-    perPage, err := strconv.Atoi(fmt.Sprint(params["per_page"]))
-    if err == nil {
-        if perPage >= 1 {
-            pageSize = perPage
-        }  
+func (s *server) getPods(w http.ResponseWriter, r *http.Request) {
+    log.Log.Println("Get Pods Endpoint Hit: ", r.URL.Query())
+    listOpts, err := parseListOptions(r.URL.Query())
+    if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
     }
 
-    dbInst, err := db.NewDatabaseInstance()
+    dbInst, _, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
     if err != nil {
-        log.Log.Println("failed to connect to database", err)
+        log.Log.Println("failed to resolve case", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    defer dbInst.Shutdown()
 
-	data, err := dbInst.GetPods(currentPage, pageSize)
+	data, err := dbInst.GetPods(listOpts)
+    if errors.Is(err, db.ErrInvalidListOption) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
         log.Log.Println("failed to get pods!", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -121,39 +197,30 @@ func getPods(w http.ResponseWriter, r *http.Request) {
     }    
 }
 
-func getVmis(w http.ResponseWriter, r *http.Request) {
+func (s *server) getVmis(w http.ResponseWriter, r *http.Request) {
     log.Log.Println("Get Vmis Endpoint Hit: ", r.URL.Query())
-	params := map[string]interface{}{}
-	for k, v := range r.URL.Query() {
-            params[k] = v[0]
-    }
-
-	currentPage := 1
-
-    page, err   := strconv.Atoi(fmt.Sprint(params["page"]))
-    if err == nil {
-        if page >= 1 {
-            currentPage = page
-        }
+    listOpts, err := parseListOptions(r.URL.Query())
+    if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
     }
 
-    pageSize := -1
-    perPage, err := strconv.Atoi(fmt.Sprint(params["per_page"]))
-    if err == nil {
-        if perPage >= 1 {
-            pageSize = perPage
-        }  
+    dbInst, _, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
     }
-
-    dbInst, err := db.NewDatabaseInstance()
     if err != nil {
-        log.Log.Println("failed to connect to database", err)
+        log.Log.Println("failed to resolve case", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    defer dbInst.Shutdown()
 
-	data, err := dbInst.GetVmis(currentPage, pageSize)
+	data, err := dbInst.GetVmis(listOpts)
+    if errors.Is(err, db.ErrInvalidListOption) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
         log.Log.Println("failed to get pods!", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -168,52 +235,70 @@ func getVmis(w http.ResponseWriter, r *http.Request) {
     }    
 }
 
-func getVmiMigrations(w http.ResponseWriter, r *http.Request) {
-    log.Log.Println("Get Vmi migrations Endpoint Hit: ", r.URL.Query())
-	params := map[string]interface{}{}
-	for k, v := range r.URL.Query() {
-            params[k] = v[0]
+func (s *server) getVms(w http.ResponseWriter, r *http.Request) {
+    log.Log.Println("Get Vms Endpoint Hit: ", r.URL.Query())
+    listOpts, err := parseListOptions(r.URL.Query())
+    if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
     }
-    vmiDetails := db.VMIMigrationQueryDetails{}
-    if vmiName, exist := params["name"]; exist {
-        log.Log.Println("vmiName: ", vmiName)
-        json.Unmarshal([]byte(fmt.Sprint(vmiName)), &vmiDetails)
-        log.Log.Println("vmiDetails: ", vmiDetails)
+
+    dbInst, _, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
     }
-    if vmiNamespace, exist := params["namespace"]; exist {
-        log.Log.Println("Namespace: ", vmiNamespace)
-        json.Unmarshal([]byte(fmt.Sprint(vmiNamespace)), &vmiDetails)
-        log.Log.Println("vmiDetails: ", vmiDetails)
+    if err != nil {
+        log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
     }
 
-	currentPage := 1
-
-    page, err   := strconv.Atoi(fmt.Sprint(params["page"]))
-    if err == nil {
-        if page >= 1 {
-            currentPage = page
-        }
+	data, err := dbInst.GetVms(listOpts)
+    if errors.Is(err, db.ErrInvalidListOption) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
     }
+    if err != nil {
+        log.Log.Println("failed to get vms!", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+	}
+    w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(200)  
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    if err1 := enc.Encode(data); err1 != nil {
+        fmt.Println(err1.Error())
+    }    
+}
 
-    pageSize := -1
-    perPage, err := strconv.Atoi(fmt.Sprint(params["per_page"]))
-    if err == nil {
-        if perPage >= 1 {
-            pageSize = perPage
-        }  
+func (s *server) getNodes(w http.ResponseWriter, r *http.Request) {
+    log.Log.Println("Get Nodes Endpoint Hit: ", r.URL.Query())
+    listOpts, err := parseListOptions(r.URL.Query())
+    if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
     }
 
-    dbInst, err := db.NewDatabaseInstance()
+    dbInst, _, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
     if err != nil {
-        log.Log.Println("failed to connect to database", err)
+        log.Log.Println("failed to resolve case", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    defer dbInst.Shutdown()
 
-	data, err := dbInst.GetVmiMigrations(currentPage, pageSize, &vmiDetails)
+	data, err := dbInst.GetNodes(listOpts)
+    if errors.Is(err, db.ErrInvalidListOption) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
-        log.Log.Println("failed to get pods!", err)
+        log.Log.Println("failed to get nodes!", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
 	}
@@ -226,33 +311,122 @@ func getVmiMigrations(w http.ResponseWriter, r *http.Request) {
     }    
 }
 
-func formatVMIMigrationDSLQuery(res db.QueryResults) string {
+// getNode returns /nodes/<name> with the pods, VMIs and migrations that ran
+// on the node.
+func (s *server) getNode(w http.ResponseWriter, r *http.Request) {
+    log.Log.Println("Get Node Endpoint Hit: ", r.URL.Path, r.URL.Query())
+    name := strings.TrimPrefix(r.URL.Path, "/nodes/")
 
-    queryTemplate := `_g=(filters:!(),refreshInterval:(pause:!t,value:0),time:(from:'%s',to:'%s'))&_a=(columns:!(msg,podName,component,uid,subcomponent,reason,enrichment_data.pod.uid,enrichment_data.host.name,level),filters:!(('$state':(store:appState),meta:(alias:!n,disabled:!f,key:msg,negate:!f,type:exists,value:exists),query:(exists:(field:msg))),('$state':(store:appState),meta:(alias:!n,disabled:!f,key:msg,negate:!t,params:(query:'certificate with common name !'kubevirt.io:system:client:virt-handler!' retrieved.'),type:phrase),query:(match_phrase:(msg:'certificate with common name !'kubevirt.io:system:client:virt-handler!' retrieved.')))),interval:auto,query:(language:kuery,query:'containerName: "virt-controller" or containerName: "virt-api" or podName: "%s" or podName: "%s" or podName: "%s" or podName: "%s" or "%s" or "%s" or "%s" or "%s"'),sort:!(!('@timestamp',asc)))`
-
-
-    timeStamp := fmt.Sprintf("%sZ", res.StartTimestamp.UTC().Format("2006-01-02T15:04:05.000"))
-    endTimeStamp := fmt.Sprintf("%sZ", res.EndTimestamp.UTC().Format("2006-01-02T15:04:05.000"))
-    
-    migrationLogsQuery := fmt.Sprintf(queryTemplate, timeStamp, endTimeStamp, res.SourcePod, res.SourceHandler, res.TargetPod, res.TargetHandler, res.SourcePodUUID, res.VMIUUID, res.TargetPodUUID, res.MigrationUUID)
+    dbInst, _, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
 
-    return migrationLogsQuery
+	data, err := dbInst.GetNode(name)
+    if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Log.Println("failed to get node!", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+	}
+    w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(200)  
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    if err1 := enc.Encode(data); err1 != nil {
+        fmt.Println(err1.Error())
+    }    
 }
 
-func formatSingleVMIDSLQuery(res db.QueryResults) string {
-
-    queryTemplate := `_g=(filters:!(),refreshInterval:(pause:!t,value:0),time:(from:'%s',to:now))&_a=(columns:!(msg,podName,component,uid,subcomponent,reason,enrichment_data.pod.uid,enrichment_data.host.name,level),filters:!(('$state':(store:appState),meta:(alias:!n,disabled:!f,key:msg,negate:!f,type:exists,value:exists),query:(exists:(field:msg))),('$state':(store:appState),meta:(alias:!n,disabled:!f,key:msg,negate:!t,params:(query:'certificate with common name !'kubevirt.io:system:client:virt-handler!' retrieved.'),type:phrase),query:(match_phrase:(msg:'certificate with common name !'kubevirt.io:system:client:virt-handler!' retrieved.')))),interval:auto,query:(language:kuery,query:'containerName: "virt-controller" or containerName: "virt-api" or podName: "%s" or podName: "%s" or "%s" or "%s"'),sort:!(!('@timestamp',asc)))`
+func (s *server) getVmiMigrations(w http.ResponseWriter, r *http.Request) {
+    log.Log.Println("Get Vmi migrations Endpoint Hit: ", r.URL.Query())
+    query := r.URL.Query()
+    vmiDetails := db.VMIMigrationQueryDetails{}
+    // the VMI details arrive JSON encoded, e.g. name={"name":"vmi"}; plain
+    // values are left in the query as regular filters
+    for _, key := range []string{"name", "namespace"} {
+        if value := query.Get(key); strings.HasPrefix(value, "{") {
+            if err := json.Unmarshal([]byte(value), &vmiDetails); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            query.Del(key)
+        }
+    }
+    log.Log.Println("vmiDetails: ", vmiDetails)
 
+    listOpts, err := parseListOptions(query)
+    if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
 
-    timeStamp := fmt.Sprintf("%sZ", res.StartTimestamp.UTC().Format("2006-01-02T15:04:05.000"))
-    
-    vmiLogsQuery := fmt.Sprintf(queryTemplate, timeStamp, res.SourcePod, res.SourceHandler, res.SourcePodUUID, res.VMIUUID)
+    dbInst, _, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
 
-    return vmiLogsQuery
+	data, err := dbInst.GetVmiMigrations(listOpts, &vmiDetails)
+    if errors.Is(err, db.ErrInvalidListOption) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        log.Log.Println("failed to get pods!", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+	}
+    w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(200)  
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    if err1 := enc.Encode(data); err1 != nil {
+        fmt.Println(err1.Error())
+    }    
 }
 
+// writeLogQuery renders q in the format asked for with ?format=, Kibana URL
+// state by default, see logquery.Formats.
+func writeLogQuery(w http.ResponseWriter, r *http.Request, q logquery.Query) {
+    format := r.URL.Query().Get("format")
+    if format == "" {
+        format = logquery.DefaultFormat
+    }
+    rendered, err := logquery.Render(q, format)
+    if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    resp := map[string]string{"format": format, "dslQuery": rendered, "from": logquery.FormatTime(q.From)}
+    if !q.To.IsZero() {
+        resp["to"] = logquery.FormatTime(q.To)
+    }
+    log.Log.Println("log query encoded: ", resp)
+    w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(200)  
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    if err1 := enc.Encode(resp); err1 != nil {
+        fmt.Println(err1.Error())
+    }    
+}
 
-func getVMIQueryParams(w http.ResponseWriter, r *http.Request) {
+func (s *server) getVMIQueryParams(w http.ResponseWriter, r *http.Request) {
     log.Log.Println("Get VMI Query Endpoint Hit: ", r.URL.Query())
 	params := map[string]interface{}{}
 	for k, v := range r.URL.Query() {
@@ -265,20 +439,22 @@ func getVMIQueryParams(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "can't find uuid in query params", http.StatusInternalServerError)
         return
     }
-    nodeName, exist := params["nodeName"]
-    if !exist {
-        log.Log.Println("can't find nodeName in query params")
-		http.Error(w, "can't find nodeName in query params", http.StatusInternalServerError)
-        return
+    // without a nodeName the query covers every node the VMI ran on
+    nodeName := params["nodeName"]
+    if nodeName == nil {
+        nodeName = ""
     }
 
-    dbInst, err := db.NewDatabaseInstance()
+    dbInst, caseID, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
     if err != nil {
-        log.Log.Println("failed to connect to database", err)
+        log.Log.Println("failed to resolve case", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    defer dbInst.Shutdown()
     vmiUUIDStr := fmt.Sprintf("%s", vmiUUID)
     nodeNameStr := fmt.Sprintf("%s", nodeName)
 
@@ -288,21 +464,10 @@ func getVMIQueryParams(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
 	}
-    dslQuery := formatSingleVMIDSLQuery(data)
-    resp := map[string]string{"dslQuery": dslQuery}
-    log.Log.Println("getVMIQueryParams encoded: ", resp)
-    w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(200)  
-    enc := json.NewEncoder(w)
-    enc.SetIndent("", "  ")
-    if err1 := enc.Encode(resp); err1 != nil {
-        log.Log.Println("getVMIQueryParams error: ", err1)
-        fmt.Println(err1.Error())
-    }    
-    log.Log.Println("getVMIQueryParams encoded: ", resp)
+    writeLogQuery(w, r, logquery.ForVMI(s.config.CaseDataViewID(caseID), data, s.caseNoiseRules(dbInst)))
 }
 
-func getMigrationQueryParams(w http.ResponseWriter, r *http.Request) {
+func (s *server) getMigrationQueryParams(w http.ResponseWriter, r *http.Request) {
     log.Log.Println("Get Migration Query Endpoint Hit: ", r.URL.Query())
 	params := map[string]interface{}{}
 	for k, v := range r.URL.Query() {
@@ -316,13 +481,16 @@ func getMigrationQueryParams(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    dbInst, err := db.NewDatabaseInstance()
+    dbInst, caseID, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
     if err != nil {
-        log.Log.Println("failed to connect to database", err)
+        log.Log.Println("failed to resolve case", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    defer dbInst.Shutdown()
 
 	data, err := dbInst.GetMigrationQueryParams(fmt.Sprintf("%s", migrationUUID))
     if err != nil {
@@ -330,25 +498,136 @@ func getMigrationQueryParams(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
         return
 	}
-    dslQuery := formatVMIMigrationDSLQuery(data)
-    resp := map[string]string{"dslQuery": dslQuery}
-    log.Log.Println("getMigrationQueryParams encoded: ", resp)
+    writeLogQuery(w, r, logquery.ForMigration(s.config.CaseDataViewID(caseID), data, s.caseNoiseRules(dbInst)))
+}
+
+// newLogStore returns the log store of a case selected by the configuration:
+// the extracted log files, or Elasticsearch.
+func (s *server) newLogStore(caseID string) logstore.LogStore {
+    if s.config.LogStore == config.LogStoreLocal {
+        return logstore.NewLocalStore(s.config.CaseDir(caseID))
+    }
+    return logstore.NewElasticsearchStore(s.config.Elasticsearch.URL, s.config.CaseIndexPattern(caseID))
+}
+
+// multiValueParam collects a parameter given either repeatedly or comma separated.
+func multiValueParam(values url.Values, key string) []string {
+    var result []string
+    for _, value := range values[key] {
+        for _, part := range strings.Split(value, ",") {
+            if part = strings.TrimSpace(part); part != "" {
+                result = append(result, part)
+            }
+        }
+    }
+    return result
+}
+
+// parseLogQuery reads the /api/logs parameters: podName, uid, component and
+// level (repeated or comma separated), from/to (RFC3339), cursor and limit.
+func parseLogQuery(values url.Values) (logstore.Query, error) {
+    query := logstore.Query{
+        PodNames:   multiValueParam(values, "podName"),
+        UIDs:       multiValueParam(values, "uid"),
+        Components: multiValueParam(values, "component"),
+        Levels:     multiValueParam(values, "level"),
+        Cursor:     values.Get("cursor"),
+    }
+    for key, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+        if value := values.Get(key); value != "" {
+            t, err := time.Parse(time.RFC3339, value)
+            if err != nil {
+                return query, fmt.Errorf("invalid %s: %v", key, err)
+            }
+            *target = t
+        }
+    }
+    if value := values.Get("limit"); value != "" {
+        limit, err := strconv.Atoi(value)
+        if err != nil || limit < 1 {
+            return query, fmt.Errorf("invalid limit %q", value)
+        }
+        query.Limit = limit
+    }
+    return query, nil
+}
+
+func (s *server) getLogs(w http.ResponseWriter, r *http.Request) {
+    log.Log.Println("Get Logs Endpoint Hit: ", r.URL.Query())
+    query, err := parseLogQuery(r.URL.Query())
+    if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    dbInst, caseID, err := s.openCaseStore(r)
+    if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    query.Exclude = s.caseNoiseRules(dbInst)
+
+    page, err := s.newLogStore(caseID).Search(query)
+    if err != nil {
+        log.Log.Println("failed to search logs", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
     w.Header().Set("Content-Type", "application/json;charset=utf-8")
 	w.WriteHeader(200)  
     enc := json.NewEncoder(w)
     enc.SetIndent("", "  ")
-    if err1 := enc.Encode(resp); err1 != nil {
+    if err1 := enc.Encode(page); err1 != nil {
         fmt.Println(err1.Error())
     }    
 }
 
-func uploadLogs(w http.ResponseWriter, r *http.Request) {
+func (s *server) uploadLogs(w http.ResponseWriter, r *http.Request) {
     fmt.Println("File Upload Endpoint Hit")
     log.Log.Println("File Upload Endpoint Hit")
 
     // Parse our multipart form, 10 << 20 specifies a maximum
     // upload of 10 MB files.
     r.ParseMultipartForm(10 << 20)
+
+    // an already extracted must-gather can be imported from a local directory
+    if dirPath := r.FormValue("path"); dirPath != "" {
+        dirPath, err := s.config.ImportPath(dirPath)
+        if errors.Is(err, config.ErrImportPathDenied) {
+            http.Error(w, err.Error(), http.StatusForbidden)
+            return
+        }
+        if err != nil {
+            log.Log.Println("failed to resolve the import path", err)
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        importCase, err := s.newCase(r.FormValue("name"), dirPath)
+        if err != nil {
+            log.Log.Println("failed to create case", err)
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        job := s.importJobs.Create(dirPath, jobs.ImportPhases)
+        s.importJobs.FinishPhase(job.ID, jobs.PhaseUpload, 0, nil)
+        go s.runImport(job.ID, importCase.ID, dirPath, false)
+
+        w.Header().Set("Content-Type", "application/json;charset=utf-8")
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+           "success":     true,
+           "description": "Importing Directory",
+           "jobId":       job.ID,
+           "caseId":      importCase.ID,
+        })
+        return
+    }
+
     // FormFile returns the first file for the given key `myFile`
     // it also returns the FileHeader so we can get the Filename,
     // the Header and the size of the file
@@ -366,17 +645,31 @@ func uploadLogs(w http.ResponseWriter, r *http.Request) {
     fmt.Printf("File Size: %+v\n", handler.Size)
     fmt.Printf("MIME Header: %+v\n", handler.Header)
 
+    // the format is detected from the content, the browser supplied MIME
+    // type is unreliable for .tar.zst and friends
+    head := make([]byte, 512)
+    n, _ := io.ReadFull(file, head)
+    if archive.DetectFormat(head[:n]) == archive.FormatUnknown {
+        http.Error(w, fmt.Sprintf("%s is not a supported archive", handler.Filename), http.StatusBadRequest)
+        return
+    }
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
 
-    // TODO: make this path configurable
-    err = os.MkdirAll("/space", os.ModePerm)
+    // every upload is imported into a case of its own
+    importCase, err := s.newCase(r.FormValue("name"), handler.Filename)
     if err != nil {
+        log.Log.Println("failed to create case", err)
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
 
-    destinationFilePath := fmt.Sprintf("/space/%s", handler.Filename)
+    destinationFilePath := filepath.Join(s.config.CaseDir(importCase.ID), filepath.Base(handler.Filename))
     dst, err := os.Create(destinationFilePath)
     if err != nil {
+        s.discardUpload(importCase.ID)
         http.Error(w, err.Error(), http.StatusInternalServerError)
 	return
     } 
@@ -385,112 +678,172 @@ func uploadLogs(w http.ResponseWriter, r *http.Request) {
 
     // Copy the uploaded file to the filesystem
     // at the specified destination
-    _, err = io.Copy(dst, file)
+    job := s.importJobs.Create(handler.Filename, jobs.ImportPhases)
+    s.importJobs.StartPhase(job.ID, jobs.PhaseUpload)
+    written, err := io.Copy(dst, file)
+    if closeErr := dst.Close(); err == nil {
+        err = closeErr
+    }
+    s.importJobs.FinishPhase(job.ID, jobs.PhaseUpload, int(written), err)
     if err != nil {
+        s.importJobs.Finish(job.ID)
+        s.discardUpload(importCase.ID)
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
 
     fmt.Println("Successfully Uploaded File: ", handler.Filename)
     log.Log.Println("Successfully Uploaded File: ", handler.Filename)
+
+    // the import continues in the background, progress is reported on /ws
+    // and /api/imports/<jobId>
+    go s.runImport(job.ID, importCase.ID, destinationFilePath, true)
+
     w.Header().Set("Content-Type", "application/json;charset=utf-8")
+    w.WriteHeader(http.StatusAccepted)
     json.NewEncoder(w).Encode(map[string]interface{}{
        "success":     true,
        "description": "Successfully Uploaded File",
+       "jobId":       job.ID,
+       "caseId":      importCase.ID,
     })
-
-    mime := handler.Header.Get("Content-Type")
-    if mime == "application/gzip" {
-        if err := handleTarGz(destinationFilePath, "/space"); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        logsHandler := NewLogsHandler()
-        defer close(logsHandler.stopCh)
-        if err := logsHandler.processPodYAMLs(); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        if err := logsHandler.processVirtualMachineInstanceMigrationsYAMLs(); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        if err := logsHandler.processVirtualMachineInstanceYAMLs(); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-    }
 }
 
-func verifyFiles() {
-    if _, err := os.Stat(ENRICHMENT_DATA_FILE); errors.Is(err, os.ErrNotExist) {
-        m := make(map[string]string)
-        content, _ := json.Marshal(m)
-    	ioutil.WriteFile(ENRICHMENT_DATA_FILE, content, 0644)
+// discardUpload removes the case created for an upload that could not be
+// saved, so that it does not show up as an empty case.
+func (s *server) discardUpload(caseID string) {
+    if err := s.removeCase(caseID); err != nil {
+        log.Log.Println("failed to remove the case of a failed upload ", caseID, " - ", err)
     }
 }
 
-func setKibanaDefaultDataView() {
-    httpposturl := "http://localhost:5601/api/data_views/default"
-    log.Log.Println("HTTP JSON POST URL:", httpposturl)
+// kibanaRequest sends a request to the Kibana API and fails on any non 2xx
+// status.
+func (s *server) kibanaRequest(method string, path string, jsonData []byte) error {
+    httpposturl := s.config.Kibana.URL + path
+    log.Log.Println("HTTP JSON ", method, " URL:", httpposturl)
 
-    var jsonData = []byte(`{"data_view_id": "cnvlogs-default"}`)
-    request, err := http.NewRequest("POST", httpposturl, bytes.NewBuffer(jsonData))
+    request, err := http.NewRequest(method, httpposturl, bytes.NewBuffer(jsonData))
+    if err != nil {
+        return err
+    }
     request.Header.Set("Content-Type", "application/json; charset=UTF-8")
     request.Header.Add("kbn-xsrf", "true")
 
-    client := &http.Client{}
+    client := &http.Client{Timeout: 30 * time.Second}
     response, err := client.Do(request)
     if err != nil {
-        log.Log.Println("ERROR: ", err)
+        return err
     }
     defer response.Body.Close()
 
     log.Log.Println("response Status:", response.Status)
-    log.Log.Println("response Headers:", response.Header)
     body, _ := ioutil.ReadAll(response.Body)
     log.Log.Println("response Body:", string(body))
+    if response.StatusCode >= 300 {
+        return fmt.Errorf("kibana %s %s failed with %s", method, path, response.Status)
+    }
+    return nil
 }
 
-func createKibanaDataView() {
-    httpposturl := "http://localhost:5601/api/data_views/data_view"
-    log.Log.Println("HTTP JSON POST URL:", httpposturl)
+func (s *server) setKibanaDefaultDataView() error {
+    jsonData, _ := json.Marshal(map[string]string{"data_view_id": s.config.Kibana.DefaultDataView})
+    return s.kibanaRequest("POST", "/api/data_views/default", jsonData)
+}
 
-    var jsonData = []byte(`{"data_view": {"title": "cnvlogs*", "timeFieldName":"@timestamp", "id":"cnvlogs-default"}}`)
-    request, err := http.NewRequest("POST", httpposturl, bytes.NewBuffer(jsonData))
-    request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-    request.Header.Add("kbn-xsrf", "true")
+// createKibanaDataView creates a data view over the indices matching title.
+func (s *server) createKibanaDataView(id string, title string) error {
+    jsonData, _ := json.Marshal(map[string]interface{}{
+        "data_view": map[string]string{
+            "title":         title,
+            "timeFieldName": "@timestamp",
+            "id":            id,
+        },
+    })
+    return s.kibanaRequest("POST", "/api/data_views/data_view", jsonData)
+}
 
-    client := &http.Client{}
-    response, err := client.Do(request)
-    if err != nil {
-        log.Log.Println("ERROR: ", err)
-    }
-    defer response.Body.Close()
+func (s *server) deleteKibanaDataView(id string) error {
+    return s.kibanaRequest("DELETE", "/api/data_views/data_view/"+url.PathEscape(id), nil)
+}
 
-    log.Log.Println("response Status:", response.Status)
-    log.Log.Println("response Headers:", response.Header)
-    body, _ := ioutil.ReadAll(response.Body)
-    log.Log.Println("response Body:", string(body))
+// server holds the configuration and the state shared by the handlers.
+type server struct {
+  config     config.Config
+  // store is shared by all requests and imports, see openCaseStore
+  store      db.Store
+  importJobs *jobs.Manager
+  // imports run one at a time; deleting a case waits for them as well
+  importLock sync.Mutex
+  // noiseRules are the built-in ones until loadNoiseRules reads the rule file
+  noiseRules *noise.Set
+  // resources are the kinds read generically, see package resources
+  resources  *resources.Registry
 }
 
-func SetupRoutes(publicDir string) *http.ServeMux {
-  verifyFiles()
-  createKibanaDataView()
-  setKibanaDefaultDataView()
+// SetupRoutes opens the database, waiting for it to come up, migrates its
+// schema and returns the routes of the service.
+func SetupRoutes(cfg config.Config) (*http.ServeMux, error) {
+  registry, err := resources.NewRegistry(cfg.Resources)
+  if err != nil {
+      return nil, err
+  }
+  store, err := db.Open(context.Background(), cfg.Database)
+  if err != nil {
+      return nil, fmt.Errorf("failed to open the database: %v", err)
+  }
+  if err := store.InitTables(); err != nil {
+      store.Shutdown()
+      return nil, fmt.Errorf("failed to migrate the database schema: %v", err)
+  }
+  s := &server{
+      config:     cfg,
+      store:      store,
+      importJobs: jobs.NewManager(),
+      noiseRules: noise.NewDefaultSet(),
+      resources:  registry,
+  }
+  // the default data view spans the logs of all cases
+  if err := s.createKibanaDataView(s.config.Kibana.DefaultDataView, s.config.Elasticsearch.IndexPrefix + "*"); err != nil {
+      log.Log.Println("failed to create the default kibana data view: ", err)
+  }
+  if err := s.setKibanaDefaultDataView(); err != nil {
+      log.Log.Println("failed to set the default kibana data view: ", err)
+  }
+  s.loadNoiseRules()
   mux := http.NewServeMux()
-  web := http.FileServer(http.Dir(publicDir))
+  web := http.FileServer(http.Dir(s.config.PublicDir))
     
   mux.Handle("/", web)
   //TODO: move to an API sub
-  mux.HandleFunc("/uploadLogs", uploadLogs)
-  mux.HandleFunc("/pods", getPods)
-  mux.HandleFunc("/vmis", getVmis)
-  mux.HandleFunc("/vmims", getVmiMigrations)
-  mux.HandleFunc("/getVMIQueryParams", getVMIQueryParams)
-  mux.HandleFunc("/getMigrationQueryParams", getMigrationQueryParams)
+  mux.HandleFunc("/uploadLogs", s.uploadLogs)
+  mux.HandleFunc("/pods", s.getPods)
+  mux.HandleFunc("/vms", s.getVms)
+  mux.HandleFunc("/nodes", s.getNodes)
+  mux.HandleFunc("/nodes/", s.getNode)
+  mux.HandleFunc("/vmis", s.getVmis)
+  mux.HandleFunc("/vmims", s.getVmiMigrations)
+  mux.HandleFunc("/getVMIQueryParams", s.getVMIQueryParams)
+  mux.HandleFunc("/getMigrationQueryParams", s.getMigrationQueryParams)
+  mux.HandleFunc("/api/logs", s.getLogs)
+  mux.HandleFunc("/api/objects/", s.objectHandler)
+  mux.HandleFunc("/api/vmis/", s.vmiHandler)
+  mux.HandleFunc("/api/datavolumes", s.listHandler("datavolumes", db.Store.GetDataVolumes))
+  mux.HandleFunc("/api/pvcs", s.listHandler("pvcs", db.Store.GetPVCs))
+  mux.HandleFunc("/api/pvs", s.listHandler("pvs", db.Store.GetPVs))
+  mux.HandleFunc("/api/storageclasses", s.listHandler("storageclasses", db.Store.GetStorageClasses))
+  mux.HandleFunc("/api/cluster", s.getClusterInfo)
+  mux.HandleFunc("/api/resources", s.getResourceKinds)
+  mux.HandleFunc("/api/resources/", s.resourceHandler)
+  mux.HandleFunc("/api/cases", s.getCases)
+  mux.HandleFunc("/api/cases/", s.caseHandler)
+  mux.HandleFunc("/api/noise-rules", s.noiseRulesHandler)
+  mux.HandleFunc("/api/noise-rules/", s.noiseRuleHandler)
+  mux.HandleFunc("/api/imports", s.getImports)
+  mux.HandleFunc("/api/imports/", s.getImport)
+  mux.HandleFunc("/ws", s.serveWs)
   log.Log.Println("Routes set")
-  return mux
+  return mux, nil
 
 }
 
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/log"
+	"logsviewer/pkg/backend/logquery"
+)
+
+// listHandler serves a list of the objects of the case of the request, taking
+// the list parameters, see parseListOptions.
+func (s *server) listHandler(name string, list func(dbInst db.Store, opts db.ListOptions) (map[string]interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Log.Println("Get ", name, " Endpoint Hit: ", r.URL.Query())
+		listOpts, err := parseListOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		dbInst, _, err := s.openCaseStore(r)
+		if errors.Is(err, db.ErrCaseNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Log.Println("failed to resolve case", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := list(dbInst, listOpts)
+		if errors.Is(err, db.ErrInvalidListOption) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Log.Println("failed to get ", name, " - ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, data)
+	}
+}
+
+// resolveVMIStorage returns the storage chain of a VMI, writing the error
+// response when it can't be resolved.
+func (s *server) resolveVMIStorage(w http.ResponseWriter, r *http.Request, uid string) (db.Store, string, *db.VMIStorage, bool) {
+	dbInst, caseID, err := s.openCaseStore(r)
+	if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, "", nil, false
+	}
+	if err != nil {
+		log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, "", nil, false
+	}
+
+	storage, err := dbInst.GetVMIStorage(uid)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, "", nil, false
+	}
+	if err != nil {
+		log.Log.Println("failed to get vmi storage", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, "", nil, false
+	}
+	return dbInst, caseID, storage, true
+}
+
+// getVMIStorage returns, for every volume of a VMI backed by a claim, the
+// DataVolume, PVC, PV, storage class and CDI pods behind it.
+func (s *server) getVMIStorage(w http.ResponseWriter, r *http.Request, uid string) {
+	log.Log.Println("Get VMI Storage Endpoint Hit: ", uid, r.URL.Query())
+	if _, _, storage, ok := s.resolveVMIStorage(w, r, uid); ok {
+		writeJSON(w, storage)
+	}
+}
+
+// getVMIStorageQuery returns the log query for the CDI pods and claims behind
+// the volumes of a VMI, in the format asked for with ?format=.
+func (s *server) getVMIStorageQuery(w http.ResponseWriter, r *http.Request, uid string) {
+	log.Log.Println("Get VMI Storage Query Endpoint Hit: ", uid, r.URL.Query())
+	dbInst, caseID, storage, ok := s.resolveVMIStorage(w, r, uid)
+	if !ok {
+		return
+	}
+	if len(storage.ClaimNames) == 0 {
+		http.Error(w, "vmi "+uid+" has no volumes backed by a claim", http.StatusNotFound)
+		return
+	}
+	writeLogQuery(w, r, logquery.ForStorage(s.config.CaseDataViewID(caseID), storage, s.caseNoiseRules(dbInst)))
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"logsviewer/pkg/backend/db"
+	"logsviewer/pkg/backend/log"
+	"logsviewer/pkg/backend/logstore"
+	"logsviewer/pkg/backend/noise"
+)
+
+// vmiHandler serves the per-VMI routes under /api/vmis/<uid>/.
+func (s *server) vmiHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/vmis/"), "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	uid, resource := parts[0], parts[1]
+
+	switch resource {
+	case "timeline":
+		s.getVMITimeline(w, r, uid)
+	case "storage":
+		s.getVMIStorage(w, r, uid)
+	case "storage/query":
+		s.getVMIStorageQuery(w, r, uid)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// getVMITimeline returns the lifecycle of a VMI in time order. With logs=true
+// the error lines of its virt-launcher pods, and lines mentioning the VMI, are
+// merged in as well.
+func (s *server) getVMITimeline(w http.ResponseWriter, r *http.Request, uid string) {
+	log.Log.Println("Get VMI Timeline Endpoint Hit: ", uid, r.URL.Query())
+	withLogs := false
+	if value := r.URL.Query().Get("logs"); value != "" {
+		var err error
+		if withLogs, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "invalid logs parameter: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+
+	dbInst, caseID, err := s.openCaseStore(r)
+	if errors.Is(err, db.ErrCaseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to resolve case", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	timeline, err := dbInst.GetVMITimeline(uid)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Log.Println("failed to get vmi timeline", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the timeline is still useful without the logs, e.g. while they are indexed
+	if withLogs {
+		if err := s.addTimelineLogs(caseID, timeline, s.caseNoiseRules(dbInst)); err != nil {
+			log.Log.Println("failed to add logs to the timeline of vmi ", uid, " - ", err)
+		}
+	}
+	writeJSON(w, timeline)
+}
+
+func (s *server) addTimelineLogs(caseID string, timeline *db.VMITimeline, excluded []noise.Rule) error {
+	page, err := s.newLogStore(caseID).Search(logstore.Query{
+		PodNames: timeline.PodNames,
+		UIDs:     []string{timeline.VMIUUID},
+		Levels:   []string{"error"},
+		From:     timeline.Created,
+		Exclude:  excluded,
+		Limit:    logstore.MaxLimit,
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range page.Lines {
+		timeline.Entries = append(timeline.Entries, db.TimelineEntry{
+			Time:    line.Timestamp,
+			Kind:    db.TimelineLog,
+			Name:    line.PodName,
+			Message: line.Message,
+			Details: map[string]interface{}{
+				"namespace":     line.Namespace,
+				"containerName": line.ContainerName,
+				"component":     line.Component,
+				"level":         line.Level,
+			},
+		})
+	}
+	db.SortTimeline(timeline.Entries)
+	return nil
+}